@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"school-diary-bot/bot"
+	"school-diary-bot/internal/logging"
+)
+
+// notifyBudget время на проверку уведомлений в рамках одного вызова (maxDuration функции - 10s)
+const notifyBudget = 8 * time.Second
+
+// validateCronSecret проверяет заголовок Authorization: Bearer <CRON_SECRET>
+func validateCronSecret(r *http.Request) bool {
+	secret := os.Getenv("CRON_SECRET")
+	if secret == "" {
+		return false
+	}
+
+	expected := "Bearer " + secret
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) == 1
+}
+
+// NotifyHandler запускает проверку новых оценок по расписанию (Vercel Cron).
+// Функция находит подписчиков только в хранилище сессий, общем с webhook: с хранилищем
+// в памяти или в /tmp экземпляра она не видит ни одного подписчика (см. bot.NewSessionStoreFromEnv).
+func NotifyHandler(w http.ResponseWriter, r *http.Request) {
+	logging.Init()
+	slog.Debug("[NOTIFY] Received request", "method", r.Method, "remote_addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !validateCronSecret(r) {
+		slog.Warn("[SECURITY] Invalid cron secret", "remote_addr", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := validateEnvironment(); err != nil {
+		slog.Error("[SECURITY] Environment validation failed", "err", err)
+		http.Error(w, "Configuration error", http.StatusInternalServerError)
+		return
+	}
+
+	diaryBot, err := bot.NewBot(os.Getenv("TELEGRAM_BOT_TOKEN"))
+	if err != nil {
+		slog.Error("Ошибка создания бота", "err", err)
+		http.Error(w, "Failed to create bot", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), notifyBudget)
+	defer cancel()
+
+	checked, err := diaryBot.PollNotifications(ctx)
+	if err != nil {
+		slog.Error("[NOTIFY] Ошибка проверки уведомлений", "err", err)
+		http.Error(w, "Notification check failed", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("[NOTIFY] Checked subscribers", "checked", checked)
+
+	response := map[string]interface{}{
+		"status":  "OK",
+		"checked": checked,
+	}
+	if jsonResp, err := json.Marshal(response); err == nil {
+		w.Write(jsonResp)
+	} else {
+		w.Write([]byte(`{"status": "OK"}`))
+	}
+}
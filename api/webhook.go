@@ -1,23 +1,30 @@
 package handler
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"school-diary-bot/bot"
 	"school-diary-bot/bot/eljur"
+	"school-diary-bot/internal/logging"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// webhookBudget время на обработку обновления (maxDuration функции - 10s). Остаток
+// нужен, чтобы успеть сообщить пользователю о медленном сервере школы и сохранить сессию.
+const webhookBudget = 7 * time.Second
+
 // validateWebhookSignature проверяет подпись webhook от Telegram
 func validateWebhookSignature(body []byte, signature string, secretToken string) bool {
 	if secretToken == "" {
@@ -48,12 +55,16 @@ func validateEnvironment() error {
 	if os.Getenv("TELEGRAM_BOT_TOKEN") == "" {
 		return fmt.Errorf("TELEGRAM_BOT_TOKEN environment variable is required")
 	}
-	return eljur.ValidateConfig()
+	if err := eljur.ValidateConfig(); err != nil {
+		return err
+	}
+	return bot.ValidateConfig()
 }
 
 // Handler обрабатывает входящие webhook от Telegram (с улучшенной безопасностью)
 func Handler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[WEBHOOK] Received %s request from %s", r.Method, r.RemoteAddr)
+	logging.Init()
+	slog.Debug("[WEBHOOK] Received request", "method", r.Method, "remote_addr", r.RemoteAddr)
 
 	// Устанавливаем CORS заголовки для безопасности
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -63,14 +74,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 
 	// Проверяем метод запроса
 	if r.Method != "POST" {
-		log.Printf("[SECURITY] Invalid method: %s from %s", r.Method, r.RemoteAddr)
+		slog.Warn("[SECURITY] Invalid method", "method", r.Method, "remote_addr", r.RemoteAddr)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Проверяем наличие необходимых переменных окружения
 	if err := validateEnvironment(); err != nil {
-		log.Printf("[SECURITY] Environment validation failed: %v", err)
+		slog.Error("[SECURITY] Environment validation failed", "err", err)
 		http.Error(w, "Configuration error", http.StatusInternalServerError)
 		return
 	}
@@ -78,7 +89,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	// Получаем токен бота из переменных окружения
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if botToken == "" {
-		log.Println("TELEGRAM_BOT_TOKEN не установлен")
+		slog.Error("TELEGRAM_BOT_TOKEN не установлен")
 		http.Error(w, "Bot token not configured", http.StatusInternalServerError)
 		return
 	}
@@ -86,7 +97,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	// Создаем экземпляр бота (оптимизировано для serverless)
 	diaryBot, err := bot.NewBot(botToken)
 	if err != nil {
-		log.Printf("Ошибка создания бота: %v", err)
+		slog.Error("Ошибка создания бота", "err", err)
 		http.Error(w, "Failed to create bot", http.StatusInternalServerError)
 		return
 	}
@@ -94,7 +105,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	// Читаем тело запроса
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("[SECURITY] Failed to read request body from %s: %v", r.RemoteAddr, err)
+		slog.Warn("[SECURITY] Failed to read request body", "remote_addr", r.RemoteAddr, "err", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -103,55 +114,46 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	webhookSecret := os.Getenv("WEBHOOK_SECRET")
 	signature := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
 	if !validateWebhookSignature(body, signature, webhookSecret) {
-		log.Printf("[SECURITY] Invalid webhook signature from %s", r.RemoteAddr)
+		slog.Warn("[SECURITY] Invalid webhook signature", "remote_addr", r.RemoteAddr)
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
 
-	log.Printf("[WEBHOOK] Webhook signature validated successfully")
-
 	// Парсим JSON
 	var update tgbotapi.Update
 	if err := json.Unmarshal(body, &update); err != nil {
-		log.Printf("Ошибка парсинга JSON: %v", err)
+		slog.Warn("Ошибка парсинга JSON", "err", err)
 		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Обрабатываем обновление (с управлением состоянием для serverless)
+	// Запросы к Эльжур должны завершиться до того, как платформа остановит функцию
+	ctx, cancel := context.WithTimeout(r.Context(), webhookBudget)
+	defer cancel()
+
+	// Обрабатываем обновление (состояние пользователя сохраняется в хранилище сессий самим ботом)
 	var processingError error
 	if update.Message != nil {
-		log.Printf("[WEBHOOK] Processing message from user %d: %s", update.Message.From.ID, update.Message.Text)
-		userState := diaryBot.GetUserStateServerless(update.Message.Chat.ID)
-		if err := diaryBot.HandleMessage(update.Message); err != nil {
-			log.Printf("Ошибка обработки сообщения от пользователя %d: %v", update.Message.From.ID, err)
+		// Текст не выводится: это может быть пароль. Бот пишет его на уровне debug, только вне диалогов
+		slog.Info("[WEBHOOK] Processing message", "user_id", update.Message.From.ID, "update_id", update.UpdateID, "text_length", len(update.Message.Text))
+		if err := diaryBot.HandleMessage(ctx, bot.TelegramMessage(update.Message)); err != nil {
+			slog.Error("Ошибка обработки сообщения", "user_id", update.Message.From.ID, "err", err)
 			processingError = err
-		} else {
-			log.Printf("[WEBHOOK] Successfully processed message from user %d", update.Message.From.ID)
 		}
-		// Сохраняем состояние пользователя после обработки
-		userState = diaryBot.GetUserStateServerless(update.Message.Chat.ID)
-		diaryBot.SaveUserStateServerless(userState)
 	} else if update.CallbackQuery != nil {
-		log.Printf("[WEBHOOK] Processing callback query from user %d: %s", update.CallbackQuery.From.ID, update.CallbackQuery.Data)
-		userState := diaryBot.GetUserStateServerless(update.CallbackQuery.Message.Chat.ID)
-		if err := diaryBot.HandleCallback(update.CallbackQuery); err != nil {
-			log.Printf("Ошибка обработки callback от пользователя %d: %v", update.CallbackQuery.From.ID, err)
+		slog.Info("[WEBHOOK] Processing callback query", "user_id", update.CallbackQuery.From.ID, "update_id", update.UpdateID, "data", update.CallbackQuery.Data)
+		if err := diaryBot.HandleCallback(ctx, bot.TelegramCallback(update.CallbackQuery)); err != nil {
+			slog.Error("Ошибка обработки callback", "user_id", update.CallbackQuery.From.ID, "err", err)
 			processingError = err
-		} else {
-			log.Printf("[WEBHOOK] Successfully processed callback from user %d", update.CallbackQuery.From.ID)
 		}
-		// Сохраняем состояние пользователя после обработки
-		userState = diaryBot.GetUserStateServerless(update.CallbackQuery.Message.Chat.ID)
-		diaryBot.SaveUserStateServerless(userState)
 	} else {
-		log.Printf("[WEBHOOK] Received unsupported update type: %+v", update)
+		slog.Info("[WEBHOOK] Received unsupported update type", "update_id", update.UpdateID)
 	}
 
 	// Отвечаем успехом (с учетом ошибок обработки)
 	w.WriteHeader(http.StatusOK)
 	if processingError != nil {
-		log.Printf("[WEBHOOK] Responding with processing error: %v", processingError)
+		slog.Warn("[WEBHOOK] Responding with processing error", "err", processingError)
 		response := map[string]string{
 			"status":  "OK",
 			"message": "Request processed with errors",
@@ -162,7 +164,6 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"status": "OK", "message": "Request processed with errors"}`))
 		}
 	} else {
-		log.Printf("[WEBHOOK] Request processed successfully")
 		response := map[string]string{"status": "OK"}
 		if jsonResp, err := json.Marshal(response); err == nil {
 			w.Write(jsonResp)
@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// callbackVersion версия формата параметров кнопок. Увеличивается при несовместимом
+	// изменении параметров: кнопки предыдущих версий считаются устаревшими.
+	callbackVersion = 1
+	// callbackPrefix отличает закодированные кнопки от обычных callback данных ("start", "diary")
+	callbackPrefix = "~"
+	// callbackTTL сколько живет кнопка с параметрами
+	callbackTTL = 7 * 24 * time.Hour
+	// maxCallbackPayloads сколько кнопок с параметрами хранится в сессии пользователя
+	maxCallbackPayloads = 300
+	// callbackTokenBytes длина случайного токена кнопки (8 символов в base64)
+	callbackTokenBytes = 6
+	// maxCallbackDataLength ограничение Telegram на длину callback данных в байтах
+	maxCallbackDataLength = 64
+)
+
+// callbackEscaper экранирует разделители в действии и параметрах встроенных кнопок
+var callbackEscaper = strings.NewReplacer("%", "%25", "|", "%7C", "=", "%3D")
+
+// ErrCallbackExpired возвращается для кнопок, данные которых устарели или удалены из сессии
+var ErrCallbackExpired = errors.New("меню устарело")
+
+// CallbackPayload действие кнопки и его параметры. Если они помещаются в 64 байта
+// callback данных вместе со временем выдачи, кнопка самодостаточна. Иначе payload
+// хранится в сессии пользователя, а в callback данных передается только короткий токен.
+// Кнопки обоих видов устаревают через callbackTTL.
+type CallbackPayload struct {
+	Action  string    `json:"action"`
+	Params  Params    `json:"params,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// encodeCallback возвращает callback данные кнопки с действием и параметрами.
+// Короткие данные встраиваются в кнопку вместе со временем выдачи
+// ("~1|smewo0|week|end=20241110|start=20241104"), поэтому работают без сессии: после
+// холодного старта serverless функции или на другом экземпляре с пустым хранилищем.
+// Такие данные видны пользователю, поэтому в параметры кнопок не помещаются секреты.
+// Длинные данные сохраняются в сессии и кодируются токеном "~1:<токен>"; для одинаковых
+// действий и параметров возвращается тот же токен.
+func (u *UserState) encodeCallback(action string, params Params) string {
+	now := time.Now()
+	if data := inlineCallbackData(action, params, now); len(data) <= maxCallbackDataLength {
+		return data
+	}
+
+	if u.Callbacks == nil {
+		u.Callbacks = make(map[string]CallbackPayload)
+	}
+
+	for token, payload := range u.Callbacks {
+		if payload.Action == action && maps.Equal(payload.Params, params) && now.Before(payload.Expires) {
+			payload.Expires = now.Add(callbackTTL)
+			u.Callbacks[token] = payload
+			return callbackData(token)
+		}
+	}
+
+	if len(u.Callbacks) >= maxCallbackPayloads {
+		u.pruneCallbacks(now)
+	}
+
+	token := newCallbackToken()
+	for _, exists := u.Callbacks[token]; exists; _, exists = u.Callbacks[token] {
+		token = newCallbackToken()
+	}
+	u.Callbacks[token] = CallbackPayload{Action: action, Params: params, Expires: now.Add(callbackTTL)}
+
+	return callbackData(token)
+}
+
+// decodeCallback возвращает сохраненные данные кнопки. Для обычных callback данных
+// возвращает nil без ошибки, для устаревших кнопок - ErrCallbackExpired.
+func (u *UserState) decodeCallback(data string, now time.Time) (*CallbackPayload, error) {
+	encoded, ok := strings.CutPrefix(data, callbackPrefix)
+	if !ok {
+		return nil, nil
+	}
+
+	separator := strings.IndexAny(encoded, ":|")
+	if separator < 0 || encoded[:separator] != strconv.Itoa(callbackVersion) {
+		return nil, ErrCallbackExpired
+	}
+	if encoded[separator] == '|' {
+		return decodeInlineCallback(encoded[separator+1:], now)
+	}
+
+	token := encoded[separator+1:]
+	payload, ok := u.Callbacks[token]
+	if !ok || !now.Before(payload.Expires) {
+		return nil, ErrCallbackExpired
+	}
+	return &payload, nil
+}
+
+// pruneCallbacks удаляет устаревшие кнопки, а если их нет - кнопку, которая истечет раньше всех
+func (u *UserState) pruneCallbacks(now time.Time) {
+	oldest := ""
+	for token, payload := range u.Callbacks {
+		if !now.Before(payload.Expires) {
+			delete(u.Callbacks, token)
+			continue
+		}
+		if oldest == "" || payload.Expires.Before(u.Callbacks[oldest].Expires) {
+			oldest = token
+		}
+	}
+
+	if len(u.Callbacks) >= maxCallbackPayloads {
+		delete(u.Callbacks, oldest)
+	}
+}
+
+// inlineCallbackData формирует самодостаточные callback данные: время выдачи
+// (Unix-время в base36), действие и параметры в порядке имен, разделенные "|"
+func inlineCallbackData(action string, params Params, issued time.Time) string {
+	var data strings.Builder
+	data.WriteString(callbackPrefix + strconv.Itoa(callbackVersion) + "|" + strconv.FormatInt(issued.Unix(), 36))
+	data.WriteString("|" + callbackEscaper.Replace(action))
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		data.WriteString("|" + callbackEscaper.Replace(name) + "=" + callbackEscaper.Replace(params[name]))
+	}
+	return data.String()
+}
+
+// decodeInlineCallback разбирает данные, созданные inlineCallbackData (без префикса и версии).
+// Кнопка устаревает через callbackTTL после выдачи, как и кнопка с токеном.
+func decodeInlineCallback(encoded string, now time.Time) (*CallbackPayload, error) {
+	fields := strings.Split(encoded, "|")
+	if len(fields) < 2 {
+		return nil, ErrCallbackExpired
+	}
+
+	seconds, err := strconv.ParseInt(fields[0], 36, 64)
+	if err != nil {
+		return nil, ErrCallbackExpired
+	}
+	// Небольшой запас на расхождение часов экземпляров, выдавших и принявших кнопку
+	issued := time.Unix(seconds, 0)
+	if issued.After(now.Add(time.Minute)) || !now.Before(issued.Add(callbackTTL)) {
+		return nil, ErrCallbackExpired
+	}
+
+	action, err := url.PathUnescape(fields[1])
+	if err != nil || action == "" {
+		return nil, ErrCallbackExpired
+	}
+
+	payload := &CallbackPayload{Action: action, Expires: issued.Add(callbackTTL)}
+	for _, field := range fields[2:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, ErrCallbackExpired
+		}
+		if name, err = url.PathUnescape(name); err != nil {
+			return nil, ErrCallbackExpired
+		}
+		if value, err = url.PathUnescape(value); err != nil {
+			return nil, ErrCallbackExpired
+		}
+		if payload.Params == nil {
+			payload.Params = make(Params)
+		}
+		payload.Params[name] = value
+	}
+	return payload, nil
+}
+
+// callbackData формирует callback данные кнопки из токена
+func callbackData(token string) string {
+	return callbackPrefix + strconv.Itoa(callbackVersion) + ":" + token
+}
+
+// newCallbackToken создает случайный токен кнопки
+func newCallbackToken() string {
+	buf := make([]byte, callbackTokenBytes)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// dispatchCallback передает нажатие маршрутизатору: закодированные кнопки - действию
+// с сохраненными параметрами, остальные данные - маршрутам callback данных
+func (b *Bot) dispatchCallback(user *UserState, data string) error {
+	payload, err := user.decodeCallback(data, time.Now())
+	if err != nil {
+		return b.handleExpiredCallback(user)
+	}
+	if payload == nil {
+		return b.router.Dispatch(user, data, true)
+	}
+	return b.router.DispatchAction(user, payload.Action, payload.Params)
+}
+
+// handleExpiredCallback заменяет устаревшее меню сообщением с кнопкой главного меню
+func (b *Bot) handleExpiredCallback(user *UserState) error {
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+	return b.reply(user, "⌛ Это меню устарело. Откройте его заново.", keyboard)
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"errors"
+	"maps"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackCodecInline(t *testing.T) {
+	user := &UserState{}
+
+	tests := []struct {
+		name   string
+		action string
+		params Params
+		want   string // данные после времени выдачи
+	}{
+		{"week", "week", Params{"period": "II", "start": "20241104", "end": "20241110"}, "week|end=20241110|period=II|start=20241104"},
+		{"no params", "notify", nil, "notify"},
+		{"separators", "msg_read", Params{"id": "a|b=c%d"}, "msg_read|id=a%7Cb%3Dc%25d"},
+		{"empty value", "msg_read", Params{"folder": ""}, "msg_read|folder="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Unix()
+			data := user.encodeCallback(tt.action, tt.params)
+			issued, rest, _ := strings.Cut(strings.TrimPrefix(data, "~1|"), "|")
+			seconds, err := strconv.ParseInt(issued, 36, 64)
+			if err != nil || seconds < before || seconds > time.Now().Unix() || rest != tt.want {
+				t.Fatalf("encodeCallback() = %q, want ~1|<issued>|%s", data, tt.want)
+			}
+
+			// Встроенная кнопка не зависит от сессии
+			payload, err := (&UserState{}).decodeCallback(data, time.Now())
+			if err != nil || payload.Action != tt.action || !maps.Equal(payload.Params, tt.params) {
+				t.Errorf("decodeCallback(%q) = %+v, %v", data, payload, err)
+			}
+		})
+	}
+	if len(user.Callbacks) != 0 {
+		t.Errorf("inline buttons stored %d payloads in session", len(user.Callbacks))
+	}
+
+	issued := strconv.FormatInt(time.Now().Unix(), 36)
+	for _, data := range []string{"~1|", "~1|" + issued, "~1|" + issued + "|week|start", "~1|" + issued + "|week|id=%zz",
+		"~0|" + issued + "|week", "~1|week", "~1|!!|week"} {
+		if _, err := user.decodeCallback(data, time.Now()); !errors.Is(err, ErrCallbackExpired) {
+			t.Errorf("decodeCallback(%q) error = %v, want ErrCallbackExpired", data, err)
+		}
+	}
+}
+
+func TestCallbackCodecInlineExpiry(t *testing.T) {
+	user := &UserState{}
+	data := user.encodeCallback("week", Params{"start": "20241104"})
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr bool
+	}{
+		{"fresh", now, false},
+		{"before TTL", now.Add(callbackTTL - time.Minute), false},
+		{"after TTL", now.Add(callbackTTL + time.Minute), true},
+		{"issued in the future", now.Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := user.decodeCallback(data, tt.now)
+			if tt.wantErr != errors.Is(err, ErrCallbackExpired) {
+				t.Errorf("decodeCallback() at %v error = %v, wantErr %v", tt.now, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallbackCodec(t *testing.T) {
+	user := &UserState{}
+	long := strings.Repeat("Ю", 40)
+	params := Params{"period": long, "start": "20241104", "end": "20241110"}
+
+	// Параметры не помещаются в кнопку и сохраняются в сессии
+	data := user.encodeCallback("week", params)
+	if !strings.HasPrefix(data, "~1:") || len(data) > maxCallbackDataLength {
+		t.Fatalf("encodeCallback() = %q, want short ~1: data", data)
+	}
+	if again := user.encodeCallback("week", Params{"period": long, "start": "20241104", "end": "20241110"}); again != data {
+		t.Errorf("same payload encoded as %q and %q, want one token", data, again)
+	}
+	if other := user.encodeCallback("week", Params{"period": long + "I"}); other == data {
+		t.Error("different payloads share a token")
+	}
+
+	payload, err := user.decodeCallback(data, time.Now())
+	if err != nil || payload.Action != "week" || payload.Params.String("period") != long {
+		t.Fatalf("decodeCallback() = %+v, %v", payload, err)
+	}
+
+	if payload, err := user.decodeCallback("diary", time.Now()); payload != nil || err != nil {
+		t.Errorf("decodeCallback(plain) = %+v, %v, want nil, nil", payload, err)
+	}
+
+	token := strings.TrimPrefix(data, "~1:")
+	for name, data := range map[string]string{
+		"old version":   "~0:" + token,
+		"unknown token": "~1:missing",
+		"malformed":     "~1",
+	} {
+		if _, err := user.decodeCallback(data, time.Now()); !errors.Is(err, ErrCallbackExpired) {
+			t.Errorf("%s: decodeCallback(%q) error = %v, want ErrCallbackExpired", name, data, err)
+		}
+	}
+	if _, err := user.decodeCallback(data, time.Now().Add(callbackTTL+time.Minute)); !errors.Is(err, ErrCallbackExpired) {
+		t.Errorf("decodeCallback() after TTL error = %v, want ErrCallbackExpired", err)
+	}
+}
+
+func TestCallbackCodecLimit(t *testing.T) {
+	user := &UserState{}
+	id := strings.Repeat("x", maxCallbackDataLength)
+	first := user.encodeCallback("msg_read", Params{"id": id})
+	for i := 1; i <= maxCallbackPayloads; i++ {
+		user.encodeCallback("msg_read", Params{"id": id + strconv.Itoa(i)})
+	}
+
+	if len(user.Callbacks) != maxCallbackPayloads {
+		t.Errorf("stored payloads = %d, want %d", len(user.Callbacks), maxCallbackPayloads)
+	}
+	if _, err := user.decodeCallback(first, time.Now()); !errors.Is(err, ErrCallbackExpired) {
+		t.Errorf("oldest payload error = %v, want ErrCallbackExpired", err)
+	}
+}
+
+func TestScenarioExpiredButton(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	// Кнопка из старой версии бота, кнопка, данные которой удалены из сессии,
+	// и встроенная кнопка, выданная дольше callbackTTL назад
+	stale := inlineCallbackData("week", Params{"start": "20241104", "end": "20241110"}, time.Now().Add(-callbackTTL-time.Hour))
+	for _, data := range []string{"week_II_20241104_20241110", "~1:AAAAAAAA", stale} {
+		reply := s.press(data)
+		if !strings.Contains(reply.Text(), "меню устарело") || !reply.HasButton("start") {
+			t.Errorf("press(%q) = %q, want expired menu notice", data, reply.Text())
+		}
+	}
+	if got := s.eljur.Requests("getdiary"); len(got) != 0 {
+		t.Errorf("expired buttons made %d diary requests, want 0", len(got))
+	}
+}
+
+func TestScenarioButtonsSurviveLostPayloads(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	week, ok := s.press("diary").ButtonData("4 ноября")
+	if !ok {
+		t.Fatal("week selection has no week buttons")
+	}
+
+	// Другой экземпляр функции или холодный старт: сохраненных кнопок нет
+	session := globalSessionManager.GetSession(testChatID)
+	session.Callbacks = nil
+	globalSessionManager.SaveSession(session)
+
+	if reply := s.press(week); !strings.Contains(reply.Text(), "Дневник за выбранную неделю") {
+		t.Errorf("press(%q) after losing payloads = %q, want diary", week, reply.Text())
+	}
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+)
+
+// handleChild показывает детей, доступных пользователю, и отмечает выбранного
+func (b *Bot) handleChild(user *UserState) error {
+	students := user.Client.Students()
+	if len(students) < 2 {
+		return b.reply(user, "👤 К вашей учетной записи привязан только один ученик, выбирать не из кого.", nil)
+	}
+
+	active := user.Client.GetStudentID()
+	var rows [][]Button
+	for _, student := range students {
+		label := student.Label()
+		if student.ID == active {
+			label = "✅ " + label
+		}
+		rows = append(rows, NewRow(NewButton(label, user.encodeCallback("child", Params{"id": student.ID}))))
+	}
+	rows = append(rows, NewRow(NewButton("🏠 Главное меню", "start")))
+
+	text := "👨‍👩‍👧 <b>Выбор ребенка</b>\n\n" +
+		"Дневник, расписание и оценки показываются для выбранного ребенка. " +
+		"Уведомления об оценках приходят по всем детям."
+
+	return b.reply(user, text, NewKeyboard(rows...))
+}
+
+// handleChildSelect делает выбранного ребенка активным и возвращает в главное меню
+func (b *Bot) handleChildSelect(user *UserState, id string) error {
+	if err := user.Client.SetStudent(id); err != nil {
+		slog.Warn("Unknown student selected", "chat_id", user.ChatID, "student_id", id, "err", err)
+		return b.reply(user, "❌ Ученик не найден. Откройте список заново: /child", nil)
+	}
+
+	// Выбранная неделя и период относились к другому ребенку
+	user.CurrentWeek = ""
+	user.CurrentPeriod = ""
+
+	return b.handleStart(user)
+}
+
+// activeStudentLine возвращает строку с выбранным ребенком для заголовков,
+// если у пользователя их несколько
+func activeStudentLine(user *UserState) string {
+	if len(user.Client.Students()) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("👤 %s\n", html.EscapeString(user.Client.ActiveStudent().Label()))
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+// parentRules ответ getrules для родителя с двумя детьми
+const parentRules = `{"id":"500","name":"500","title":"Иванова Анна","relations":{"students":{
+	"12345":{"class":"9А","title":"Иванов Иван"},
+	"12346":{"class":"5Б","title":"Иванова Мария"}},"groups":{}}}`
+
+func TestScenarioSwitchChild(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getrules", parentRules)
+	s.login()
+
+	reply := s.send("/child")
+	if !strings.Contains(reply.Text(), "Выбор ребенка") {
+		t.Fatalf("/child = %q, want child list", reply.Text())
+	}
+	if _, ok := reply.ButtonData("✅ Иванов Иван, 9А"); !ok {
+		t.Error("first child is not marked as active")
+	}
+	data, ok := reply.ButtonData("Иванова Мария, 5Б")
+	if !ok {
+		t.Fatal("no button for the second child")
+	}
+
+	if reply := s.press(data); !strings.Contains(reply.Text(), "Иванова Мария, 5Б") || !reply.HasButton("child") {
+		t.Errorf("main menu after switch = %q, want active child and switch button", reply.Text())
+	}
+
+	// Выбор переживает перезапуск и используется в запросах дневника
+	s.bot = newTelegramBot(t, s.tg)
+	s.press("diary")
+	requests := s.eljur.Requests("getperiods")
+	if got := requests[len(requests)-1].Query.Get("student"); got != "12346" {
+		t.Errorf("getperiods student = %q, want 12346", got)
+	}
+}
+
+func TestScenarioChildSingleStudent(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	if reply := s.send("/child"); !strings.Contains(reply.Text(), "только один ученик") {
+		t.Errorf("/child for a single student = %q", reply.Text())
+	}
+	if reply := s.send("/start"); reply.HasButton("child") {
+		t.Error("main menu offers child switch for a single student")
+	}
+}
+
+func TestScenarioChildNameEscapeHTML(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getrules", strings.Replace(parentRules, "Иванов Иван", "Иванов <Ваня> & Ко", 1))
+	s.login()
+
+	if reply := s.send("/start"); !strings.Contains(reply.Text(), "Иванов &lt;Ваня&gt; &amp; Ко, 9А") {
+		t.Errorf("main menu = %q, want escaped child name", reply.Text())
+	}
+}
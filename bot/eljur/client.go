@@ -3,10 +3,12 @@ package eljur
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -32,10 +34,19 @@ type Client struct {
 	httpClient   *http.Client
 	authToken    string
 	userLogin    string
+	password     string // пароль для повторного входа, если пользователь разрешил его хранить
 	studentID    string
 	studentClass string
+	students     []Student
 	domain       string
 	cookies      map[string]string
+
+	periods          []Period
+	periodsFetchedAt time.Time
+
+	retry retryPolicy
+
+	reauthenticating bool // выполняется повторный вход, запросы не должны запускать его снова
 }
 
 // NewClient создает новый клиент
@@ -45,6 +56,7 @@ func NewClient() *Client {
 			Timeout: 30 * time.Second,
 		},
 		cookies: make(map[string]string),
+		retry:   defaultRetryPolicy,
 	}
 }
 
@@ -90,6 +102,7 @@ type RulesResponse struct {
 			Relations struct {
 				Students map[string]struct {
 					Class string `json:"class"`
+					Title string `json:"title"`
 				} `json:"students,omitempty"`
 				Groups map[string]interface{} `json:"groups,omitempty"`
 			} `json:"relations,omitempty"`
@@ -129,41 +142,6 @@ type PeriodsResponse struct {
 	} `json:"response"`
 }
 
-// DiaryResponse представляет ответ на запрос дневника
-type DiaryResponse struct {
-	Response struct {
-		State  int                    `json:"state"`
-		Error  string                 `json:"error,omitempty"`
-		Result map[string]interface{} `json:"result,omitempty"`
-	} `json:"response"`
-}
-
-// DiaryStudent представляет студента в дневнике
-type DiaryStudent struct {
-	Name interface{} `json:"name"`
-	Days []DiaryDay  `json:"days,omitempty"`
-}
-
-// DiaryDay представляет день в дневнике
-type DiaryDay struct {
-	Date    string        `json:"date"`
-	Lessons []DiaryLesson `json:"lessons,omitempty"`
-}
-
-// DiaryLesson представляет урок в дневнике
-type DiaryLesson struct {
-	Name     string      `json:"name"`
-	Number   int         `json:"number"`
-	Marks    []DiaryMark `json:"marks,omitempty"`
-	Homework string      `json:"homework,omitempty"`
-}
-
-// DiaryMark представляет оценку
-type DiaryMark struct {
-	Value string `json:"value"`
-	Type  string `json:"type"`
-}
-
 // Message представляет сообщение
 type Message struct {
 	ID        string `json:"id"`
@@ -247,51 +225,113 @@ type ScheduleResponse struct {
 		State  int    `json:"state"`
 		Error  string `json:"error,omitempty"`
 		Result struct {
-			Students []struct {
-				Name interface{} `json:"name"`
-				Days []struct {
-					Date    string `json:"date"`
-					Lessons []struct {
-						Name    string `json:"name"`
-						Number  int    `json:"number"`
-						Teacher string `json:"teacher"`
-						Room    string `json:"room"`
-						Time    string `json:"time"`
-					} `json:"lessons,omitempty"`
-				} `json:"days,omitempty"`
-			} `json:"students"`
+			Students []ScheduleStudent `json:"students"`
 		} `json:"result,omitempty"`
 	} `json:"response"`
 }
 
+// ScheduleStudent представляет расписание одного студента
+type ScheduleStudent struct {
+	Name interface{} `json:"name"`
+	Days []struct {
+		Date    string `json:"date"`
+		Lessons []struct {
+			Name    string `json:"name"`
+			Number  int    `json:"number"`
+			Teacher string `json:"teacher"`
+			Room    string `json:"room"`
+			Time    string `json:"time"`
+		} `json:"lessons,omitempty"`
+	} `json:"days,omitempty"`
+}
+
 // MarksResponse представляет ответ на запрос оценок
 type MarksResponse struct {
 	Response struct {
 		State  int    `json:"state"`
 		Error  string `json:"error,omitempty"`
 		Result struct {
-			Students []struct {
-				Name     interface{} `json:"name"`
-				Subjects []struct {
-					Name  string `json:"name"`
-					Marks []struct {
-						Value string `json:"value"`
-						Date  string `json:"date"`
-						Type  string `json:"type"`
-					} `json:"marks"`
-				} `json:"subjects"`
-			} `json:"students"`
+			Students []MarksStudent `json:"students"`
 		} `json:"result,omitempty"`
 	} `json:"response"`
 }
 
+// MarksStudent представляет оценки одного студента
+type MarksStudent struct {
+	Name     interface{} `json:"name"`
+	Subjects []struct {
+		Name  string `json:"name"`
+		Marks []struct {
+			Value string `json:"value"`
+			Date  string `json:"date"`
+			Type  string `json:"type"`
+		} `json:"marks"`
+	} `json:"subjects"`
+}
+
 // IsAuthenticated проверяет, авторизован ли пользователь
 func (c *Client) IsAuthenticated() bool {
 	return c.authToken != "" && c.domain != ""
 }
 
-// makeRequest выполняет HTTP запрос
-func (c *Client) makeRequest(method, endpoint string, params url.Values, data url.Values) (*http.Response, error) {
+// makeRequest выполняет HTTP запрос через автомат защиты сервера школы.
+// Идемпотентные GET запросы при сбоях повторяются (см. retry.go). Если токен
+// истек, а пароль сохранен, клиент входит заново и повторяет запрос с новым токеном.
+// Истекший токен определяется так же, как ошибка для вызывающего кода: Эльжур может
+// вернуть state 401 и с HTTP статусом 200 или 400.
+func (c *Client) makeRequest(ctx context.Context, method, endpoint string, params url.Values, data url.Values) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		return c.do(ctx, method, endpoint, func() (*http.Request, error) {
+			return c.newRequest(ctx, method, endpoint, params, data)
+		})
+	}
+
+	resp, err := send()
+	if err != nil || !c.canReauthenticate(endpoint) {
+		return resp, err
+	}
+	body, err := c.bufferResponseBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if !errors.Is(bodyError(endpoint, resp.StatusCode, body), ErrUnauthorized) {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if err := c.reauthenticate(ctx); err != nil {
+		return nil, err
+	}
+	params.Set("auth_token", c.authToken)
+	return send()
+}
+
+// canReauthenticate проверяет, можно ли повторить запрос после повторного входа
+func (c *Client) canReauthenticate(endpoint string) bool {
+	return endpoint != "auth" && c.password != "" && c.userLogin != "" && !c.reauthenticating
+}
+
+// reauthenticate получает новый токен по сохраненным логину и паролю. Если сервер
+// отклонил пароль, он забывается, а ошибка сообщает об истекшей сессии.
+func (c *Client) reauthenticate(ctx context.Context) error {
+	slog.Info("[AUTH] Токен истек, выполняем повторный вход", "login", c.userLogin)
+
+	c.reauthenticating = true
+	defer func() { c.reauthenticating = false }()
+
+	err := c.Authenticate(ctx, c.userLogin, c.password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		slog.Warn("[AUTH] Сохраненный пароль отклонен сервером, повторный вход невозможен", "login", c.userLogin)
+		c.password = ""
+		return fmt.Errorf("%w: сохраненный пароль больше не подходит", ErrUnauthorized)
+	}
+	return err
+}
+
+// newRequest формирует HTTP запрос к API. Вызывается заново для каждой попытки,
+// так как тело POST запроса читается при отправке.
+func (c *Client) newRequest(ctx context.Context, method, endpoint string, params url.Values, data url.Values) (*http.Request, error) {
 	var req *http.Request
 	var err error
 
@@ -304,7 +344,7 @@ func (c *Client) makeRequest(method, endpoint string, params url.Values, data ur
 		}
 
 		// Данные отправляем в теле запроса
-		req, err = http.NewRequest("POST", fullURL, bytes.NewBufferString(data.Encode()))
+		req, err = http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewBufferString(data.Encode()))
 		if err != nil {
 			return nil, err
 		}
@@ -313,7 +353,7 @@ func (c *Client) makeRequest(method, endpoint string, params url.Values, data ur
 		if params != nil {
 			fullURL += "?" + params.Encode()
 		}
-		req, err = http.NewRequest("GET", fullURL, nil)
+		req, err = http.NewRequestWithContext(ctx, "GET", fullURL, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -335,14 +375,10 @@ func (c *Client) makeRequest(method, endpoint string, params url.Values, data ur
 		req.Header.Set("Cookie", cookieStr)
 	}
 
-	log.Printf("[REQUEST] Финальный URL: %s", req.URL.String())
-	log.Printf("[REQUEST] Метод: %s", method)
-	log.Printf("[REQUEST] Заголовки: %v", req.Header)
-	if req.Body != nil && method == "POST" {
-		log.Printf("[REQUEST] Тело запроса: %s", data.Encode())
-	}
+	// devkey и auth_token в URL маскируются логгером (см. internal/logging)
+	slog.Debug("[REQUEST] Запрос к Эльжур", "method", method, "endpoint", endpoint, "url", req.URL.String())
 
-	return c.httpClient.Do(req)
+	return req, nil
 }
 
 // readResponseBody читает и декодирует тело ответа (поддержка gzip)
@@ -351,7 +387,6 @@ func (c *Client) readResponseBody(resp *http.Response) ([]byte, error) {
 
 	// Проверяем, сжат ли ответ gzip
 	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") {
-		log.Printf("[RESPONSE] Обнаружено gzip сжатие, декодируем...")
 		gzipReader, err := gzip.NewReader(resp.Body)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка создания gzip ридера: %w", err)
@@ -360,7 +395,25 @@ func (c *Client) readResponseBody(resp *http.Response) ([]byte, error) {
 		reader = gzipReader
 	}
 
-	return io.ReadAll(reader)
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	return body, nil
+}
+
+// bufferResponseBody читает тело ответа и подменяет его прочитанной копией,
+// чтобы вызывающий код мог прочитать ответ еще раз
+func (c *Client) bufferResponseBody(resp *http.Response) ([]byte, error) {
+	body, err := c.readResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// Копия уже распакована
+	resp.Header.Del("Content-Encoding")
+	return body, nil
 }
 
 // getCommonParams возвращает общие параметры для всех запросов
@@ -374,8 +427,8 @@ func (c *Client) getCommonParams() url.Values {
 }
 
 // Authenticate выполняет авторизацию пользователя
-func (c *Client) Authenticate(login, password string) error {
-	log.Printf("[AUTH] Начинаем авторизацию пользователя: %s", login)
+func (c *Client) Authenticate(ctx context.Context, login, password string) error {
+	slog.Info("[AUTH] Авторизация пользователя", "login", login)
 
 	params := url.Values{}
 	params.Set("devkey", getDevKey())
@@ -387,145 +440,134 @@ func (c *Client) Authenticate(login, password string) error {
 	data.Set("login", login)
 	data.Set("password", password)
 
-	log.Printf("[AUTH] Отправляем запрос на: %s", getBaseURL()+"auth")
-	log.Printf("[AUTH] Параметры: %s", params.Encode())
-	log.Printf("[AUTH] Данные: login=%s, password=[HIDDEN]", login)
-
-	resp, err := c.makeRequest("POST", "auth", params, data)
+	resp, err := c.makeRequest(ctx, "POST", "auth", params, data)
 	if err != nil {
-		log.Printf("[AUTH] Ошибка запроса: %v", err)
+		slog.Warn("[AUTH] Ошибка запроса", "login", login, "err", err)
 		return fmt.Errorf("ошибка запроса авторизации: %w", err)
 	}
 	defer resp.Body.Close()
 
-	log.Printf("[AUTH] Получен ответ с кодом: %d", resp.StatusCode)
-	log.Printf("[AUTH] Заголовки ответа: %v", resp.Header)
-
 	if resp.StatusCode != 200 {
-		body, _ := c.readResponseBody(resp)
-		log.Printf("[AUTH] Тело ответа при ошибке: %s", string(body))
-		return fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return c.responseError("auth", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
 	if err != nil {
-		log.Printf("[AUTH] Ошибка чтения тела ответа: %v", err)
+		slog.Warn("[AUTH] Ошибка чтения тела ответа", "err", err)
 		return fmt.Errorf("ошибка чтения ответа: %w", err)
 	}
 
-	log.Printf("[AUTH] Тело ответа: %s", string(body))
+	slog.Debug("[AUTH] Тело ответа", "body", string(body))
 
 	var authResp AuthResponse
 	if err := json.Unmarshal(body, &authResp); err != nil {
-		log.Printf("[AUTH] Ошибка парсинга JSON: %v", err)
-		log.Printf("[AUTH] Сырой JSON: %s", string(body))
-		return fmt.Errorf("ошибка парсинга JSON: %w", err)
+		slog.Warn("[AUTH] Ошибка парсинга JSON", "err", err)
+		return malformedError("auth", err)
 	}
 
-	log.Printf("[AUTH] Разобранный ответ: %+v", authResp)
-
 	if authResp.Response.State != 200 {
-		log.Printf("[AUTH] Ошибка в ответе: State=%d, Error=%s", authResp.Response.State, authResp.Response.Error)
-		return fmt.Errorf("ошибка API: %s", authResp.Response.Error)
+		slog.Warn("[AUTH] Ошибка в ответе", "login", login, "state", authResp.Response.State, "error", authResp.Response.Error)
+		return newAPIError("auth", resp.StatusCode, authResp.Response.State, authResp.Response.Error)
 	}
 
 	if authResp.Response.Result.Token == "" {
-		log.Printf("[AUTH] Токен пустой в ответе")
-		return fmt.Errorf("получен пустой токен авторизации")
+		slog.Warn("[AUTH] Токен пустой в ответе", "login", login)
+		return &APIError{Endpoint: "auth", Status: resp.StatusCode, State: authResp.Response.State, Message: "получен пустой токен авторизации", Kind: ErrMalformedResponse}
 	}
 
 	c.authToken = authResp.Response.Result.Token
 	c.userLogin = login
-	tokenPreview := c.authToken
-	if len(tokenPreview) > 10 {
-		tokenPreview = tokenPreview[:10]
-	}
-	log.Printf("[AUTH] Получен токен: %s...", tokenPreview)
 
 	// Сохраняем cookies
 	for _, cookie := range resp.Cookies() {
-		log.Printf("[AUTH] Получен cookie: %s = %s", cookie.Name, cookie.Value)
+		slog.Debug("[AUTH] Получен cookie", "name", cookie.Name)
 		if cookie.Name == "school_domain" {
 			c.domain = cookie.Value
 			c.cookies[cookie.Name] = cookie.Value
-			log.Printf("[AUTH] Сохранен домен: %s", c.domain)
+			slog.Debug("[AUTH] Сохранен домен", "domain", c.domain)
 		}
 	}
 
 	// Получаем информацию о пользователе
-	log.Printf("[AUTH] Получаем информацию о пользователе...")
-	return c.getRules()
+	return c.getRules(ctx)
 }
 
 // getRules получает информацию о пользователе
-func (c *Client) getRules() error {
-	log.Printf("[RULES] Запрашиваем информацию о пользователе...")
+func (c *Client) getRules(ctx context.Context) error {
 	params := c.getCommonParams()
 
-	log.Printf("[RULES] Отправляем запрос на: %s", getBaseURL()+"getrules")
-	log.Printf("[RULES] Параметры: %s", params.Encode())
-
-	resp, err := c.makeRequest("GET", "getrules", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getrules", params, nil)
 	if err != nil {
-		log.Printf("[RULES] Ошибка запроса: %v", err)
+		slog.Warn("[RULES] Ошибка запроса", "err", err)
 		return fmt.Errorf("ошибка запроса правил: %w", err)
 	}
 	defer resp.Body.Close()
 
-	log.Printf("[RULES] Получен ответ с кодом: %d", resp.StatusCode)
-
 	if resp.StatusCode != 200 {
-		body, _ := c.readResponseBody(resp)
-		log.Printf("[RULES] Тело ответа при ошибке: %s", string(body))
-		return fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return c.responseError("getrules", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
 	if err != nil {
-		log.Printf("[RULES] Ошибка чтения тела ответа: %v", err)
+		slog.Warn("[RULES] Ошибка чтения тела ответа", "err", err)
 		return fmt.Errorf("ошибка чтения ответа: %w", err)
 	}
 
-	log.Printf("[RULES] Тело ответа: %s", string(body))
+	slog.Debug("[RULES] Тело ответа", "body", string(body))
 
 	var rulesResp RulesResponse
 	if err := json.Unmarshal(body, &rulesResp); err != nil {
-		log.Printf("[RULES] Ошибка парсинга JSON: %v", err)
-		return fmt.Errorf("ошибка парсинга JSON: %w", err)
+		slog.Warn("[RULES] Ошибка парсинга JSON", "err", err)
+		return malformedError("getrules", err)
 	}
 
-	log.Printf("[RULES] Разобранный ответ: %+v", rulesResp)
-
 	if rulesResp.Response.State != 200 {
-		log.Printf("[RULES] Ошибка в ответе: State=%d, Error=%s", rulesResp.Response.State, rulesResp.Response.Error)
-		return fmt.Errorf("ошибка API: %s", rulesResp.Response.Error)
+		slog.Warn("[RULES] Ошибка в ответе", "state", rulesResp.Response.State, "error", rulesResp.Response.Error)
+		return newAPIError("getrules", resp.StatusCode, rulesResp.Response.State, rulesResp.Response.Error)
+	}
+
+	// Извлекаем студентов, к которым есть доступ (у родителя их может быть несколько)
+	students := make([]Student, 0, len(rulesResp.Response.Result.Relations.Students))
+	for id, student := range rulesResp.Response.Result.Relations.Students {
+		students = append(students, Student{ID: id, Name: student.Title, Class: student.Class})
+	}
+	sortStudents(students)
+	c.students = students
+
+	// Оставляем выбранного ранее студента, если он все еще доступен
+	if c.studentID != "" && c.SetStudent(c.studentID) == nil {
+		return nil
+	}
+	if len(students) > 0 {
+		c.studentID, c.studentClass = students[0].ID, students[0].Class
+		return nil
 	}
 
-	// Извлекаем ID студента
+	// Учетная запись без связанных студентов: используем ID самого пользователя
 	if rulesResp.Response.Result.ID != nil {
 		c.studentID = fmt.Sprintf("%v", rulesResp.Response.Result.ID)
 	} else if rulesResp.Response.Result.Name != nil {
 		c.studentID = fmt.Sprintf("%v", rulesResp.Response.Result.Name)
 	}
 
-	// Извлекаем класс студента
-	for _, student := range rulesResp.Response.Result.Relations.Students {
-		if student.Class != "" {
-			c.studentClass = student.Class
-			break
-		}
-	}
-
 	return nil
 }
 
-// GetPeriods получает периоды обучения
-func (c *Client) GetPeriods(weeks, showDisabled bool) (*PeriodsResponse, error) {
+// GetPeriods получает периоды обучения выбранного студента
+func (c *Client) GetPeriods(ctx context.Context, weeks, showDisabled bool) (*PeriodsResponse, error) {
+	return c.getPeriods(ctx, c.studentID, weeks, showDisabled)
+}
+
+// getPeriods получает периоды обучения указанного студента
+func (c *Client) getPeriods(ctx context.Context, studentID string, weeks, showDisabled bool) (*PeriodsResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	params := c.getCommonParams()
+	if studentID != "" {
+		params.Set("student", studentID)
+	}
 	if weeks {
 		params.Set("weeks", "true")
 	} else {
@@ -537,14 +579,14 @@ func (c *Client) GetPeriods(weeks, showDisabled bool) (*PeriodsResponse, error)
 		params.Set("show_disabled", "false")
 	}
 
-	resp, err := c.makeRequest("GET", "getperiods", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getperiods", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса периодов: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getperiods", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -554,20 +596,20 @@ func (c *Client) GetPeriods(weeks, showDisabled bool) (*PeriodsResponse, error)
 
 	var periodsResp PeriodsResponse
 	if err := json.Unmarshal(body, &periodsResp); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, malformedError("getperiods", err)
 	}
 
 	if periodsResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", periodsResp.Response.Error)
+		return nil, newAPIError("getperiods", resp.StatusCode, periodsResp.Response.State, periodsResp.Response.Error)
 	}
 
 	return &periodsResp, nil
 }
 
 // GetDiary получает дневник за указанный период
-func (c *Client) GetDiary(days string) (*DiaryResponse, error) {
+func (c *Client) GetDiary(ctx context.Context, days string) (*DiaryResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
@@ -579,16 +621,16 @@ func (c *Client) GetDiary(days string) (*DiaryResponse, error) {
 	params.Set("days", days)
 	params.Set("rings", "true")
 
-	log.Printf("[DIARY] Запрашиваем дневник за период: %s", days)
+	slog.Debug("[DIARY] Запрашиваем дневник", "days", days, "student", c.studentID)
 
-	resp, err := c.makeRequest("GET", "getdiary", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getdiary", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса дневника: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getdiary", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -596,16 +638,16 @@ func (c *Client) GetDiary(days string) (*DiaryResponse, error) {
 		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
 	}
 
-	log.Printf("[DIARY] Тело ответа: %s", string(body))
+	slog.Debug("[DIARY] Тело ответа", "body", string(body))
 
 	var diaryResp DiaryResponse
 	if err := json.Unmarshal(body, &diaryResp); err != nil {
-		log.Printf("[DIARY] Ошибка парсинга JSON: %v", err)
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		slog.Warn("[DIARY] Ошибка парсинга JSON", "err", err)
+		return nil, malformedError("getdiary", err)
 	}
 
 	if diaryResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", diaryResp.Response.Error)
+		return nil, newAPIError("getdiary", resp.StatusCode, diaryResp.Response.State, diaryResp.Response.Error)
 	}
 
 	return &diaryResp, nil
@@ -622,9 +664,9 @@ func (c *Client) GetStudentClass() string {
 }
 
 // GetMessages получает сообщения (входящие или отправленные)
-func (c *Client) GetMessages(folder string) (*MessagesResponse, error) {
+func (c *Client) GetMessages(ctx context.Context, folder string) (*MessagesResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
@@ -634,14 +676,14 @@ func (c *Client) GetMessages(folder string) (*MessagesResponse, error) {
 	params := c.getCommonParams()
 	params.Set("folder", folder)
 
-	resp, err := c.makeRequest("GET", "getmessages", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getmessages", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса сообщений: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getmessages", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -651,20 +693,20 @@ func (c *Client) GetMessages(folder string) (*MessagesResponse, error) {
 
 	var messagesResp MessagesResponse
 	if err := json.Unmarshal(body, &messagesResp); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, malformedError("getmessages", err)
 	}
 
 	if messagesResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", messagesResp.Response.Error)
+		return nil, newAPIError("getmessages", resp.StatusCode, messagesResp.Response.State, messagesResp.Response.Error)
 	}
 
 	return &messagesResp, nil
 }
 
 // GetMessageDetails получает детали конкретного сообщения
-func (c *Client) GetMessageDetails(messageID string) (*MessageDetailsResponse, error) {
+func (c *Client) GetMessageDetails(ctx context.Context, messageID string) (*MessageDetailsResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
@@ -674,14 +716,14 @@ func (c *Client) GetMessageDetails(messageID string) (*MessageDetailsResponse, e
 	params := c.getCommonParams()
 	params.Set("id", messageID)
 
-	resp, err := c.makeRequest("GET", "getmessageinfo", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getmessageinfo", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса деталей сообщения: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getmessageinfo", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -689,27 +731,25 @@ func (c *Client) GetMessageDetails(messageID string) (*MessageDetailsResponse, e
 		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
 	}
 
-	log.Printf("[MESSAGE_DETAILS] Тело ответа: %s", string(body))
+	slog.Debug("[MESSAGE_DETAILS] Тело ответа", "body", string(body))
 
 	var detailsResp MessageDetailsResponse
 	if err := json.Unmarshal(body, &detailsResp); err != nil {
-		log.Printf("[MESSAGE_DETAILS] Ошибка парсинга JSON: %v", err)
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		slog.Warn("[MESSAGE_DETAILS] Ошибка парсинга JSON", "err", err)
+		return nil, malformedError("getmessageinfo", err)
 	}
 
-	log.Printf("[MESSAGE_DETAILS] Разобранный ответ: %+v", detailsResp)
-
 	if detailsResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", detailsResp.Response.Error)
+		return nil, newAPIError("getmessageinfo", resp.StatusCode, detailsResp.Response.State, detailsResp.Response.Error)
 	}
 
 	return &detailsResp, nil
 }
 
 // GetMessageReceivers получает список доступных получателей сообщений
-func (c *Client) GetMessageReceivers() (*ReceiversResponse, error) {
+func (c *Client) GetMessageReceivers(ctx context.Context) (*ReceiversResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
@@ -718,14 +758,14 @@ func (c *Client) GetMessageReceivers() (*ReceiversResponse, error) {
 
 	params := c.getCommonParams()
 
-	resp, err := c.makeRequest("GET", "getmessagereceivers", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getmessagereceivers", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса получателей: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getmessagereceivers", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -735,23 +775,21 @@ func (c *Client) GetMessageReceivers() (*ReceiversResponse, error) {
 
 	var receiversResp ReceiversResponse
 	if err := json.Unmarshal(body, &receiversResp); err != nil {
-		log.Printf("[RECEIVERS] Ошибка парсинга JSON: %v", err)
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		slog.Warn("[RECEIVERS] Ошибка парсинга JSON", "err", err)
+		return nil, malformedError("getmessagereceivers", err)
 	}
 
-	log.Printf("[RECEIVERS] Разобранный ответ: %+v", receiversResp)
-
 	if receiversResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", receiversResp.Response.Error)
+		return nil, newAPIError("getmessagereceivers", resp.StatusCode, receiversResp.Response.State, receiversResp.Response.Error)
 	}
 
 	return &receiversResp, nil
 }
 
 // SendMessage отправляет сообщение
-func (c *Client) SendMessage(recipients []string, subject, text string) (*SendMessageResponse, error) {
+func (c *Client) SendMessage(ctx context.Context, recipients []string, subject, text string) (*SendMessageResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
@@ -765,14 +803,14 @@ func (c *Client) SendMessage(recipients []string, subject, text string) (*SendMe
 	data.Set("subject", subject)
 	data.Set("text", text)
 
-	resp, err := c.makeRequest("POST", "sendmessage", params, data)
+	resp, err := c.makeRequest(ctx, "POST", "sendmessage", params, data)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка отправки сообщения: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("sendmessage", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -782,29 +820,33 @@ func (c *Client) SendMessage(recipients []string, subject, text string) (*SendMe
 
 	var sendResp SendMessageResponse
 	if err := json.Unmarshal(body, &sendResp); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, malformedError("sendmessage", err)
 	}
 
 	if sendResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", sendResp.Response.Error)
+		return nil, newAPIError("sendmessage", resp.StatusCode, sendResp.Response.State, sendResp.Response.Error)
 	}
 
 	return &sendResp, nil
 }
 
 // GetSchedule получает расписание занятий
-func (c *Client) GetSchedule(days, classID string) (*ScheduleResponse, error) {
+func (c *Client) GetSchedule(ctx context.Context, days, classID string) (*ScheduleResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
 		return nil, fmt.Errorf("ID студента не найден")
 	}
 
-	// Если не указан период дней, используем текущую неделю
+	// Если не указан период дней, используем текущую учебную неделю
 	if days == "" {
-		days = "20250512-20250518" // Пример недели
+		week, err := c.CurrentWeek(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		days = week.Days()
 	}
 
 	// Если не указан класс, используем класс пользователя
@@ -818,14 +860,14 @@ func (c *Client) GetSchedule(days, classID string) (*ScheduleResponse, error) {
 	params.Set("class", classID)
 	params.Set("rings", "true")
 
-	resp, err := c.makeRequest("GET", "getschedule", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getschedule", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса расписания: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getschedule", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -835,56 +877,67 @@ func (c *Client) GetSchedule(days, classID string) (*ScheduleResponse, error) {
 
 	var scheduleResp ScheduleResponse
 	if err := json.Unmarshal(body, &scheduleResp); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, malformedError("getschedule", err)
 	}
 
 	if scheduleResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", scheduleResp.Response.Error)
+		return nil, newAPIError("getschedule", resp.StatusCode, scheduleResp.Response.State, scheduleResp.Response.Error)
 	}
 
 	return &scheduleResp, nil
 }
 
-// GetMarks получает оценки за указанный период
-func (c *Client) GetMarks(period int, startDate, endDate string) (*MarksResponse, error) {
+// GetMarks получает оценки за указанный период.
+// Если задано название периода, границы берутся из getperiods;
+// если не задано ни название, ни даты - используется текущий период.
+func (c *Client) GetMarks(ctx context.Context, period string, startDate, endDate string) (*MarksResponse, error) {
 	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("пользователь не авторизован")
+		return nil, ErrUnauthorized
 	}
 
 	if c.studentID == "" {
 		return nil, fmt.Errorf("ID студента не найден")
 	}
 
-	// Определяем даты периода на основе выбранной четверти
-	if period > 0 && period <= 4 {
-		quarters := map[int][2]string{
-			1: {"20240903", "20241102"}, // Первая четверть
-			2: {"20241111", "20241230"}, // Вторая четверть
-			3: {"20250120", "20250322"}, // Третья четверть
-			4: {"20250331", "20250524"}, // Четвертая четверть
+	// Определяем даты на основе периодов, которые есть в школе
+	if period != "" {
+		p, err := c.FindPeriod(ctx, period)
+		if err != nil {
+			return nil, err
 		}
-		startDate = quarters[period][0]
-		endDate = quarters[period][1]
+		startDate, endDate = p.Start, p.End
 	} else if startDate == "" || endDate == "" {
-		// Если не указаны ни четверть, ни даты - используем текущую четверть
-		startDate = "20250331"
-		endDate = "20250524"
+		p, err := c.CurrentPeriod(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		startDate, endDate = p.Start, p.End
+	}
+
+	return c.GetStudentMarks(ctx, c.studentID, startDate, endDate)
+}
+
+// GetStudentMarks получает оценки указанного студента за период. Используется,
+// чтобы проверять оценки всех детей без переключения выбранного студента.
+func (c *Client) GetStudentMarks(ctx context.Context, studentID, startDate, endDate string) (*MarksResponse, error) {
+	if !c.IsAuthenticated() {
+		return nil, ErrUnauthorized
 	}
 
 	days := fmt.Sprintf("%s-%s", startDate, endDate)
 
 	params := c.getCommonParams()
-	params.Set("student", c.studentID)
+	params.Set("student", studentID)
 	params.Set("days", days)
 
-	resp, err := c.makeRequest("GET", "getmarks", params, nil)
+	resp, err := c.makeRequest(ctx, "GET", "getmarks", params, nil)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса оценок: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP ошибка: %d", resp.StatusCode)
+		return nil, c.responseError("getmarks", resp)
 	}
 
 	body, err := c.readResponseBody(resp)
@@ -894,11 +947,11 @@ func (c *Client) GetMarks(period int, startDate, endDate string) (*MarksResponse
 
 	var marksResp MarksResponse
 	if err := json.Unmarshal(body, &marksResp); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, malformedError("getmarks", err)
 	}
 
 	if marksResp.Response.State != 200 {
-		return nil, fmt.Errorf("ошибка API: %s", marksResp.Response.Error)
+		return nil, newAPIError("getmarks", resp.StatusCode, marksResp.Response.State, marksResp.Response.Error)
 	}
 
 	return &marksResp, nil
@@ -909,20 +962,40 @@ func (c *Client) GetLogin() string {
 	return c.userLogin
 }
 
+// SetPassword сохраняет пароль для автоматического повторного входа при истечении
+// токена. Пустая строка отключает повторный вход.
+func (c *Client) SetPassword(password string) {
+	c.password = password
+}
+
+// GetPassword возвращает сохраненный пароль (для session management)
+func (c *Client) GetPassword() string {
+	return c.password
+}
+
 // GetToken возвращает токен аутентификации (для session management)
 func (c *Client) GetToken() string {
 	return c.authToken
 }
 
-// RestoreSession восстанавливает сессию по логину и токену
-func (c *Client) RestoreSession(login, token string) error {
+// GetDomain возвращает домен школы из cookie school_domain (для session management)
+func (c *Client) GetDomain() string {
+	return c.domain
+}
+
+// RestoreSession восстанавливает сессию по логину, токену и домену школы
+func (c *Client) RestoreSession(ctx context.Context, login, token, domain string) error {
 	if token == "" {
-		return fmt.Errorf("токен не может быть пустым")
+		return fmt.Errorf("%w: токен не может быть пустым", ErrUnauthorized)
 	}
 
 	c.authToken = token
 	c.userLogin = login
+	if domain != "" {
+		c.domain = domain
+		c.cookies["school_domain"] = domain
+	}
 
 	// Проверяем валидность токена запросом getrules
-	return c.getRules()
+	return c.getRules(ctx)
 }
@@ -0,0 +1,741 @@
+package eljur
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+)
+
+// newTestClient запускает фейковый сервер Эльжур и направляет на него клиента
+func newTestClient(t *testing.T) (*Client, *eljurtest.Server) {
+	t.Helper()
+
+	srv := eljurtest.NewServer()
+	t.Cleanup(srv.Close)
+	t.Setenv("ELJUR_API_URL", srv.BaseURL())
+	t.Setenv("ELJUR_DEV_KEY", srv.DevKey)
+
+	c := NewClient()
+	// Повторы без реальных пауз, чтобы тесты сбоев оставались быстрыми
+	c.retry.baseDelay, c.retry.maxDelay = time.Millisecond, 2*time.Millisecond
+	return c, srv
+}
+
+// newAuthenticatedClient возвращает клиента, прошедшего авторизацию на фейковом сервере
+func newAuthenticatedClient(t *testing.T) (*Client, *eljurtest.Server) {
+	t.Helper()
+
+	c, srv := newTestClient(t)
+	if err := c.Authenticate(context.Background(), srv.Login, srv.Password); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return c, srv
+}
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation(dateLayout, s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		failure  *eljurtest.Failure
+		wantErr  error
+	}{
+		{name: "valid credentials", login: eljurtest.DefaultLogin, password: eljurtest.DefaultPassword},
+		{name: "wrong password", login: eljurtest.DefaultLogin, password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "server error", login: eljurtest.DefaultLogin, password: eljurtest.DefaultPassword,
+			failure: &eljurtest.Failure{Status: http.StatusInternalServerError}, wantErr: ErrServerError},
+		{name: "api error", login: eljurtest.DefaultLogin, password: eljurtest.DefaultPassword,
+			failure: &eljurtest.Failure{State: 400, Error: "Пользователь заблокирован"}, wantErr: ErrInvalidCredentials},
+		{name: "malformed json", login: eljurtest.DefaultLogin, password: eljurtest.DefaultPassword,
+			failure: &eljurtest.Failure{Body: "<html>502 Bad Gateway</html>"}, wantErr: ErrMalformedResponse},
+		{name: "empty token", login: eljurtest.DefaultLogin, password: eljurtest.DefaultPassword,
+			failure: &eljurtest.Failure{State: 200, Body: `{"response":{"state":200,"result":{"token":""}}}`}, wantErr: ErrMalformedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestClient(t)
+			if tt.failure != nil {
+				srv.Fail("auth", *tt.failure)
+			}
+
+			err := c.Authenticate(context.Background(), tt.login, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if c.IsAuthenticated() {
+					t.Error("client is authenticated after failed login")
+				}
+				return
+			}
+
+			if !c.IsAuthenticated() {
+				t.Fatal("client is not authenticated")
+			}
+			if got := c.GetToken(); got != eljurtest.DefaultToken {
+				t.Errorf("token = %q, want %q", got, eljurtest.DefaultToken)
+			}
+			if got := c.GetDomain(); got != eljurtest.DefaultDomain {
+				t.Errorf("domain = %q, want %q", got, eljurtest.DefaultDomain)
+			}
+			if got := c.GetStudentID(); got != eljurtest.DefaultStudentID {
+				t.Errorf("student = %q, want %q", got, eljurtest.DefaultStudentID)
+			}
+			if got := c.GetStudentClass(); got != eljurtest.DefaultClass {
+				t.Errorf("class = %q, want %q", got, eljurtest.DefaultClass)
+			}
+
+			// Авторизация передает логин и пароль в теле, а не в URL
+			auth := srv.Requests("auth")[0]
+			if auth.Query.Get("password") != "" {
+				t.Error("password leaked into query string")
+			}
+			if auth.Form.Get("login") != tt.login {
+				t.Errorf("form login = %q, want %q", auth.Form.Get("login"), tt.login)
+			}
+		})
+	}
+}
+
+func TestRestoreSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		domain  string
+		wantErr bool
+	}{
+		{name: "valid session", token: eljurtest.DefaultToken, domain: eljurtest.DefaultDomain},
+		{name: "expired token", token: "expired", domain: eljurtest.DefaultDomain, wantErr: true},
+		{name: "missing domain", token: eljurtest.DefaultToken, domain: "", wantErr: true},
+		{name: "empty token", token: "", domain: eljurtest.DefaultDomain, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t)
+
+			err := c.RestoreSession(context.Background(), eljurtest.DefaultLogin, tt.token, tt.domain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestoreSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && c.GetStudentID() != eljurtest.DefaultStudentID {
+				t.Errorf("student = %q, want %q", c.GetStudentID(), eljurtest.DefaultStudentID)
+			}
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	tests := []struct {
+		name         string
+		password     string             // сохраненный пароль
+		expiry       *eljurtest.Failure // ответ на истекший токен (nil - HTTP 401)
+		wantErr      error
+		wantAuth     int // запросов auth после истечения токена
+		wantPassword string
+	}{
+		{name: "stored password", password: eljurtest.DefaultPassword, wantAuth: 1, wantPassword: eljurtest.DefaultPassword},
+		{name: "no stored password", wantErr: ErrUnauthorized},
+		{name: "password changed", password: "old", wantErr: ErrUnauthorized, wantAuth: 1},
+		{
+			name:         "state 401 with HTTP 200",
+			password:     eljurtest.DefaultPassword,
+			expiry:       &eljurtest.Failure{State: http.StatusUnauthorized, Error: "Auth token is invalid", Times: 1},
+			wantAuth:     1,
+			wantPassword: eljurtest.DefaultPassword,
+		},
+		{
+			name:         "state 401 with HTTP 400",
+			password:     eljurtest.DefaultPassword,
+			expiry:       &eljurtest.Failure{Status: http.StatusBadRequest, State: http.StatusUnauthorized, Times: 1},
+			wantAuth:     1,
+			wantPassword: eljurtest.DefaultPassword,
+		},
+		{
+			name:    "state 401 without stored password",
+			expiry:  &eljurtest.Failure{State: http.StatusUnauthorized, Times: 1},
+			wantErr: ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newAuthenticatedClient(t)
+			c.SetPassword(tt.password)
+			if tt.expiry != nil {
+				srv.Fail("getdiary", *tt.expiry)
+			} else {
+				srv.ExpireToken()
+			}
+			authBefore := len(srv.Requests("auth"))
+
+			_, err := c.GetDiary(context.Background(), "20241014-20241020")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetDiary() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := len(srv.Requests("auth")) - authBefore; got != tt.wantAuth {
+				t.Errorf("auth requests = %d, want %d", got, tt.wantAuth)
+			}
+			if got := c.GetPassword(); got != tt.wantPassword {
+				t.Errorf("password after request = %q, want %q", got, tt.wantPassword)
+			}
+			if tt.wantErr == nil && c.GetToken() != srv.Token {
+				t.Errorf("token = %q, want renewed %q", c.GetToken(), srv.Token)
+			}
+		})
+	}
+
+	// Истекший токен при восстановлении сессии тоже обновляется
+	c, srv := newTestClient(t)
+	srv.ExpireToken()
+	c.SetPassword(eljurtest.DefaultPassword)
+	if err := c.RestoreSession(context.Background(), eljurtest.DefaultLogin, eljurtest.DefaultToken, eljurtest.DefaultDomain); err != nil {
+		t.Fatalf("RestoreSession() with stored password: %v", err)
+	}
+	if c.GetToken() != srv.Token {
+		t.Errorf("restored token = %q, want %q", c.GetToken(), srv.Token)
+	}
+}
+
+// parentRules ответ getrules для родителя с двумя детьми
+const parentRules = `{"id":"500","name":"500","title":"Иванова Анна","relations":{"students":{
+	"12345":{"class":"9А","title":"Иванов Иван"},
+	"12346":{"class":"5Б","title":"Иванова Мария"}},"groups":{}}}`
+
+func TestStudents(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.SetResult("getrules", parentRules)
+	if err := c.Authenticate(context.Background(), srv.Login, srv.Password); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	want := []Student{
+		{ID: "12345", Name: "Иванов Иван", Class: "9А"},
+		{ID: "12346", Name: "Иванова Мария", Class: "5Б"},
+	}
+	if got := c.Students(); !slices.Equal(got, want) {
+		t.Fatalf("Students() = %+v, want %+v", got, want)
+	}
+	if got := c.ActiveStudent(); got != want[0] {
+		t.Errorf("ActiveStudent() = %+v, want first student", got)
+	}
+
+	if _, err := c.StudyPeriods(context.Background()); err != nil {
+		t.Fatalf("StudyPeriods: %v", err)
+	}
+	if err := c.SetStudent("12346"); err != nil {
+		t.Fatalf("SetStudent: %v", err)
+	}
+	if c.GetStudentID() != "12346" || c.GetStudentClass() != "5Б" {
+		t.Errorf("student = %s (%s), want 12346 (5Б)", c.GetStudentID(), c.GetStudentClass())
+	}
+	if periods, _ := c.CachedPeriods(); periods != nil {
+		t.Error("periods cache kept after switching student")
+	}
+	if err := c.SetStudent("99999"); err == nil || c.GetStudentID() != "12346" {
+		t.Errorf("SetStudent(unknown) error = %v, student = %s", err, c.GetStudentID())
+	}
+
+	// Выбор сохраняется при повторной проверке токена
+	if err := c.RestoreSession(context.Background(), c.GetLogin(), c.GetToken(), c.GetDomain()); err != nil {
+		t.Fatalf("RestoreSession: %v", err)
+	}
+	if c.GetStudentID() != "12346" {
+		t.Errorf("student after restore = %s, want 12346", c.GetStudentID())
+	}
+
+	if _, err := c.GetDiary(context.Background(), "20241014-20241020"); err != nil {
+		t.Fatalf("GetDiary: %v", err)
+	}
+	requests := srv.Requests("getdiary")
+	if got := requests[len(requests)-1].Query.Get("student"); got != "12346" {
+		t.Errorf("getdiary student = %q, want 12346", got)
+	}
+}
+
+func TestMethodsRequireAuthentication(t *testing.T) {
+	calls := map[string]func(c *Client) error{
+		"GetPeriods": func(c *Client) error { _, err := c.GetPeriods(context.Background(), true, false); return err },
+		"GetDiary":   func(c *Client) error { _, err := c.GetDiary(context.Background(), "20241014-20241020"); return err },
+		"GetMarks": func(c *Client) error {
+			_, err := c.GetMarks(context.Background(), "", "20241001", "20241031")
+			return err
+		},
+		"GetSchedule": func(c *Client) error {
+			_, err := c.GetSchedule(context.Background(), "20241014-20241020", "")
+			return err
+		},
+		"GetMessages":         func(c *Client) error { _, err := c.GetMessages(context.Background(), "inbox"); return err },
+		"GetMessageDetails":   func(c *Client) error { _, err := c.GetMessageDetails(context.Background(), "502"); return err },
+		"GetMessageReceivers": func(c *Client) error { _, err := c.GetMessageReceivers(context.Background()); return err },
+		"SendMessage": func(c *Client) error {
+			_, err := c.SendMessage(context.Background(), []string{"t1"}, "s", "t")
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			c, srv := newTestClient(t)
+			if err := call(c); !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("error = %v, want ErrUnauthorized", err)
+			}
+			if n := len(srv.Requests("")); n != 0 {
+				t.Errorf("unauthenticated client made %d requests", n)
+			}
+		})
+	}
+}
+
+func TestEndpointErrors(t *testing.T) {
+	calls := []struct {
+		endpoint string
+		call     func(c *Client) error
+	}{
+		{"getperiods", func(c *Client) error { _, err := c.GetPeriods(context.Background(), true, false); return err }},
+		{"getdiary", func(c *Client) error { _, err := c.GetDiary(context.Background(), "20241014-20241020"); return err }},
+		{"getmarks", func(c *Client) error {
+			_, err := c.GetMarks(context.Background(), "", "20241001", "20241031")
+			return err
+		}},
+		{"getschedule", func(c *Client) error {
+			_, err := c.GetSchedule(context.Background(), "20241014-20241020", "")
+			return err
+		}},
+		{"getmessages", func(c *Client) error { _, err := c.GetMessages(context.Background(), "inbox"); return err }},
+		{"getmessageinfo", func(c *Client) error { _, err := c.GetMessageDetails(context.Background(), "502"); return err }},
+		{"getmessagereceivers", func(c *Client) error { _, err := c.GetMessageReceivers(context.Background()); return err }},
+		{"sendmessage", func(c *Client) error {
+			_, err := c.SendMessage(context.Background(), []string{"t1"}, "s", "t")
+			return err
+		}},
+	}
+	failures := map[string]struct {
+		failure eljurtest.Failure
+		want    error // вид ошибки, nil - ошибка не классифицирована
+	}{
+		"http 500":       {eljurtest.Failure{Status: http.StatusInternalServerError}, ErrServerError},
+		"http 401":       {eljurtest.Failure{Status: http.StatusUnauthorized, Error: "Auth token is invalid"}, ErrUnauthorized},
+		"http 429":       {eljurtest.Failure{Status: http.StatusTooManyRequests}, ErrRateLimited},
+		"api state 400":  {eljurtest.Failure{State: 400, Error: "Ошибка параметров"}, nil},
+		"api state 403":  {eljurtest.Failure{State: 403, Error: "Доступ запрещен"}, ErrForbidden},
+		"api state 404":  {eljurtest.Failure{State: 404, Error: "Сообщение не найдено"}, ErrNotFound},
+		"malformed json": {eljurtest.Failure{Body: `{"response": {"state": 200, "result": `}, ErrMalformedResponse},
+	}
+
+	for _, tt := range calls {
+		for name, f := range failures {
+			t.Run(tt.endpoint+"/"+name, func(t *testing.T) {
+				c, srv := newAuthenticatedClient(t)
+				srv.Fail(tt.endpoint, f.failure)
+
+				err := tt.call(c)
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) {
+					t.Fatalf("error = %v, want *APIError", err)
+				}
+				if apiErr.Endpoint != tt.endpoint || apiErr.Kind != f.want {
+					t.Errorf("APIError = %+v, want endpoint %s and kind %v", apiErr, tt.endpoint, f.want)
+				}
+				if f.want != nil && !errors.Is(err, f.want) {
+					t.Errorf("errors.Is(%v, %v) = false", err, f.want)
+				}
+				if f.failure.Error != "" && apiErr.Message != f.failure.Error {
+					t.Errorf("message = %q, want %q", apiErr.Message, f.failure.Error)
+				}
+
+				srv.Recover()
+				if err := tt.call(c); err != nil {
+					t.Fatalf("error after recovery: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestGetDiary(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+
+	diary, err := c.GetDiary(context.Background(), "20241014-20241020")
+	if err != nil {
+		t.Fatalf("GetDiary: %v", err)
+	}
+
+	req := srv.Requests("getdiary")[0]
+	checks := map[string]string{
+		"devkey":     eljurtest.DefaultDevKey,
+		"auth_token": eljurtest.DefaultToken,
+		"student":    eljurtest.DefaultStudentID,
+		"days":       "20241014-20241020",
+		"out_format": "json",
+	}
+	for key, want := range checks {
+		if got := req.Query.Get(key); got != want {
+			t.Errorf("query %s = %q, want %q", key, got, want)
+		}
+	}
+	if req.Cookies["school_domain"] != eljurtest.DefaultDomain {
+		t.Errorf("school_domain cookie = %q", req.Cookies["school_domain"])
+	}
+
+	students := diary.Response.Result.SortedStudents()
+	if len(students) != 1 {
+		t.Fatalf("students = %d, want 1", len(students))
+	}
+	days := students[0].SortedDays()
+	if len(days) != 2 || days[0].Date != "20241014" || days[1].Date != "20241015" {
+		t.Fatalf("unexpected days: %+v", days)
+	}
+
+	lessons := days[0].SortedLessons()
+	if len(lessons) != 2 {
+		t.Fatalf("lessons = %d, want 2", len(lessons))
+	}
+	math := lessons[0]
+	if math.Name != "Математика" || math.RingTime() != "08:00 - 08:45" {
+		t.Errorf("unexpected lesson: %q %q", math.Name, math.RingTime())
+	}
+	if hw := math.HomeworkList(); len(hw) != 1 || hw[0].Value != "№ 123, 124" || hw[0].ID != "101" {
+		t.Errorf("unexpected homework: %+v", hw)
+	}
+	if len(math.Marks) != 1 || math.Marks[0].Value != "5" {
+		t.Errorf("unexpected marks: %+v", math.Marks)
+	}
+	if len(lessons[1].HomeworkList()) != 0 {
+		t.Errorf("empty homework array parsed as %+v", lessons[1].Homework)
+	}
+
+	// Уроки вторника пришли массивом, а номер урока - числом
+	if tuesday := days[1].SortedLessons(); len(tuesday) != 1 || tuesday[0].Number != "1" {
+		t.Errorf("unexpected tuesday lessons: %+v", tuesday)
+	}
+}
+
+func TestGetDiaryEmptyResult(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+	srv.SetResult("getdiary", "[]")
+
+	diary, err := c.GetDiary(context.Background(), "20241014-20241020")
+	if err != nil {
+		t.Fatalf("GetDiary: %v", err)
+	}
+	if len(diary.Response.Result.Students) != 0 {
+		t.Errorf("students = %d, want 0", len(diary.Response.Result.Students))
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+	srv.Fail("getdiary", eljurtest.Failure{Delay: 300 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetDiary(ctx, "20241014-20241020")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetDiary() error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("GetDiary() returned after %v, want it to stop at the deadline", elapsed)
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Gzip = true
+
+	if err := c.Authenticate(context.Background(), srv.Login, srv.Password); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	messages, err := c.GetMessages(context.Background(), "inbox")
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages.Response.Result.Messages) != 2 {
+		t.Errorf("messages = %d, want 2", len(messages.Response.Result.Messages))
+	}
+}
+
+func TestStudyPeriodsCached(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+
+	for i := 0; i < 3; i++ {
+		periods, err := c.StudyPeriods(context.Background())
+		if err != nil {
+			t.Fatalf("StudyPeriods: %v", err)
+		}
+		if len(periods) != 2 {
+			t.Fatalf("periods = %d, want 2", len(periods))
+		}
+	}
+
+	if n := len(srv.Requests("getperiods")); n != 1 {
+		t.Errorf("getperiods requested %d times, want 1", n)
+	}
+
+	// Восстановленный из сессии кэш не требует запроса
+	cached, fetchedAt := c.CachedPeriods()
+	restored, srv2 := newAuthenticatedClient(t)
+	restored.RestorePeriods(cached, fetchedAt)
+	if _, err := restored.FindPeriod(context.Background(), "II"); err != nil {
+		t.Fatalf("FindPeriod: %v", err)
+	}
+	if n := len(srv2.Requests("getperiods")); n != 0 {
+		t.Errorf("restored client requested getperiods %d times", n)
+	}
+}
+
+func TestCurrentPeriod(t *testing.T) {
+	c, _ := newAuthenticatedClient(t)
+
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{now: "20240902", want: "I"},
+		{now: "20241015", want: "I"},
+		{now: "20241030", want: "I"}, // осенние каникулы
+		{now: "20241210", want: "II"},
+		{now: "20240815", want: "I"}, // год еще не начался
+		{now: "20250301", want: "II"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.now, func(t *testing.T) {
+			period, err := c.CurrentPeriod(context.Background(), date(tt.now))
+			if err != nil {
+				t.Fatalf("CurrentPeriod: %v", err)
+			}
+			if period.Name != tt.want {
+				t.Errorf("period = %q, want %q", period.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWeek(t *testing.T) {
+	c, _ := newAuthenticatedClient(t)
+
+	tests := []struct {
+		name string
+		now  string
+		want string
+	}{
+		{name: "monday", now: "20241014", want: "20241014"},
+		{name: "friday", now: "20241018", want: "20241014"},
+		{name: "saturday shows next week", now: "20241019", want: "20241021"},
+		{name: "sunday shows next week", now: "20241020", want: "20241021"},
+		{name: "vacation shows next study week", now: "20241029", want: "20241104"},
+		{name: "after year end shows last week", now: "20250610", want: "20241223"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			week, err := c.CurrentWeek(context.Background(), date(tt.now))
+			if err != nil {
+				t.Fatalf("CurrentWeek: %v", err)
+			}
+			if week.Start != tt.want {
+				t.Errorf("week start = %q, want %q", week.Start, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWeekWithoutWeeks(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+	srv.SetResult("getperiods", `{"students":[{"name":"12345","periods":[{"name":"I","start":"20240902","end":"20241027"}]}]}`)
+
+	week, err := c.CurrentWeek(context.Background(), date("20241016"))
+	if err != nil {
+		t.Fatalf("CurrentWeek: %v", err)
+	}
+	if week.Start != "20241014" || week.End != "20241020" {
+		t.Errorf("calendar week = %s, want 20241014-20241020", week.Days())
+	}
+}
+
+func TestShiftWeek(t *testing.T) {
+	c, _ := newAuthenticatedClient(t)
+	current := Week{Start: "20241014", End: "20241020"}
+
+	tests := []struct {
+		offset int
+		want   string
+		ok     bool
+	}{
+		{offset: 1, want: "20241021", ok: true},
+		{offset: -1, want: "20241007", ok: true},
+		{offset: 2, want: "20241104", ok: true},
+		{offset: 10, ok: false},
+	}
+
+	for _, tt := range tests {
+		week, ok := c.ShiftWeek(context.Background(), current, tt.offset)
+		if ok != tt.ok || week.Start != tt.want {
+			t.Errorf("ShiftWeek(%d) = %q, %v; want %q, %v", tt.offset, week.Start, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetMarks(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   string
+		start    string
+		end      string
+		wantDays string
+		wantErr  bool
+	}{
+		{name: "by period name", period: "II", wantDays: "20241104-20241229"},
+		{name: "explicit dates", start: "20241001", end: "20241015", wantDays: "20241001-20241015"},
+		{name: "unknown period", period: "IV", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newAuthenticatedClient(t)
+
+			marks, err := c.GetMarks(context.Background(), tt.period, tt.start, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMarks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if n := len(srv.Requests("getmarks")); n != 0 {
+					t.Errorf("getmarks requested %d times for invalid period", n)
+				}
+				return
+			}
+
+			if got := srv.Requests("getmarks")[0].Query.Get("days"); got != tt.wantDays {
+				t.Errorf("days = %q, want %q", got, tt.wantDays)
+			}
+			subjects := marks.Response.Result.Students[0].Subjects
+			if len(subjects) != 2 || len(subjects[0].Marks) != 2 {
+				t.Errorf("unexpected subjects: %+v", subjects)
+			}
+		})
+	}
+}
+
+func TestGetSchedule(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+
+	schedule, err := c.GetSchedule(context.Background(), "20241014-20241020", "")
+	if err != nil {
+		t.Fatalf("GetSchedule: %v", err)
+	}
+
+	req := srv.Requests("getschedule")[0]
+	if got := req.Query.Get("class"); got != eljurtest.DefaultClass {
+		t.Errorf("class = %q, want student's class %q", got, eljurtest.DefaultClass)
+	}
+	if days := schedule.Response.Result.Students[0].Days; len(days) != 2 || len(days[0].Lessons) != 2 {
+		t.Errorf("unexpected schedule: %+v", days)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+
+	inbox, err := c.GetMessages(context.Background(), "inbox")
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if got := srv.Requests("getmessages")[0].Query.Get("folder"); got != "inbox" {
+		t.Errorf("folder = %q, want inbox", got)
+	}
+	messages := inbox.Response.Result.Messages
+	if len(messages) != 2 || messages[0].ID != "502" || messages[0].Read {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	details, err := c.GetMessageDetails(context.Background(), "502")
+	if err != nil {
+		t.Fatalf("GetMessageDetails: %v", err)
+	}
+	if !strings.Contains(details.Response.Result.Message.Text, "18:00") {
+		t.Errorf("unexpected message text: %q", details.Response.Result.Message.Text)
+	}
+
+	if _, err := c.GetMessageDetails(context.Background(), "999"); err == nil {
+		t.Error("expected error for unknown message")
+	}
+
+	receivers, err := c.GetMessageReceivers(context.Background())
+	if err != nil {
+		t.Fatalf("GetMessageReceivers: %v", err)
+	}
+	if list, ok := receivers.Response.Result["receivers"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("unexpected receivers: %+v", receivers.Response.Result)
+	}
+
+	sent, err := c.SendMessage(context.Background(), []string{"t1"}, "Вопрос", "Когда контрольная?")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if !sent.Response.Result.Success {
+		t.Error("send result is not successful")
+	}
+
+	got := srv.SentMessages()
+	if len(got) != 1 || !strings.Contains(got[0].To, "t1") || got[0].Subject != "Вопрос" || got[0].Text != "Когда контрольная?" {
+		t.Errorf("unexpected sent messages: %+v", got)
+	}
+	if srv.Requests("sendmessage")[0].Query.Get("text") != "" {
+		t.Error("message text leaked into query string")
+	}
+}
+
+func TestHomework(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+
+	assignments, err := c.UpcomingHomework(context.Background(), date("20241014"))
+	if err != nil {
+		t.Fatalf("UpcomingHomework: %v", err)
+	}
+	if got := srv.Requests("getdiary")[0].Query.Get("days"); got != "20241014-20241021" {
+		t.Errorf("days = %q, want 20241014-20241021", got)
+	}
+	if len(assignments) != 2 {
+		t.Fatalf("assignments = %d, want 2", len(assignments))
+	}
+
+	first := assignments[0]
+	if first.Subject != "Математика" || first.Key() != "20241014_1_0" {
+		t.Errorf("unexpected first assignment: %+v", first)
+	}
+	if names := first.FileNames(); len(names) != 1 || names[0] != "task.pdf" {
+		t.Errorf("file names = %v", names)
+	}
+
+	found, err := c.GetAssignment(context.Background(), "20241015_1_0")
+	if err != nil {
+		t.Fatalf("GetAssignment: %v", err)
+	}
+	if found.Subject != "Физика" || found.Text != "Параграф 5, упр. 3" {
+		t.Errorf("unexpected assignment: %+v", found)
+	}
+
+	for _, key := range []string{"bad", "2024_1_0", "20241015_1_x", "20241015_9_0"} {
+		if _, err := c.GetAssignment(context.Background(), key); err == nil {
+			t.Errorf("GetAssignment(%q): expected error", key)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package eljur
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiaryResponse представляет ответ на запрос дневника
+type DiaryResponse struct {
+	Response struct {
+		State  int    `json:"state"`
+		Error  string `json:"error,omitempty"`
+		Result Diary  `json:"result,omitempty"`
+	} `json:"response"`
+}
+
+// Diary представляет содержимое дневника
+type Diary struct {
+	// Students содержит студентов, ключом является ID студента
+	Students map[string]DiaryStudent `json:"students"`
+}
+
+// DiaryStudent представляет студента в дневнике
+type DiaryStudent struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Days содержит дни, ключом является дата в формате YYYYMMDD
+	Days map[string]DiaryDay `json:"days"`
+}
+
+// DiaryDay представляет день в дневнике
+type DiaryDay struct {
+	Date        string `json:"name"`
+	Title       string `json:"title"`
+	Alert       string `json:"alert,omitempty"` // "holiday", "today", "vacation"
+	HolidayName string `json:"holiday_name,omitempty"`
+	// Lessons содержит уроки, ключом является номер урока
+	Lessons map[string]DiaryLesson `json:"items"`
+}
+
+// DiaryLesson представляет урок в дневнике
+type DiaryLesson struct {
+	Number    string              `json:"num"`
+	Name      string              `json:"name"`
+	Room      string              `json:"room"`
+	Teacher   string              `json:"teacher"`
+	Topic     string              `json:"topic,omitempty"`
+	StartTime string              `json:"starttime,omitempty"`
+	EndTime   string              `json:"endtime,omitempty"`
+	Homework  map[string]Homework `json:"homework,omitempty"`
+	Marks     []DiaryMark         `json:"assessments,omitempty"`
+	Files     []DiaryFile         `json:"files,omitempty"`
+}
+
+// Homework представляет домашнее задание к уроку
+type Homework struct {
+	ID         string      `json:"id"`
+	Value      string      `json:"value"`
+	Individual bool        `json:"individual"`
+	Files      []DiaryFile `json:"files,omitempty"`
+}
+
+// DiaryMark представляет оценку
+type DiaryMark struct {
+	Value   string `json:"value"`
+	CountAs string `json:"countas,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// DiaryFile представляет прикрепленный файл
+type DiaryFile struct {
+	FileName string `json:"filename"`
+	Link     string `json:"link"`
+}
+
+// UnmarshalJSON разбирает дневник, допуская пустой массив вместо объекта
+func (d *Diary) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*d = Diary{}
+		return nil
+	}
+
+	var raw struct {
+		Students json.RawMessage `json:"students"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	students, err := decodeMap(raw.Students, func(i int, s DiaryStudent) string {
+		if s.Name != "" {
+			return s.Name
+		}
+		return strconv.Itoa(i)
+	})
+	if err != nil {
+		return fmt.Errorf("students: %w", err)
+	}
+
+	d.Students = students
+	return nil
+}
+
+// UnmarshalJSON разбирает студента, допуская числовой ID и массив дней
+func (s *DiaryStudent) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*s = DiaryStudent{}
+		return nil
+	}
+
+	var raw struct {
+		Name  json.RawMessage `json:"name"`
+		Title json.RawMessage `json:"title"`
+		Days  json.RawMessage `json:"days"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	days, err := decodeMap(raw.Days, func(i int, d DiaryDay) string {
+		if d.Date != "" {
+			return d.Date
+		}
+		return strconv.Itoa(i)
+	})
+	if err != nil {
+		return fmt.Errorf("days: %w", err)
+	}
+
+	*s = DiaryStudent{
+		Name:  flexString(raw.Name),
+		Title: flexString(raw.Title),
+		Days:  days,
+	}
+	return nil
+}
+
+// UnmarshalJSON разбирает день, допуская массив уроков вместо объекта
+func (d *DiaryDay) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*d = DiaryDay{}
+		return nil
+	}
+
+	var raw struct {
+		Name        json.RawMessage `json:"name"`
+		Title       json.RawMessage `json:"title"`
+		Alert       json.RawMessage `json:"alert"`
+		HolidayName json.RawMessage `json:"holiday_name"`
+		Items       json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	lessons, err := decodeMap(raw.Items, func(i int, l DiaryLesson) string {
+		if l.Number != "" {
+			return l.Number
+		}
+		return strconv.Itoa(i + 1)
+	})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+
+	*d = DiaryDay{
+		Date:        flexString(raw.Name),
+		Title:       flexString(raw.Title),
+		Alert:       flexString(raw.Alert),
+		HolidayName: flexString(raw.HolidayName),
+		Lessons:     lessons,
+	}
+	return nil
+}
+
+// UnmarshalJSON разбирает урок, допуская числовые поля и массивы вместо объектов
+func (l *DiaryLesson) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*l = DiaryLesson{}
+		return nil
+	}
+
+	var raw struct {
+		Num         json.RawMessage `json:"num"`
+		Name        json.RawMessage `json:"name"`
+		Room        json.RawMessage `json:"room"`
+		Teacher     json.RawMessage `json:"teacher"`
+		Topic       json.RawMessage `json:"topic"`
+		StartTime   json.RawMessage `json:"starttime"`
+		EndTime     json.RawMessage `json:"endtime"`
+		Homework    json.RawMessage `json:"homework"`
+		Assessments json.RawMessage `json:"assessments"`
+		Files       json.RawMessage `json:"files"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	homework, err := decodeMap(raw.Homework, func(i int, h Homework) string {
+		if h.ID != "" {
+			return h.ID
+		}
+		return strconv.Itoa(i)
+	})
+	if err != nil {
+		return fmt.Errorf("homework: %w", err)
+	}
+
+	marks, err := decodeList[DiaryMark](raw.Assessments)
+	if err != nil {
+		return fmt.Errorf("assessments: %w", err)
+	}
+
+	files, err := decodeList[DiaryFile](raw.Files)
+	if err != nil {
+		return fmt.Errorf("files: %w", err)
+	}
+
+	*l = DiaryLesson{
+		Number:    flexString(raw.Num),
+		Name:      flexString(raw.Name),
+		Room:      strings.TrimSpace(flexString(raw.Room)),
+		Teacher:   flexString(raw.Teacher),
+		Topic:     flexString(raw.Topic),
+		StartTime: flexString(raw.StartTime),
+		EndTime:   flexString(raw.EndTime),
+		Homework:  homework,
+		Marks:     marks,
+		Files:     files,
+	}
+	return nil
+}
+
+// UnmarshalJSON разбирает домашнее задание, допуская числовой ID
+func (h *Homework) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*h = Homework{}
+		return nil
+	}
+
+	var raw struct {
+		ID         json.RawMessage `json:"id"`
+		Value      json.RawMessage `json:"value"`
+		Individual json.RawMessage `json:"individual"`
+		Files      json.RawMessage `json:"files"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	files, err := decodeList[DiaryFile](raw.Files)
+	if err != nil {
+		return fmt.Errorf("files: %w", err)
+	}
+
+	individual := flexString(raw.Individual)
+	*h = Homework{
+		ID:         flexString(raw.ID),
+		Value:      flexString(raw.Value),
+		Individual: individual == "true" || individual == "1",
+		Files:      files,
+	}
+	return nil
+}
+
+// UnmarshalJSON разбирает оценку, допуская числовые значения
+func (m *DiaryMark) UnmarshalJSON(data []byte) error {
+	if isEmptyJSON(data) {
+		*m = DiaryMark{}
+		return nil
+	}
+
+	var raw struct {
+		Value   json.RawMessage `json:"value"`
+		CountAs json.RawMessage `json:"countas"`
+		Type    json.RawMessage `json:"type"`
+		Comment json.RawMessage `json:"comment"`
+		Date    json.RawMessage `json:"date"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = DiaryMark{
+		Value:   flexString(raw.Value),
+		CountAs: flexString(raw.CountAs),
+		Type:    flexString(raw.Type),
+		Comment: flexString(raw.Comment),
+		Date:    flexString(raw.Date),
+	}
+	return nil
+}
+
+// SortedStudents возвращает студентов дневника, упорядоченных по ID
+func (d Diary) SortedStudents() []DiaryStudent {
+	keys := make([]string, 0, len(d.Students))
+	for key := range d.Students {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	students := make([]DiaryStudent, 0, len(keys))
+	for _, key := range keys {
+		students = append(students, d.Students[key])
+	}
+	return students
+}
+
+// SortedDays возвращает дни студента в хронологическом порядке
+func (s DiaryStudent) SortedDays() []DiaryDay {
+	keys := make([]string, 0, len(s.Days))
+	for key := range s.Days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	days := make([]DiaryDay, 0, len(keys))
+	for _, key := range keys {
+		day := s.Days[key]
+		if day.Date == "" {
+			day.Date = key
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// SortedLessons возвращает уроки дня, упорядоченные по номеру
+func (d DiaryDay) SortedLessons() []DiaryLesson {
+	keys := make([]string, 0, len(d.Lessons))
+	for key := range d.Lessons {
+		keys = append(keys, key)
+	}
+	sortNumericKeys(keys)
+
+	lessons := make([]DiaryLesson, 0, len(keys))
+	for _, key := range keys {
+		lesson := d.Lessons[key]
+		if lesson.Number == "" {
+			lesson.Number = key
+		}
+		lessons = append(lessons, lesson)
+	}
+	return lessons
+}
+
+// HasLessons проверяет, есть ли в дне уроки
+func (d DiaryDay) HasLessons() bool {
+	return len(d.Lessons) > 0
+}
+
+// HomeworkList возвращает домашние задания урока, упорядоченные по ID
+func (l DiaryLesson) HomeworkList() []Homework {
+	keys := make([]string, 0, len(l.Homework))
+	for key := range l.Homework {
+		keys = append(keys, key)
+	}
+	sortNumericKeys(keys)
+
+	list := make([]Homework, 0, len(keys))
+	for _, key := range keys {
+		if hw := l.Homework[key]; strings.TrimSpace(hw.Value) != "" || len(hw.Files) > 0 {
+			list = append(list, hw)
+		}
+	}
+	return list
+}
+
+// RingTime возвращает время урока в формате "08:00 - 08:45"
+func (l DiaryLesson) RingTime() string {
+	if l.StartTime == "" || l.EndTime == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s - %s", trimSeconds(l.StartTime), trimSeconds(l.EndTime))
+}
+
+// trimSeconds убирает секунды из времени "08:00:00"
+func trimSeconds(t string) string {
+	if len(t) == 8 && strings.Count(t, ":") == 2 {
+		return t[:5]
+	}
+	return t
+}
+
+// sortNumericKeys сортирует ключи как числа, если это возможно
+func sortNumericKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA != nil || errB != nil {
+			return keys[i] < keys[j]
+		}
+		return a < b
+	})
+}
+
+// isEmptyJSON проверяет, является ли значение пустым (null, [], {}, "", false)
+func isEmptyJSON(data []byte) bool {
+	switch string(bytes.TrimSpace(data)) {
+	case "", "null", "[]", "{}", `""`, "false":
+		return true
+	}
+	return false
+}
+
+// flexString приводит строку, число или булево значение JSON к строке
+func flexString(data json.RawMessage) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		return n.String()
+	}
+
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		return strconv.FormatBool(b)
+	}
+
+	return ""
+}
+
+// decodeMap разбирает коллекцию, которую Эльжур отдает то объектом, то массивом.
+// Для массива ключ элемента вычисляется функцией key.
+func decodeMap[T any](data json.RawMessage, key func(i int, v T) string) (map[string]T, error) {
+	if isEmptyJSON(data) {
+		return nil, nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if trimmed[0] == '[' {
+		var items []T
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		result := make(map[string]T, len(items))
+		for i, item := range items {
+			result[key(i, item)] = item
+		}
+		return result, nil
+	}
+
+	var result map[string]T
+	if err := json.Unmarshal(trimmed, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeList разбирает список, который Эльжур отдает то массивом, то объектом
+func decodeList[T any](data json.RawMessage) ([]T, error) {
+	if isEmptyJSON(data) {
+		return nil, nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if trimmed[0] == '[' {
+		var items []T
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var byKey map[string]T
+	if err := json.Unmarshal(trimmed, &byKey); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sortNumericKeys(keys)
+
+	items := make([]T, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, byKey[key])
+	}
+	return items, nil
+}
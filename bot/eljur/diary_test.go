@@ -0,0 +1,125 @@
+package eljur
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestFlexString(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`"Математика"`, "Математика"},
+		{`""`, ""},
+		{`5`, "5"},
+		{`4.5`, "4.5"},
+		{`true`, "true"},
+		{`false`, "false"},
+		{`null`, ""},
+		{``, ""},
+		{` "с пробелами" `, "с пробелами"},
+		{`{"a": 1}`, ""},
+		{`[1, 2]`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := flexString(json.RawMessage(tt.data)); got != tt.want {
+			t.Errorf("flexString(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	type item struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	// Ключ массива - ID элемента, а без ID - его индекс
+	key := func(i int, v item) string {
+		if v.ID != "" {
+			return v.ID
+		}
+		return string(rune('a' + i))
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string // ключ -> Name
+		wantErr bool
+	}{
+		{name: "object", data: `{"7": {"name": "x"}, "9": {"name": "y"}}`, want: map[string]string{"7": "x", "9": "y"}},
+		{name: "array", data: `[{"id": "7", "name": "x"}, {"id": "9", "name": "y"}]`, want: map[string]string{"7": "x", "9": "y"}},
+		{name: "array without ids", data: `[{"name": "x"}, {"name": "y"}]`, want: map[string]string{"a": "x", "b": "y"}},
+		{name: "empty array", data: `[]`, want: map[string]string{}},
+		{name: "empty object", data: `{}`, want: map[string]string{}},
+		{name: "null", data: `null`, want: map[string]string{}},
+		{name: "false", data: `false`, want: map[string]string{}},
+		{name: "invalid array", data: `[{"name": 1}]`, wantErr: true},
+		{name: "invalid object", data: `{"7": 1}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := decodeMap(json.RawMessage(tt.data), key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := make(map[string]string, len(result))
+			for k, v := range result {
+				got[k] = v.Name
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("decodeMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiaryUnmarshal(t *testing.T) {
+	// Студенты и дни пришли массивами, у дней нет даты, поля числовые
+	data := `{
+		"students": [{
+			"name": 12345,
+			"title": "Иванов Иван",
+			"days": [
+				{"name": "", "title": "Понедельник", "items": [{"num": 1, "name": "Математика"}]},
+				{"title": "Вторник", "items": {"2": {"name": "Физика", "room": " 301 "}}},
+				{"name": "20241016", "alert": "holiday", "holiday_name": "Праздник", "items": []}
+			]
+		}]
+	}`
+
+	var diary Diary
+	if err := json.Unmarshal([]byte(data), &diary); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	student, ok := diary.Students["12345"]
+	if !ok || student.Title != "Иванов Иван" {
+		t.Fatalf("students = %+v, want student 12345", diary.Students)
+	}
+
+	// Дни без даты не затирают друг друга
+	days := student.SortedDays()
+	var titles []string
+	for _, day := range days {
+		titles = append(titles, day.Title)
+	}
+	if want := []string{"Понедельник", "Вторник", ""}; !slices.Equal(titles, want) {
+		t.Fatalf("day titles = %q, want %q", titles, want)
+	}
+
+	if lessons := days[0].SortedLessons(); len(lessons) != 1 || lessons[0].Number != "1" || lessons[0].Name != "Математика" {
+		t.Errorf("monday lessons = %+v", lessons)
+	}
+	if lessons := days[1].SortedLessons(); len(lessons) != 1 || lessons[0].Number != "2" || lessons[0].Room != "301" {
+		t.Errorf("tuesday lessons = %+v", lessons)
+	}
+	if holiday := days[2]; holiday.Date != "20241016" || holiday.HolidayName != "Праздник" || holiday.HasLessons() {
+		t.Errorf("holiday = %+v", holiday)
+	}
+}
@@ -0,0 +1,385 @@
+// Package eljurtest предоставляет тестовый сервер, имитирующий API Эльжур.
+//
+// Сервер реализует авторизацию (с cookie school_domain) и основные методы API,
+// отвечает данными из встроенных фикстур и позволяет подменять ответы и внедрять ошибки:
+//
+//	srv := eljurtest.NewServer()
+//	defer srv.Close()
+//	t.Setenv("ELJUR_API_URL", srv.BaseURL())
+//	t.Setenv("ELJUR_DEV_KEY", srv.DevKey)
+//	srv.Fail("getdiary", eljurtest.Failure{Status: http.StatusInternalServerError})
+package eljurtest
+
+import (
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var fixtureFiles embed.FS
+
+// Значения по умолчанию для тестовой учетной записи
+const (
+	DefaultDevKey    = "test-devkey"
+	DefaultLogin     = "ivanov"
+	DefaultPassword  = "secret"
+	DefaultToken     = "test-token"
+	DefaultDomain    = "school1"
+	DefaultStudentID = "12345"
+	DefaultClass     = "9А"
+)
+
+// Endpoints методы API, которые реализует сервер
+var Endpoints = []string{
+	"auth",
+	"getrules",
+	"getperiods",
+	"getdiary",
+	"getmarks",
+	"getschedule",
+	"getmessages",
+	"getmessageinfo",
+	"getmessagereceivers",
+	"sendmessage",
+}
+
+// Failure описывает ошибку, которую сервер вернет вместо обычного ответа
+type Failure struct {
+	Status int           // HTTP статус (по умолчанию 200)
+	State  int           // state в теле ответа (по умолчанию равен Status, а при 200 - 400)
+	Error  string        // текст ошибки API
+	Body   string        // сырое тело ответа, заменяет JSON (например, для битого JSON)
+	Header http.Header   // дополнительные заголовки ответа (например, Retry-After)
+	Delay  time.Duration // задержка перед ответом
+	Times  int           // сколько раз вернуть ошибку (0 - всегда)
+}
+
+// Request описывает запрос, полученный сервером
+type Request struct {
+	Method   string
+	Endpoint string
+	Query    url.Values
+	Form     url.Values
+	Cookies  map[string]string
+}
+
+// SentMessage описывает сообщение, отправленное через sendmessage
+type SentMessage struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Server имитирует API Эльжур поверх httptest.Server
+type Server struct {
+	*httptest.Server
+
+	DevKey   string
+	Login    string
+	Password string
+	Token    string
+	Domain   string
+
+	// Gzip включает сжатие ответов, как у реального сервера
+	Gzip bool
+
+	mu       sync.Mutex
+	results  map[string]json.RawMessage
+	failures map[string]*Failure
+	requests []Request
+	sent     []SentMessage
+	expired  int // сколько раз истекал токен
+}
+
+// NewServer запускает тестовый сервер с фикстурами по умолчанию
+func NewServer() *Server {
+	s := &Server{
+		DevKey:   DefaultDevKey,
+		Login:    DefaultLogin,
+		Password: DefaultPassword,
+		Token:    DefaultToken,
+		Domain:   DefaultDomain,
+		results:  make(map[string]json.RawMessage),
+		failures: make(map[string]*Failure),
+	}
+
+	for _, endpoint := range Endpoints {
+		data, err := fixtureFiles.ReadFile("fixtures/" + endpoint + ".json")
+		if err == nil {
+			s.results[endpoint] = data
+		}
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// BaseURL возвращает адрес API для ELJUR_API_URL (со слешем на конце)
+func (s *Server) BaseURL() string {
+	return s.URL + "/"
+}
+
+// SetResult заменяет содержимое result для метода API. result может быть
+// строкой или []byte с готовым JSON, либо любым значением для json.Marshal.
+func (s *Server) SetResult(endpoint string, result interface{}) {
+	var data []byte
+	switch v := result.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			panic(fmt.Sprintf("eljurtest: marshal %s result: %v", endpoint, err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[endpoint] = data
+}
+
+// Fail заставляет метод API возвращать ошибку
+func (s *Server) Fail(endpoint string, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = &failure
+}
+
+// ExpireToken делает выданный токен недействительным, как при истечении сессии:
+// запросы с ним получают 401, а следующая авторизация выдает новый токен
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expired++
+	s.Token = fmt.Sprintf("%s-%d", DefaultToken, s.expired)
+}
+
+// Recover отменяет внедренные ошибки для всех методов
+func (s *Server) Recover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = make(map[string]*Failure)
+}
+
+// Requests возвращает запросы к методу API (все запросы, если endpoint пустой)
+func (s *Server) Requests(endpoint string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []Request
+	for _, r := range s.requests {
+		if endpoint == "" || r.Endpoint == endpoint {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// SentMessages возвращает сообщения, отправленные через sendmessage
+func (s *Server) SentMessages() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentMessage(nil), s.sent...)
+}
+
+// handle обрабатывает запрос к API
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.Trim(r.URL.Path, "/")
+	r.ParseForm()
+
+	req := Request{
+		Method:   r.Method,
+		Endpoint: endpoint,
+		Query:    r.URL.Query(),
+		Form:     r.PostForm,
+		Cookies:  make(map[string]string),
+	}
+	for _, cookie := range r.Cookies() {
+		req.Cookies[cookie.Name] = cookie.Value
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	result, known := s.results[endpoint]
+	failure := s.takeFailure(endpoint)
+	token := s.Token
+	s.mu.Unlock()
+
+	if failure != nil {
+		s.writeFailure(w, failure)
+		return
+	}
+
+	switch {
+	case !known && endpoint != "auth":
+		s.writeError(w, http.StatusNotFound, 404, "Unknown method")
+	case req.Query.Get("devkey") != s.DevKey:
+		s.writeError(w, http.StatusForbidden, 403, "Invalid devkey")
+	case endpoint == "auth":
+		s.handleAuth(w, req, token)
+	case req.Query.Get("auth_token") != token || req.Cookies["school_domain"] != s.Domain:
+		s.writeError(w, http.StatusUnauthorized, 401, "Auth token is invalid")
+	case r.Method != http.MethodGet && endpoint != "sendmessage":
+		s.writeError(w, http.StatusMethodNotAllowed, 405, "Method not allowed")
+	case endpoint == "getmessageinfo" && !s.hasMessage(req.Query.Get("id")):
+		s.writeError(w, http.StatusOK, 404, "Message not found")
+	case endpoint == "sendmessage":
+		s.mu.Lock()
+		s.sent = append(s.sent, SentMessage{
+			To:      req.Form.Get("users_to"),
+			Subject: req.Form.Get("subject"),
+			Text:    req.Form.Get("text"),
+		})
+		s.mu.Unlock()
+		s.writeResult(w, result)
+	default:
+		s.writeResult(w, result)
+	}
+}
+
+// handleAuth проверяет логин и пароль, выдает токен и cookie school_domain
+func (s *Server) handleAuth(w http.ResponseWriter, req Request, token string) {
+	if req.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, 405, "Method not allowed")
+		return
+	}
+	if req.Form.Get("login") != s.Login || req.Form.Get("password") != s.Password {
+		s.writeError(w, http.StatusBadRequest, 400, "Неверный логин или пароль")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "school_domain", Value: s.Domain, Path: "/"})
+	result, _ := json.Marshal(map[string]string{
+		"token":   token,
+		"expires": time.Now().Add(30 * 24 * time.Hour).Format("2006-01-02 15:04:05"),
+	})
+	s.writeResult(w, result)
+}
+
+// hasMessage проверяет, есть ли сообщение с указанным ID в фикстуре getmessageinfo или getmessages
+func (s *Server) hasMessage(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var info struct {
+		Message struct {
+			ID string `json:"id"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(s.results["getmessageinfo"], &info) == nil && info.Message.ID == id {
+		return true
+	}
+
+	var list struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(s.results["getmessages"], &list)
+	for _, message := range list.Messages {
+		if message.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// takeFailure возвращает внедренную ошибку для метода и уменьшает ее счетчик.
+// Вызывается под s.mu.
+func (s *Server) takeFailure(endpoint string) *Failure {
+	failure, ok := s.failures[endpoint]
+	if !ok {
+		return nil
+	}
+
+	current := *failure
+	if failure.Times > 0 {
+		failure.Times--
+		if failure.Times == 0 {
+			delete(s.failures, endpoint)
+		}
+	}
+	return &current
+}
+
+// writeFailure отправляет внедренную ошибку
+func (s *Server) writeFailure(w http.ResponseWriter, failure *Failure) {
+	if failure.Delay > 0 {
+		time.Sleep(failure.Delay)
+	}
+	for key, values := range failure.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	status := failure.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if failure.Body != "" {
+		s.write(w, status, []byte(failure.Body))
+		return
+	}
+
+	state := failure.State
+	if state == 0 {
+		state = status
+		if state == http.StatusOK {
+			state = http.StatusBadRequest
+		}
+	}
+	s.writeError(w, status, state, failure.Error)
+}
+
+// writeResult отправляет успешный ответ с result
+func (s *Server) writeResult(w http.ResponseWriter, result json.RawMessage) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"response": map[string]interface{}{
+			"state":  200,
+			"error":  nil,
+			"result": result,
+		},
+	})
+	s.write(w, http.StatusOK, body)
+}
+
+// writeError отправляет ошибку в формате API Эльжур
+func (s *Server) writeError(w http.ResponseWriter, status, state int, message string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"response": map[string]interface{}{
+			"state":  state,
+			"error":  message,
+			"result": nil,
+		},
+	})
+	s.write(w, status, body)
+}
+
+// write отправляет тело ответа, при необходимости сжимая его gzip
+func (s *Server) write(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.Gzip {
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+	gz := gzip.NewWriter(w)
+	gz.Write(body)
+	gz.Close()
+}
@@ -0,0 +1,127 @@
+package eljur
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// Ошибки клиента Эльжур. Проверяются через errors.Is; подробности ответа сервера
+// (метод, HTTP статус, state и текст ошибки) доступны через errors.As с *APIError.
+var (
+	// ErrUnauthorized токен недействителен или истек, нужна повторная авторизация
+	ErrUnauthorized = errors.New("пользователь не авторизован")
+	// ErrInvalidCredentials сервер отклонил логин или пароль
+	ErrInvalidCredentials = errors.New("неверный логин или пароль")
+	// ErrForbidden нет доступа к запрошенным данным
+	ErrForbidden = errors.New("доступ запрещен")
+	// ErrNotFound запрошенные данные не найдены
+	ErrNotFound = errors.New("данные не найдены")
+	// ErrRateLimited сервер ограничил частоту запросов
+	ErrRateLimited = errors.New("слишком много запросов к серверу школы")
+	// ErrServerError сервер ответил внутренней ошибкой (5xx)
+	ErrServerError = errors.New("ошибка сервера школы")
+	// ErrMalformedResponse ответ сервера не удалось разобрать
+	ErrMalformedResponse = errors.New("некорректный ответ сервера школы")
+	// ErrTimeout сервер не ответил до дедлайна контекста или таймаута HTTP клиента
+	ErrTimeout = errors.New("сервер школы не ответил вовремя")
+)
+
+// APIError ошибка, которую вернул сервер Эльжур
+type APIError struct {
+	Endpoint string // метод API
+	Status   int    // HTTP статус ответа
+	State    int    // state из тела ответа, 0 - если тело не удалось разобрать
+	Message  string // текст ошибки от сервера
+	Kind     error  // одна из ошибок Err*, nil - если ошибка не классифицирована
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	switch {
+	case message == "" && e.Kind != nil:
+		message = e.Kind.Error()
+	case message == "":
+		message = fmt.Sprintf("HTTP %d", e.Status)
+	}
+	if e.State != 0 {
+		return fmt.Sprintf("ошибка API %s (state %d): %s", e.Endpoint, e.State, message)
+	}
+	return fmt.Sprintf("ошибка API %s: %s", e.Endpoint, message)
+}
+
+// Unwrap позволяет проверять вид ошибки через errors.Is(err, ErrUnauthorized) и т.д.
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// newAPIError создает ошибку ответа и определяет ее вид по state (а для 5xx и 429 -
+// по HTTP статусу). Ошибки метода auth означают неверные учетные данные.
+func newAPIError(endpoint string, status, state int, message string) *APIError {
+	code := state
+	if code == 0 || code == http.StatusOK || status >= 500 || status == http.StatusTooManyRequests {
+		code = status
+	}
+
+	var kind error
+	switch {
+	case code >= 500:
+		kind = ErrServerError
+	case code == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case endpoint == "auth" && code >= 400:
+		kind = ErrInvalidCredentials
+	case code == http.StatusUnauthorized:
+		kind = ErrUnauthorized
+	case code == http.StatusForbidden:
+		kind = ErrForbidden
+	case code == http.StatusNotFound:
+		kind = ErrNotFound
+	}
+
+	return &APIError{Endpoint: endpoint, Status: status, State: state, Message: message, Kind: kind}
+}
+
+// responseError читает тело неуспешного ответа и создает ошибку с state и текстом сервера
+func (c *Client) responseError(endpoint string, resp *http.Response) error {
+	body, err := c.readResponseBody(resp)
+	if err != nil {
+		return newAPIError(endpoint, resp.StatusCode, 0, "")
+	}
+	slog.Warn("[RESPONSE] Ошибка ответа", "endpoint", endpoint, "status", resp.StatusCode, "body", string(body))
+
+	return bodyError(endpoint, resp.StatusCode, body)
+}
+
+// bodyError определяет ошибку по HTTP статусу и state в теле ответа.
+// Для успешного ответа (статус 200 и state 200 или без state) возвращает nil.
+func bodyError(endpoint string, status int, body []byte) error {
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		resp = Response{}
+	}
+
+	state := resp.Response.State
+	if status == http.StatusOK && (state == 0 || state == http.StatusOK) {
+		return nil
+	}
+	return newAPIError(endpoint, status, state, resp.Response.Error)
+}
+
+// malformedError описывает ответ, который не удалось разобрать
+func malformedError(endpoint string, err error) error {
+	return &APIError{Endpoint: endpoint, Status: http.StatusOK, Message: err.Error(), Kind: ErrMalformedResponse}
+}
+
+// timeoutError помечает ошибки истечения времени как ErrTimeout, сохраняя исходную ошибку
+func timeoutError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package eljur
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// homeworkLookahead на сколько дней вперед искать домашние задания
+const homeworkLookahead = 7
+
+// Assignment представляет домашнее задание вместе с уроком, к которому оно задано
+type Assignment struct {
+	Date    string // дата урока в формате YYYYMMDD (срок сдачи)
+	Lesson  string // номер урока
+	Index   int    // порядковый номер задания в уроке
+	Subject string
+	Text    string
+	Files   []DiaryFile
+}
+
+// Key возвращает короткий идентификатор задания вида "YYYYMMDD_<урок>_<номер>"
+func (a Assignment) Key() string {
+	return fmt.Sprintf("%s_%s_%d", a.Date, a.Lesson, a.Index)
+}
+
+// FileNames возвращает имена прикрепленных к заданию файлов
+func (a Assignment) FileNames() []string {
+	names := make([]string, 0, len(a.Files))
+	for _, file := range a.Files {
+		if file.FileName != "" {
+			names = append(names, file.FileName)
+		}
+	}
+	return names
+}
+
+// Assignments возвращает все домашние задания дневника в хронологическом порядке
+func (d Diary) Assignments() []Assignment {
+	var assignments []Assignment
+	for _, student := range d.SortedStudents() {
+		for _, day := range student.SortedDays() {
+			for _, lesson := range day.SortedLessons() {
+				for i, hw := range lesson.HomeworkList() {
+					assignments = append(assignments, Assignment{
+						Date:    day.Date,
+						Lesson:  lesson.Number,
+						Index:   i,
+						Subject: lesson.Name,
+						Text:    strings.TrimSpace(hw.Value),
+						Files:   hw.Files,
+					})
+				}
+			}
+		}
+	}
+	return assignments
+}
+
+// UpcomingHomework возвращает домашние задания на ближайшие дни начиная с now
+func (c *Client) UpcomingHomework(ctx context.Context, now time.Time) ([]Assignment, error) {
+	days := fmt.Sprintf("%s-%s", now.Format(dateLayout), now.AddDate(0, 0, homeworkLookahead).Format(dateLayout))
+
+	diary, err := c.GetDiary(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	return diary.Response.Result.Assignments(), nil
+}
+
+// GetAssignment находит домашнее задание по ключу, полученному из Assignment.Key
+func (c *Client) GetAssignment(ctx context.Context, key string) (*Assignment, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("некорректный ключ задания: %s", key)
+	}
+
+	date := parts[0]
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return nil, fmt.Errorf("некорректная дата задания: %s", date)
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("некорректный номер задания: %s", parts[2])
+	}
+
+	diary, err := c.GetDiary(ctx, fmt.Sprintf("%s-%s", date, date))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, assignment := range diary.Response.Result.Assignments() {
+		if assignment.Date == date && assignment.Lesson == parts[1] && assignment.Index == index {
+			return &assignment, nil
+		}
+	}
+	return nil, fmt.Errorf("задание не найдено")
+}
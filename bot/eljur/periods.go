@@ -0,0 +1,283 @@
+package eljur
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// dateLayout формат дат, используемый API Эльжур
+const dateLayout = "20060102"
+
+// periodsCacheTTL время, в течение которого кэш периодов считается актуальным
+const periodsCacheTTL = 12 * time.Hour
+
+// Contains проверяет, попадает ли дата в период (включительно)
+func (p Period) Contains(t time.Time) bool {
+	day := t.Format(dateLayout)
+	return p.Start <= day && day <= p.End
+}
+
+// Title возвращает название периода для отображения
+func (p Period) Title() string {
+	if p.FullName != "" {
+		return p.FullName
+	}
+	return p.Name
+}
+
+// Days возвращает диапазон периода в формате API "YYYYMMDD-YYYYMMDD"
+func (p Period) Days() string {
+	return fmt.Sprintf("%s-%s", p.Start, p.End)
+}
+
+// StudyPeriods возвращает учебные периоды студента (четверти, триместры, полугодия).
+// Результат кэшируется в клиенте и может быть сохранен в сессии через CachedPeriods.
+func (c *Client) StudyPeriods(ctx context.Context) ([]Period, error) {
+	if len(c.periods) > 0 && time.Since(c.periodsFetchedAt) < periodsCacheTTL {
+		return c.periods, nil
+	}
+
+	periods, err := c.fetchPeriods(ctx, c.studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.periods = periods
+	c.periodsFetchedAt = time.Now()
+	return periods, nil
+}
+
+// fetchPeriods запрашивает учебные периоды студента без использования кэша
+func (c *Client) fetchPeriods(ctx context.Context, studentID string) ([]Period, error) {
+	periodsResp, err := c.getPeriods(ctx, studentID, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	students := periodsResp.Response.Result.Students
+	if len(students) == 0 {
+		return nil, fmt.Errorf("не найдены данные о студенте")
+	}
+
+	// Периоды выбранного студента; если сервер не указал студентов, берем первого
+	current := 0
+	for i, student := range students {
+		if fmt.Sprintf("%v", student.Name) == studentID {
+			current = i
+			break
+		}
+	}
+
+	var periods []Period
+	for _, period := range students[current].Periods {
+		if period.Start == "" || period.End == "" {
+			continue
+		}
+		periods = append(periods, period)
+	}
+
+	if len(periods) == 0 {
+		return nil, fmt.Errorf("не найдены учебные периоды")
+	}
+
+	slog.Debug("[PERIODS] Получены учебные периоды", "student_id", studentID, "count", len(periods))
+	return periods, nil
+}
+
+// CachedPeriods возвращает закэшированные периоды и время их получения (для session management)
+func (c *Client) CachedPeriods() ([]Period, time.Time) {
+	return c.periods, c.periodsFetchedAt
+}
+
+// RestorePeriods восстанавливает кэш периодов из сессии
+func (c *Client) RestorePeriods(periods []Period, fetchedAt time.Time) {
+	c.periods = periods
+	c.periodsFetchedAt = fetchedAt
+}
+
+// FindPeriod ищет учебный период по его названию
+func (c *Client) FindPeriod(ctx context.Context, name string) (*Period, error) {
+	periods, err := c.StudyPeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range periods {
+		if periods[i].Name == name {
+			return &periods[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("период %q не найден", name)
+}
+
+// CurrentPeriod возвращает период, в который попадает указанная дата.
+// Во время каникул возвращается последний начавшийся период.
+func (c *Client) CurrentPeriod(ctx context.Context, now time.Time) (*Period, error) {
+	periods, err := c.StudyPeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return currentPeriod(periods, now), nil
+}
+
+// StudentCurrentPeriod возвращает текущий период указанного студента. Периоды
+// выбранного студента берутся из кэша, остальных детей родителя - запрашиваются,
+// так как у разных классов четверти могут не совпадать.
+func (c *Client) StudentCurrentPeriod(ctx context.Context, studentID string, now time.Time) (*Period, error) {
+	if studentID == c.studentID {
+		return c.CurrentPeriod(ctx, now)
+	}
+
+	periods, err := c.fetchPeriods(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return currentPeriod(periods, now), nil
+}
+
+// currentPeriod выбирает из непустого списка период, в который попадает дата
+func currentPeriod(periods []Period, now time.Time) *Period {
+	today := now.Format(dateLayout)
+	var latest *Period
+
+	for i := range periods {
+		if periods[i].Contains(now) {
+			return &periods[i]
+		}
+		if periods[i].Start <= today && (latest == nil || periods[i].Start > latest.Start) {
+			latest = &periods[i]
+		}
+	}
+
+	if latest != nil {
+		return latest
+	}
+
+	// Учебный год еще не начался - берем первый период
+	return &periods[0]
+}
+
+// YearRange возвращает границы учебного года по всем периодам
+func (c *Client) YearRange(ctx context.Context) (string, string, error) {
+	periods, err := c.StudyPeriods(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	start, end := periods[0].Start, periods[0].End
+	for _, period := range periods[1:] {
+		if period.Start < start {
+			start = period.Start
+		}
+		if period.End > end {
+			end = period.End
+		}
+	}
+
+	return start, end, nil
+}
+
+// Days возвращает диапазон недели в формате API "YYYYMMDD-YYYYMMDD"
+func (w Week) Days() string {
+	return fmt.Sprintf("%s-%s", w.Start, w.End)
+}
+
+// StudyWeeks возвращает все учебные недели года в хронологическом порядке
+func (c *Client) StudyWeeks(ctx context.Context) ([]Week, error) {
+	periods, err := c.StudyPeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var weeks []Week
+	for _, period := range periods {
+		for _, week := range period.Weeks {
+			if week.Start == "" || week.End == "" || seen[week.Start] {
+				continue
+			}
+			seen[week.Start] = true
+			weeks = append(weeks, week)
+		}
+	}
+
+	sort.Slice(weeks, func(i, j int) bool {
+		return weeks[i].Start < weeks[j].Start
+	})
+
+	return weeks, nil
+}
+
+// CurrentWeek возвращает учебную неделю для указанной даты.
+// В выходные возвращается следующая неделя, в каникулы - ближайшая учебная.
+func (c *Client) CurrentWeek(ctx context.Context, now time.Time) (Week, error) {
+	target := now
+	switch now.Weekday() {
+	case time.Saturday:
+		target = now.AddDate(0, 0, 2)
+	case time.Sunday:
+		target = now.AddDate(0, 0, 1)
+	}
+
+	weeks, err := c.StudyWeeks(ctx)
+	if err != nil {
+		return Week{}, err
+	}
+	if len(weeks) == 0 {
+		// Без данных о неделях используем календарную неделю
+		return calendarWeek(target), nil
+	}
+
+	day := target.Format(dateLayout)
+	for _, week := range weeks {
+		if week.Start <= day && day <= week.End {
+			return week, nil
+		}
+		if week.Start > day {
+			return week, nil
+		}
+	}
+
+	// Учебный год закончился - показываем последнюю неделю
+	return weeks[len(weeks)-1], nil
+}
+
+// ShiftWeek возвращает неделю, отстоящую от указанной на offset недель.
+// Второе значение false, если такой недели нет в учебном году.
+func (c *Client) ShiftWeek(ctx context.Context, week Week, offset int) (Week, bool) {
+	weeks, err := c.StudyWeeks(ctx)
+	if err == nil {
+		for i := range weeks {
+			if weeks[i].Start != week.Start {
+				continue
+			}
+			j := i + offset
+			if j < 0 || j >= len(weeks) {
+				return Week{}, false
+			}
+			return weeks[j], true
+		}
+	}
+
+	// Неделя не из getperiods - сдвигаем по календарю
+	start, err := time.ParseInLocation(dateLayout, week.Start, time.Local)
+	if err != nil {
+		return Week{}, false
+	}
+	return calendarWeek(start.AddDate(0, 0, 7*offset)), true
+}
+
+// calendarWeek возвращает календарную неделю (понедельник - воскресенье) для даты
+func calendarWeek(t time.Time) Week {
+	offset := (int(t.Weekday()) + 6) % 7
+	monday := t.AddDate(0, 0, -offset)
+	sunday := monday.AddDate(0, 0, 6)
+	return Week{
+		Start: monday.Format(dateLayout),
+		End:   sunday.Format(dateLayout),
+	}
+}
@@ -0,0 +1,259 @@
+package eljur
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold сколько сбоев подряд открывает автомат защиты сервера
+	breakerThreshold = 5
+	// breakerCooldown сколько запросы к серверу не выполняются после открытия автомата
+	breakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen возвращается без обращения к серверу, пока автомат защиты открыт
+// после серии сбоев. Подробности (когда повторить) содержит CircuitOpenError.
+var ErrCircuitOpen = errors.New("сервер школы временно недоступен")
+
+// CircuitOpenError сообщает, что сервер школы недоступен и когда будет следующая попытка
+type CircuitOpenError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v (%s), повторная попытка после %s", ErrCircuitOpen, e.Host, e.RetryAt.Format("15:04:05"))
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrCircuitOpen)
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Unavailable сообщает, что запрос не выполнен из-за состояния сервера школы
+// (не ответил вовремя, вернул 5xx или отключен автоматом защиты), а не из-за
+// данных пользователя
+func Unavailable(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrServerError) || errors.Is(err, ErrCircuitOpen)
+}
+
+// retryPolicy описывает повтор запросов при временных сбоях сервера
+type retryPolicy struct {
+	attempts      int           // всего попыток для идемпотентных запросов
+	baseDelay     time.Duration // задержка перед второй попыткой, дальше удваивается
+	maxDelay      time.Duration // верхняя граница задержки между попытками
+	maxRetryAfter time.Duration // Retry-After дольше этого не ждем, а сразу возвращаем ответ
+}
+
+var defaultRetryPolicy = retryPolicy{
+	attempts:      3,
+	baseDelay:     200 * time.Millisecond,
+	maxDelay:      2 * time.Second,
+	maxRetryAfter: 5 * time.Second,
+}
+
+// retryableEndpoints методы, которые только читают данные, поэтому их безопасно повторять
+var retryableEndpoints = map[string]bool{
+	"getdiary":    true,
+	"getmarks":    true,
+	"getperiods":  true,
+	"getschedule": true,
+	"getmessages": true,
+}
+
+// delay возвращает паузу перед следующей попыткой: Retry-After сервера или
+// экспоненциальную задержку со случайным разбросом. false - ждать не стоит.
+func (p retryPolicy) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return wait, wait <= p.maxRetryAfter
+		}
+	}
+
+	backoff := p.baseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > p.maxDelay {
+		backoff = p.maxDelay
+	}
+	half := backoff / 2
+	return half + rand.N(half+1), true
+}
+
+// parseRetryAfter разбирает заголовок Retry-After в секундах или в виде HTTP даты
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// shouldRetry проверяет, может ли повтор запроса дать другой результат
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do выполняет запрос с учетом автомата защиты сервера и повторяет идемпотентные
+// GET запросы при сетевых ошибках, 5xx и 429, пока позволяет дедлайн ctx
+func (c *Client) do(ctx context.Context, method, endpoint string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	host := baseHost()
+	breaker := breakerFor(host)
+
+	attempts := 1
+	if method == "GET" && retryableEndpoints[endpoint] {
+		attempts = max(c.retry.attempts, 1)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if retryAt, ok := breaker.allow(time.Now()); !ok {
+			return nil, &CircuitOpenError{Host: host, RetryAt: retryAt}
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		// Отмена запроса вызывающим ничего не говорит о сервере
+		if !errors.Is(err, context.Canceled) {
+			breaker.record(err != nil || resp.StatusCode >= 500, time.Now())
+		}
+
+		if attempt < attempts && ctx.Err() == nil && shouldRetry(resp, err) {
+			wait, ok := c.retry.delay(attempt, resp)
+			if deadline, has := ctx.Deadline(); has && time.Now().Add(wait).After(deadline) {
+				ok = false
+			}
+			if ok {
+				slog.Info("[RETRY] Повтор запроса", "endpoint", endpoint, "attempt", attempt+1, "attempts", attempts, "wait", wait)
+				if resp != nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				if err := sleepContext(ctx, wait); err != nil {
+					return nil, timeoutError(err)
+				}
+				continue
+			}
+		}
+
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		return resp, nil
+	}
+}
+
+// sleepContext ждет указанное время или до отмены ctx
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// baseHost возвращает хост API, для которого ведется учет сбоев
+func baseHost() string {
+	if u, err := url.Parse(getBaseURL()); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return getBaseURL()
+}
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // запросы выполняются
+	breakerOpen                         // запросы отклоняются до конца паузы
+	breakerHalfOpen                     // выполняется пробный запрос
+)
+
+// circuitBreaker автомат защиты сервера: после серии сбоев перестает отправлять
+// запросы на breakerCooldown, затем пропускает один пробный запрос
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // сбоев подряд
+	openedAt time.Time // время открытия автомата
+	probeAt  time.Time // время начала пробного запроса
+}
+
+// breakers автоматы по хостам; общие для всех клиентов процесса, так как
+// каждый пользователь работает со своим экземпляром Client
+var breakers sync.Map // host -> *circuitBreaker
+
+// breakerFor возвращает автомат защиты для хоста
+func breakerFor(host string) *circuitBreaker {
+	breaker, _ := breakers.LoadOrStore(host, &circuitBreaker{})
+	return breaker.(*circuitBreaker)
+}
+
+// allow проверяет, можно ли выполнить запрос. Если нельзя, возвращает время,
+// после которого стоит попробовать снова.
+func (b *circuitBreaker) allow(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if retryAt := b.openedAt.Add(breakerCooldown); now.Before(retryAt) {
+			return retryAt, false
+		}
+		b.state, b.probeAt = breakerHalfOpen, now
+	case breakerHalfOpen:
+		// Пробный запрос уже выполняется; если он потерялся, разрешаем новый
+		if retryAt := b.probeAt.Add(breakerCooldown); now.Before(retryAt) {
+			return retryAt, false
+		}
+		b.probeAt = now
+	}
+	return time.Time{}, true
+}
+
+// record учитывает результат запроса
+func (b *circuitBreaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		if b.state != breakerClosed {
+			slog.Info("[BREAKER] Сервер школы снова отвечает, автомат закрыт")
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= breakerThreshold) {
+		slog.Warn("[BREAKER] Сервер школы недоступен, запросы приостановлены", "failures", b.failures, "cooldown", breakerCooldown)
+		b.state, b.openedAt = breakerOpen, now
+	}
+}
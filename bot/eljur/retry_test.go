@@ -0,0 +1,178 @@
+package eljur
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		endpoint     string
+		call         func(c *Client) error
+		failure      eljurtest.Failure
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:     "transient 503",
+			endpoint: "getdiary",
+			call:     func(c *Client) error { _, err := c.GetDiary(context.Background(), "20241014-20241020"); return err },
+			failure:  eljurtest.Failure{Status: http.StatusServiceUnavailable, Times: 2},
+			// Третья попытка успешна
+			wantRequests: 3,
+		},
+		{
+			name:     "persistent 500",
+			endpoint: "getmarks",
+			call: func(c *Client) error {
+				_, err := c.GetMarks(context.Background(), "", "20241001", "20241031")
+				return err
+			},
+			failure:      eljurtest.Failure{Status: http.StatusInternalServerError},
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:     "client error is not retried",
+			endpoint: "getschedule",
+			call: func(c *Client) error {
+				_, err := c.GetSchedule(context.Background(), "20241014-20241020", "")
+				return err
+			},
+			failure:      eljurtest.Failure{Status: http.StatusBadRequest, Error: "Ошибка параметров"},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:     "retry after",
+			endpoint: "getmessages",
+			call:     func(c *Client) error { _, err := c.GetMessages(context.Background(), "inbox"); return err },
+			failure: eljurtest.Failure{Status: http.StatusTooManyRequests, Times: 1,
+				Header: http.Header{"Retry-After": {"0"}}},
+			wantRequests: 2,
+		},
+		{
+			name:     "retry after beyond limit",
+			endpoint: "getmessages",
+			call:     func(c *Client) error { _, err := c.GetMessages(context.Background(), "inbox"); return err },
+			failure: eljurtest.Failure{Status: http.StatusTooManyRequests,
+				Header: http.Header{"Retry-After": {"120"}}},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:     "writes are not retried",
+			endpoint: "sendmessage",
+			call: func(c *Client) error {
+				_, err := c.SendMessage(context.Background(), []string{"t1"}, "s", "t")
+				return err
+			},
+			failure:      eljurtest.Failure{Status: http.StatusServiceUnavailable, Times: 1},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newAuthenticatedClient(t)
+			srv.Fail(tt.endpoint, tt.failure)
+
+			err := tt.call(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(srv.Requests(tt.endpoint)); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := defaultRetryPolicy
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		wait, ok := policy.delay(attempt, nil)
+		backoff := min(policy.baseDelay<<(attempt-1), policy.maxDelay)
+		if !ok || wait < backoff/2 || wait > backoff {
+			t.Errorf("delay(%d) = %v, %v, want within [%v, %v]", attempt, wait, ok, backoff/2, backoff)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if wait, ok := policy.delay(1, resp); !ok || wait != 3*time.Second {
+		t.Errorf("delay with Retry-After: 3 = %v, %v, want 3s", wait, ok)
+	}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if _, ok := policy.delay(1, resp); ok {
+		t.Error("delay with Retry-After in an hour is accepted")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	c, srv := newAuthenticatedClient(t)
+	c.retry.attempts = 1
+	srv.Fail("getdiary", eljurtest.Failure{Status: http.StatusBadGateway})
+
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := c.GetDiary(context.Background(), "20241014-20241020"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("circuit opened after %d failures, want %d", i, breakerThreshold)
+		}
+	}
+
+	// Автомат открыт: запросы к любым методам сервера не выполняются
+	requests := len(srv.Requests(""))
+	_, err := c.GetMessages(context.Background(), "inbox")
+	var outage *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &outage) || outage.RetryAt.IsZero() {
+		t.Fatalf("GetMessages() error = %v, want CircuitOpenError", err)
+	}
+	if !Unavailable(err) {
+		t.Error("Unavailable(circuit open) = false")
+	}
+	if got := len(srv.Requests("")); got != requests {
+		t.Errorf("open circuit made %d requests", got-requests)
+	}
+
+	// После паузы пробный запрос закрывает автомат
+	srv.Recover()
+	breaker := breakerFor(baseHost())
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-breakerCooldown)
+	breaker.mu.Unlock()
+
+	if _, err := c.GetDiary(context.Background(), "20241014-20241020"); err != nil {
+		t.Fatalf("probe request error = %v", err)
+	}
+	if _, err := c.GetMessages(context.Background(), "inbox"); err != nil {
+		t.Errorf("request after recovery error = %v", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breaker := &circuitBreaker{}
+	now := time.Now()
+	for i := 0; i < breakerThreshold; i++ {
+		breaker.record(true, now)
+	}
+
+	if _, ok := breaker.allow(now.Add(breakerCooldown)); !ok {
+		t.Fatal("probe request rejected after cooldown")
+	}
+	if _, ok := breaker.allow(now.Add(breakerCooldown)); ok {
+		t.Error("second request allowed while probe is in flight")
+	}
+
+	// Неудачный пробный запрос снова открывает автомат
+	breaker.record(true, now.Add(breakerCooldown))
+	if retryAt, ok := breaker.allow(now.Add(breakerCooldown + time.Second)); ok || !retryAt.Equal(now.Add(2*breakerCooldown)) {
+		t.Errorf("allow() after failed probe = %v, %v", retryAt, ok)
+	}
+}
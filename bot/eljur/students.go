@@ -0,0 +1,104 @@
+package eljur
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Student представляет студента, к данным которого есть доступ у пользователя.
+// У ученика это он сам, у родителя - все его дети в школе.
+type Student struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+// Label возвращает имя студента с классом для отображения
+func (s Student) Label() string {
+	switch {
+	case s.Name == "":
+		return s.ID
+	case s.Class == "":
+		return s.Name
+	default:
+		return fmt.Sprintf("%s, %s", s.Name, s.Class)
+	}
+}
+
+// Students возвращает всех студентов, доступных пользователю, в порядке имен
+func (c *Client) Students() []Student {
+	return append([]Student(nil), c.students...)
+}
+
+// ActiveStudent возвращает студента, данные которого запрашивают методы клиента
+func (c *Client) ActiveStudent() Student {
+	for _, student := range c.students {
+		if student.ID == c.studentID {
+			return student
+		}
+	}
+	return Student{ID: c.studentID, Class: c.studentClass}
+}
+
+// SetStudent выбирает студента для дневника, расписания и оценок.
+// Кэш периодов сбрасывается, так как периоды могут отличаться у разных классов.
+// До получения списка студентов (перед RestoreSession) выбор только запоминается:
+// getrules оставит его, если студент все еще доступен.
+func (c *Client) SetStudent(id string) error {
+	if c.students == nil {
+		c.studentID = id
+		return nil
+	}
+	for _, student := range c.students {
+		if student.ID != id {
+			continue
+		}
+		if c.studentID != id {
+			c.periods, c.periodsFetchedAt = nil, time.Time{}
+		}
+		c.studentID, c.studentClass = student.ID, student.Class
+		return nil
+	}
+	return fmt.Errorf("студент %s не найден", id)
+}
+
+// Student возвращает оценки студента с указанным ID (nil, если его нет в ответе).
+// Если сервер не указал ID студентов, возвращается первый.
+func (r *MarksResponse) Student(id string) *MarksStudent {
+	students := r.Response.Result.Students
+	for i := range students {
+		if fmt.Sprintf("%v", students[i].Name) == id {
+			return &students[i]
+		}
+	}
+	if len(students) > 0 && students[0].Name == nil {
+		return &students[0]
+	}
+	return nil
+}
+
+// Student возвращает расписание студента с указанным ID (nil, если его нет в ответе).
+// Если сервер не указал ID студентов, возвращается первый.
+func (r *ScheduleResponse) Student(id string) *ScheduleStudent {
+	students := r.Response.Result.Students
+	for i := range students {
+		if fmt.Sprintf("%v", students[i].Name) == id {
+			return &students[i]
+		}
+	}
+	if len(students) > 0 && students[0].Name == nil {
+		return &students[0]
+	}
+	return nil
+}
+
+// sortStudents упорядочивает студентов по имени, затем по ID
+func sortStudents(students []Student) {
+	sort.Slice(students, func(i, j int) bool {
+		if students[i].Name != students[j].Name {
+			return students[i].Name < students[j].Name
+		}
+		return students[i].ID < students[j].ID
+	})
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"school-diary-bot/bot/eljur"
+)
+
+// replyEljurError сообщает об ошибке запроса к Эльжур понятным пользователю текстом
+// и предлагает действие: ввести пароль при истекшей сессии, повторить позже при
+// проблемах сервера школы. action описывает неудавшуюся операцию ("Ошибка получения оценок").
+func (b *Bot) replyEljurError(user *UserState, action string, err error) error {
+	slog.Warn("Eljur request failed", "chat_id", user.ChatID, "action", action, "err", err)
+
+	var outage *eljur.CircuitOpenError
+	switch {
+	case errors.As(err, &outage):
+		return b.replyServerDown(user, outage.RetryAt)
+	case errors.Is(err, eljur.ErrTimeout):
+		return b.replySlowServer(user)
+	case errors.Is(err, eljur.ErrInvalidCredentials):
+		return b.reply(user, fmt.Sprintf("❌ %s: неверный логин или пароль.\n\nПроверьте данные и попробуйте еще раз: /login", action), nil)
+	case errors.Is(err, eljur.ErrUnauthorized):
+		return b.promptReauth(user)
+	case errors.Is(err, eljur.ErrForbidden):
+		return b.reply(user, fmt.Sprintf("🚫 %s: нет доступа.\n\nУ вашей учетной записи нет прав на этот раздел дневника.", action), mainMenuKeyboard())
+	case errors.Is(err, eljur.ErrNotFound):
+		return b.reply(user, fmt.Sprintf("🔍 %s: данные не найдены.\n\nВозможно, они были удалены или еще не опубликованы.", action), mainMenuKeyboard())
+	case errors.Is(err, eljur.ErrRateLimited):
+		return b.reply(user, "⏳ Сервер школы просит подождать. Повторите запрос через минуту.", mainMenuKeyboard())
+	case errors.Is(err, eljur.ErrServerError):
+		return b.reply(user, fmt.Sprintf("🛠 %s: на сервере школы произошла ошибка.\n\nПопробуйте позже.", action), mainMenuKeyboard())
+	case errors.Is(err, eljur.ErrMalformedResponse):
+		return b.reply(user, fmt.Sprintf("⚠️ %s: сервер школы вернул некорректный ответ.\n\nПопробуйте позже.", action), mainMenuKeyboard())
+	}
+	return b.reply(user, fmt.Sprintf("❌ %s: %v", action, err), nil)
+}
+
+// replyServerDown сообщает, что сервер школы недоступен и запросы к нему приостановлены
+func (b *Bot) replyServerDown(user *UserState, retryAt time.Time) error {
+	text := fmt.Sprintf("🚧 <b>Сервер школы сейчас недоступен</b>\n\n"+
+		"Эльжур не отвечает на запросы, поэтому бот временно не обращается к нему. "+
+		"Попробуйте снова после %s.", retryAt.In(notifyLocation()).Format("15:04"))
+	return b.reply(user, text, mainMenuKeyboard())
+}
+
+// replySlowServer сообщает, что сервер школы не ответил вовремя
+func (b *Bot) replySlowServer(user *UserState) error {
+	return b.reply(user, "🐢 Сервер школы отвечает слишком долго. Попробуйте еще раз через минуту.", mainMenuKeyboard())
+}
+
+// mainMenuKeyboard клавиатура с единственной кнопкой возврата в главное меню
+func mainMenuKeyboard() Keyboard {
+	return NewKeyboard(
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+}
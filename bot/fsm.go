@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// State состояние диалога с пользователем. В состоянии, отличном от StateIdle,
+// текстовые сообщения передаются обработчику ввода этого состояния, а не командам.
+type State string
+
+const (
+	StateIdle           State = "idle"
+	StateAuthLogin      State = "auth_login"
+	StateAuthPassword   State = "auth_password"
+	StateReauthPassword State = "reauth_password"
+	StateAutoLogin      State = "autologin_password"
+	StateComposeSubject State = "message_compose_subject"
+	StateComposeText    State = "message_compose_text"
+	StateGeminiAPISetup State = "gemini_api_setup"
+	StateGeminiChat     State = "gemini_chat"
+)
+
+// AuthFlow временные данные пошаговой авторизации. Пароль не сохраняется:
+// он используется сразу в том же запросе.
+type AuthFlow struct {
+	Login string `json:"login,omitempty"`
+	// Resume запрос, прерванный истекшей сессией; выполняется после повторного входа
+	Resume *PendingRequest `json:"resume,omitempty"`
+}
+
+// ComposeFlow временные данные написания сообщения
+type ComposeFlow struct {
+	RecipientID string `json:"recipient_id,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+}
+
+// InputHandler обрабатывает сообщение пользователя в определенном состоянии
+type InputHandler func(user *UserState, message IncomingMessage) error
+
+// stateSpec описывает состояние диалога
+type stateSpec struct {
+	name    string        // название действия для пользователя
+	flow    string        // сценарий, временные данные которого сохраняются между его состояниями
+	from    []State       // из каких состояний можно перейти (nil - из любого)
+	timeout time.Duration // через сколько бездействия состояние сбрасывается (0 - никогда)
+}
+
+// stateSpecs объявляет все состояния и допустимые переходы между ними.
+// Первые шаги сценариев доступны из любого состояния, так как их открывают кнопки меню.
+var stateSpecs = map[State]stateSpec{
+	StateIdle:           {},
+	StateAuthLogin:      {name: "Авторизация", flow: "auth", timeout: 10 * time.Minute},
+	StateAuthPassword:   {name: "Авторизация", flow: "auth", from: []State{StateAuthLogin}, timeout: 10 * time.Minute},
+	StateReauthPassword: {name: "Повторный вход", flow: "auth", timeout: 10 * time.Minute},
+	StateAutoLogin:      {name: "Автоматический вход", timeout: 10 * time.Minute},
+	StateComposeSubject: {name: "Написание сообщения", flow: "compose", timeout: time.Hour},
+	StateComposeText:    {name: "Написание сообщения", flow: "compose", from: []State{StateComposeSubject}, timeout: time.Hour},
+	StateGeminiAPISetup: {name: "Ввод API ключа", timeout: 10 * time.Minute},
+	StateGeminiChat:     {name: "Чат с AI", timeout: 24 * time.Hour},
+}
+
+// stateInputs возвращает обработчики ввода для каждого состояния, кроме StateIdle
+func (b *Bot) stateInputs() map[State]InputHandler {
+	inputs := map[State]InputHandler{
+		StateAuthLogin: func(user *UserState, message IncomingMessage) error {
+			return b.handleAuthLogin(user, message.Text)
+		},
+		StateAuthPassword: func(user *UserState, message IncomingMessage) error {
+			return b.handleAuthPassword(user, message.Text)
+		},
+		StateReauthPassword: func(user *UserState, message IncomingMessage) error {
+			// Удаляем сообщение с паролем для безопасности
+			b.Messenger.Delete(message.ChatID, message.MessageID)
+			return b.handleReauthPassword(user, message.Text)
+		},
+		StateAutoLogin: func(user *UserState, message IncomingMessage) error {
+			b.Messenger.Delete(message.ChatID, message.MessageID)
+			return b.handleAutoLoginPassword(user, message.Text)
+		},
+		StateComposeSubject: func(user *UserState, message IncomingMessage) error {
+			return b.handleMessageSubject(user, message.Text)
+		},
+		StateComposeText: func(user *UserState, message IncomingMessage) error {
+			return b.handleMessageText(user, message.Text)
+		},
+		StateGeminiAPISetup: func(user *UserState, message IncomingMessage) error {
+			// Удаляем сообщение с API ключом для безопасности
+			b.Messenger.Delete(message.ChatID, message.MessageID)
+			return b.handleGeminiAPISetup(user, message.Text)
+		},
+		StateGeminiChat: func(user *UserState, message IncomingMessage) error {
+			if message.Image != nil {
+				return b.handleGeminiPhoto(user, message)
+			}
+			return b.handleGeminiChat(user, message.Text)
+		},
+	}
+
+	// Состояние без обработчика ввода - ошибка программиста, поэтому паникуем
+	for state := range stateSpecs {
+		if _, ok := inputs[state]; !ok && state != StateIdle {
+			panic(fmt.Sprintf("bot: нет обработчика ввода для состояния %q", state))
+		}
+	}
+	return inputs
+}
+
+// handleStateInput передает сообщение обработчику текущего состояния.
+// /cancel и команды после истечения времени ожидания обрабатываются маршрутизатором.
+func (b *Bot) handleStateInput(user *UserState, message IncomingMessage) error {
+	// Внутри диалога сообщение может быть паролем или API ключом без признаков,
+	// по которым логгер узнал бы секрет, поэтому его текст не выводится
+	if user.State == StateIdle {
+		slog.Debug("Message text", "chat_id", user.ChatID, "text", message.Text)
+	} else {
+		slog.Debug("State input", "chat_id", user.ChatID, "state", user.State, "text_length", len(message.Text))
+	}
+
+	if user.State == StateIdle || strings.TrimSpace(message.Text) == "/cancel" {
+		user.request = PendingRequest{Data: message.Text}
+		return b.router.Dispatch(user, message.Text, false)
+	}
+
+	if user.stateExpired(time.Now()) {
+		name := stateSpecs[user.State].name
+		user.resetState()
+		if err := b.reply(user, fmt.Sprintf("⌛ Действие «%s» отменено: истекло время ожидания.", name), nil); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(message.Text, "/") {
+			return nil
+		}
+		user.request = PendingRequest{Data: message.Text}
+		return b.router.Dispatch(user, message.Text, false)
+	}
+
+	// Таймаут отсчитывается от последнего ввода, а не от входа в состояние
+	user.StateChangedAt = time.Now()
+	return b.inputs[user.State](user, message)
+}
+
+// handleCancel отменяет текущее действие (/cancel)
+func (b *Bot) handleCancel(user *UserState) error {
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+
+	if user.State == StateIdle {
+		return b.reply(user, "🤷 Нечего отменять.", keyboard)
+	}
+
+	name := stateSpecs[user.State].name
+	user.resetState()
+	return b.reply(user, fmt.Sprintf("❌ Действие «%s» отменено.", name), keyboard)
+}
+
+// setState переводит пользователя в состояние next, если переход объявлен в stateSpecs.
+// При выходе из сценария его временные данные очищаются.
+func (u *UserState) setState(next State) error {
+	spec, ok := stateSpecs[next]
+	if !ok {
+		return fmt.Errorf("неизвестное состояние %q", next)
+	}
+	if spec.from != nil && !slices.Contains(spec.from, u.State) {
+		return fmt.Errorf("недопустимый переход %q -> %q", u.State, next)
+	}
+
+	if stateSpecs[u.State].flow != spec.flow {
+		u.Auth = AuthFlow{}
+		u.Compose = ComposeFlow{}
+	}
+	u.State = next
+	u.StateChangedAt = time.Now()
+	return nil
+}
+
+// resetState возвращает пользователя в StateIdle. Этот переход допустим из любого
+// состояния, поэтому он выполняется без проверок setState.
+func (u *UserState) resetState() {
+	u.Auth = AuthFlow{}
+	u.Compose = ComposeFlow{}
+	u.State = StateIdle
+	u.StateChangedAt = time.Now()
+}
+
+// stateExpired проверяет, истекло ли время ожидания ввода в текущем состоянии
+func (u *UserState) stateExpired(now time.Time) bool {
+	timeout := stateSpecs[u.State].timeout
+	return timeout > 0 && now.Sub(u.StateChangedAt) > timeout
+}
+
+// restoreState проверяет состояние, загруженное из сессии. Неизвестные состояния
+// (например, из старых версий бота) сбрасываются, чтобы ввод не попал не в тот обработчик.
+func (u *UserState) restoreState(state State, changedAt time.Time) {
+	if _, ok := stateSpecs[state]; !ok || state == "" {
+		if state != "" {
+			slog.Warn("Unknown state, resetting", "chat_id", u.ChatID, "state", state)
+		}
+		u.State = StateIdle
+		u.Auth = AuthFlow{}
+		u.Compose = ComposeFlow{}
+		return
+	}
+
+	u.State = state
+	u.StateChangedAt = changedAt
+	if changedAt.IsZero() && state != StateIdle {
+		// Время перехода не сохранялось старыми версиями: отсчитываем таймаут с текущего момента
+		u.StateChangedAt = time.Now()
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+)
+
+func TestSetState(t *testing.T) {
+	tests := []struct {
+		from    State
+		to      State
+		wantErr bool
+	}{
+		{StateIdle, StateAuthLogin, false},
+		{StateAuthLogin, StateAuthPassword, false},
+		{StateIdle, StateAuthPassword, true},
+		{StateComposeSubject, StateComposeText, false},
+		{StateAuthLogin, StateComposeText, true},
+		{StateGeminiChat, StateComposeSubject, false},
+		{StateComposeText, StateIdle, false},
+		{StateIdle, State("week_select"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			user := &UserState{State: tt.from}
+			err := user.setState(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && user.State != tt.from {
+				t.Errorf("state = %q after rejected transition, want %q", user.State, tt.from)
+			}
+			if !tt.wantErr && (user.State != tt.to || user.StateChangedAt.IsZero()) {
+				t.Errorf("state = %q at %v, want %q now", user.State, user.StateChangedAt, tt.to)
+			}
+		})
+	}
+}
+
+func TestSetStateClearsFlowData(t *testing.T) {
+	user := &UserState{State: StateIdle}
+	user.setState(StateComposeSubject)
+	user.Compose.RecipientID = "42"
+	user.setState(StateComposeText)
+	user.Compose.Subject = "Вопрос"
+
+	if user.Compose.RecipientID != "42" {
+		t.Errorf("recipient = %q inside compose flow, want 42", user.Compose.RecipientID)
+	}
+
+	user.setState(StateGeminiChat)
+	if user.Compose != (ComposeFlow{}) {
+		t.Errorf("compose data = %+v after leaving the flow, want empty", user.Compose)
+	}
+}
+
+func TestResetState(t *testing.T) {
+	for state := range stateSpecs {
+		t.Run(string(state), func(t *testing.T) {
+			user := &UserState{State: state, Auth: AuthFlow{Login: "ivanov"}, Compose: ComposeFlow{Subject: "Вопрос"}}
+			user.resetState()
+			if user.State != StateIdle || user.StateChangedAt.IsZero() {
+				t.Errorf("state = %q at %v, want idle now", user.State, user.StateChangedAt)
+			}
+			if user.Auth != (AuthFlow{}) || user.Compose != (ComposeFlow{}) {
+				t.Errorf("flow data = %+v, %+v after reset, want empty", user.Auth, user.Compose)
+			}
+		})
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	user := &UserState{Compose: ComposeFlow{Subject: "old"}}
+	user.restoreState("auth_waiting", time.Time{})
+	if user.State != StateIdle || user.Compose != (ComposeFlow{}) {
+		t.Errorf("legacy state restored as %q with %+v, want idle without data", user.State, user.Compose)
+	}
+
+	user.restoreState(StateGeminiChat, time.Time{})
+	if user.stateExpired(time.Now()) {
+		t.Error("state without saved transition time expired immediately")
+	}
+	if !user.stateExpired(time.Now().Add(25 * time.Hour)) {
+		t.Error("gemini chat did not expire after 25 hours")
+	}
+}
+
+func TestScenarioStepByStepLogin(t *testing.T) {
+	s := newScenario(t)
+
+	s.send("/login")
+	if reply := s.send(eljurtest.DefaultLogin); !strings.Contains(reply.Text(), "введите ваш пароль") {
+		t.Fatalf("after login step got %q, want password prompt", reply.Text())
+	}
+	if session := globalSessionManager.GetSession(testChatID); session.State != StateAuthPassword || session.Auth.Login != eljurtest.DefaultLogin {
+		t.Errorf("session state = %q, auth = %+v", session.State, session.Auth)
+	}
+
+	if reply := s.send(eljurtest.DefaultPassword); !reply.HasButton("diary") {
+		t.Fatalf("after password step got %q, want main menu", reply.Text())
+	}
+	session := globalSessionManager.GetSession(testChatID)
+	if session.State != StateIdle || session.Auth != (AuthFlow{}) {
+		t.Errorf("session after login: state = %q, auth = %+v, want idle without data", session.State, session.Auth)
+	}
+}
+
+func TestScenarioCancel(t *testing.T) {
+	s := newScenario(t)
+
+	s.send("/login")
+	if reply := s.send("/cancel"); !strings.Contains(reply.Text(), "«Авторизация» отменено") {
+		t.Errorf("cancel reply = %q", reply.Text())
+	}
+	// После отмены текст снова обрабатывается как команда, а не как логин
+	if reply := s.send(eljurtest.DefaultLogin); !strings.Contains(reply.Text(), "Неизвестная команда") {
+		t.Errorf("text after cancel = %q, want unknown command", reply.Text())
+	}
+	if reply := s.send("/cancel"); !strings.Contains(reply.Text(), "Нечего отменять") {
+		t.Errorf("cancel in idle = %q", reply.Text())
+	}
+}
+
+func TestScenarioStateTimeout(t *testing.T) {
+	s := newScenario(t)
+
+	s.send("/login")
+	session := globalSessionManager.GetSession(testChatID)
+	session.StateChangedAt = time.Now().Add(-time.Hour)
+	globalSessionManager.SaveSession(session)
+
+	s.send("/help")
+	messages := s.tg.Calls("sendMessage")
+	if len(messages) != 2 || !strings.Contains(messages[0].Text(), "истекло время ожидания") {
+		t.Fatalf("replies = %d, want timeout notice and help", len(messages))
+	}
+	if !strings.Contains(messages[1].Text(), "Основные команды") {
+		t.Errorf("command after timeout = %q, want help", messages[1].Text())
+	}
+	if session := globalSessionManager.GetSession(testChatID); session.State != StateIdle {
+		t.Errorf("state after timeout = %q, want idle", session.State)
+	}
+}
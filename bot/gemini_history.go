@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"unicode/utf8"
+
+	"school-diary-bot/internal/gemini"
+	"school-diary-bot/internal/llm"
+)
+
+const (
+	// maxHistoryTurns максимальное число сообщений в истории диалога с AI
+	maxHistoryTurns = 20
+	// maxHistoryTokens примерный лимит токенов истории, отправляемой модели
+	maxHistoryTokens = 8000
+	// defaultGeminiContext системная инструкция для общего чата
+	defaultGeminiContext = "Ты помощник ученика. Отвечай на вопросы, помогай с учебой."
+	// maxGeminiReplyLength максимальная длина части ответа (лимит Telegram 4096 минус заголовок)
+	maxGeminiReplyLength = 3900
+)
+
+// ChatTurn представляет одно сообщение в истории диалога с Gemini
+type ChatTurn struct {
+	Role string `json:"role"` // gemini.RoleUser или gemini.RoleModel
+	Text string `json:"text"`
+}
+
+// estimateTokens грубо оценивает число токенов в тексте (~3 символа на токен для кириллицы)
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 1
+}
+
+// trimHistory обрезает историю с начала, пока она не уложится в лимиты
+// по числу сообщений и токенов. История всегда начинается с сообщения пользователя.
+func trimHistory(history []ChatTurn) []ChatTurn {
+	tokens := 0
+	for _, turn := range history {
+		tokens += estimateTokens(turn.Text)
+	}
+
+	start := 0
+	for start < len(history)-1 && (len(history)-start > maxHistoryTurns || tokens > maxHistoryTokens) {
+		tokens -= estimateTokens(history[start].Text)
+		start++
+	}
+	for start < len(history)-1 && history[start].Role != gemini.RoleUser {
+		start++
+	}
+
+	return append([]ChatTurn(nil), history[start:]...)
+}
+
+// llmMessages преобразует историю в сообщения для языковой модели
+func llmMessages(history []ChatTurn) []llm.Message {
+	messages := make([]llm.Message, 0, len(history))
+	for _, turn := range history {
+		role := llm.RoleUser
+		if turn.Role == gemini.RoleModel {
+			role = llm.RoleAssistant
+		}
+		messages = append(messages, llm.Message{Role: role, Text: turn.Text})
+	}
+	return messages
+}
+
+// assistantReady проверяет, может ли пользователь обращаться к выбранной модели
+func (u *UserState) assistantReady() bool {
+	if u.LLMProvider == llm.ProviderOpenAI {
+		return llm.OpenAIConfigured()
+	}
+	return u.GeminiAPIKey != ""
+}
+
+// assistantProvider возвращает выбранного пользователем провайдера (по умолчанию Gemini)
+func (u *UserState) assistantProvider() (llm.Provider, error) {
+	if u.LLMProvider == llm.ProviderOpenAI {
+		return llm.NewOpenAIFromEnv()
+	}
+	if u.GeminiAPIKey == "" {
+		return nil, llm.ErrNotConfigured
+	}
+	return llm.NewGemini(u.GeminiAPIKey, u.GeminiModel), nil
+}
+
+// assistantName возвращает название выбранного провайдера для заголовков ответов
+func (u *UserState) assistantName() string {
+	if provider, err := u.assistantProvider(); err == nil {
+		return provider.Name()
+	}
+	return "Gemini AI"
+}
+
+// askAssistant отправляет вопрос выбранной модели с учетом истории диалога и сохраняет ответ в историю.
+// Изображения передаются только в текущем запросе, в историю попадает лишь текст вопроса.
+func (b *Bot) askAssistant(user *UserState, question string, images ...llm.Image) (string, error) {
+	provider, err := user.assistantProvider()
+	if err != nil {
+		return "", err
+	}
+
+	history := trimHistory(append(user.GeminiHistory, ChatTurn{Role: gemini.RoleUser, Text: question}))
+
+	messages := llmMessages(history)
+	messages[len(messages)-1].Images = images
+
+	response, err := provider.Chat(user.ctx, llm.Request{System: user.GeminiContext, Messages: messages})
+	if err != nil {
+		return "", err
+	}
+
+	user.GeminiHistory = trimHistory(append(history, ChatTurn{Role: gemini.RoleModel, Text: response}))
+	return response, nil
+}
+
+// resetGeminiHistory очищает историю диалога с Gemini
+func (u *UserState) resetGeminiHistory() {
+	u.GeminiHistory = nil
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"school-diary-bot/internal/llm"
+)
+
+const (
+	// maxImageSize максимальный размер изображения, отправляемого модели
+	maxImageSize = 10 << 20
+	// defaultPhotoQuestion вопрос к фото, отправленному без подписи
+	defaultPhotoQuestion = "Помоги разобраться с заданием на фото: объясни решение по шагам."
+)
+
+// supportedImageTypes форматы изображений, которые принимают модели
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/heic": true,
+	"image/heif": true,
+}
+
+// handleGeminiPhoto отправляет фото (например, задания из тетради) модели вместе с подписью
+func (b *Bot) handleGeminiPhoto(user *UserState, message IncomingMessage) error {
+	if !user.assistantReady() {
+		return b.reply(user, "❌ AI ассистент не настроен. Используйте /gemini", nil)
+	}
+
+	image := message.Image
+	if !supportedImageTypes[image.MimeType] {
+		return b.reply(user, "❌ Этот формат изображения не поддерживается. Отправьте фото в формате JPEG, PNG или WEBP.", nil)
+	}
+	if image.FileSize > maxImageSize {
+		return b.reply(user, fmt.Sprintf("❌ Изображение слишком большое (максимум %d МБ).", maxImageSize>>20), nil)
+	}
+
+	// Отправляем сообщение о том, что обрабатываем запрос
+	done := b.showProgress(user.ChatID, "🔍 Изучаем фото...")
+
+	data, err := b.Messenger.DownloadFile(image.FileID, maxImageSize)
+	var response string
+	if err == nil {
+		question := strings.TrimSpace(message.Caption)
+		if question == "" {
+			question = defaultPhotoQuestion
+		}
+		response, err = b.askAssistant(user, "📷 [фото] "+question, llm.Image{MimeType: image.MimeType, Data: data})
+	}
+
+	// Удаляем сообщение "думает"
+	done()
+
+	if err != nil {
+		return b.reply(user, fmt.Sprintf("❌ Ошибка обработки фото: %v\n\nПопробуйте еще раз.", err), nil)
+	}
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("💬 Продолжить чат", "gemini_chat"),
+		),
+		NewRow(
+			NewButton("🔙 Меню Gemini", "gemini"),
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+
+	return b.sendGeminiReply(user, response, keyboard)
+}
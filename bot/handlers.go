@@ -1,54 +1,20 @@
 package bot
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
 	"school-diary-bot/bot/eljur"
 	"school-diary-bot/internal/gemini"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"school-diary-bot/internal/llm"
+	"school-diary-bot/internal/render"
 )
 
-// splitMessage умно разбивает текст на части, стараясь не разрывать предложения
-func splitMessage(text string, maxLength int) []string {
-	if len(text) <= maxLength {
-		return []string{text}
-	}
-
-	var parts []string
-	remaining := text
-
-	for len(remaining) > 0 {
-		if len(remaining) <= maxLength {
-			parts = append(parts, remaining)
-			break
-		}
-
-		// Ищем лучшее место для разрыва (конец предложения, параграфа или слова)
-		cutIndex := maxLength
-
-		// Ищем ближайший перенос строки назад от максимальной длины
-		if idx := strings.LastIndex(remaining[:maxLength], "\n\n"); idx > maxLength/2 {
-			cutIndex = idx + 2
-		} else if idx := strings.LastIndex(remaining[:maxLength], "\n"); idx > maxLength/2 {
-			cutIndex = idx + 1
-		} else if idx := strings.LastIndex(remaining[:maxLength], ". "); idx > maxLength/2 {
-			cutIndex = idx + 2
-		} else if idx := strings.LastIndex(remaining[:maxLength], " "); idx > maxLength/2 {
-			cutIndex = idx + 1
-		}
-
-		parts = append(parts, strings.TrimSpace(remaining[:cutIndex]))
-		remaining = strings.TrimSpace(remaining[cutIndex:])
-	}
-
-	return parts
-}
-
 // formatDateRu преобразует дату из формата YYYYMMDD в русский формат
 func formatDateRu(dateStr string) string {
 	if len(dateStr) != 8 {
@@ -75,103 +41,57 @@ func formatDateRu(dateStr string) string {
 	return fmt.Sprintf("%d %s %s", dayInt, monthName, year)
 }
 
-// HandleMessage обрабатывает текстовые сообщения
-func (b *Bot) HandleMessage(message *tgbotapi.Message) error {
-	user := b.GetUserState(message.Chat.ID)
-	text := message.Text
+// HandleMessage обрабатывает входящие сообщения (текст и фото). Запросы к Эльжур
+// выполняются в рамках ctx: по истечении его дедлайна пользователь получает
+// сообщение о медленном сервере школы.
+func (b *Bot) HandleMessage(ctx context.Context, message IncomingMessage) error {
+	unlock := b.lockUser(message.ChatID)
+	defer unlock()
 
-	switch user.State {
-	case "auth_waiting":
-		return b.handleAuthInput(user, text)
-	case "message_compose_subject":
-		return b.handleMessageSubject(user, text)
-	case "message_compose_text":
-		return b.handleMessageText(user, text)
-	case "gemini_api_setup":
-		// Удаляем сообщение с API ключом для безопасности
-		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, message.MessageID)
-		b.API.Send(deleteMsg)
-		return b.handleGeminiAPISetup(user, text)
-	case "gemini_chat":
-		return b.handleGeminiChat(user, text)
-	default:
-		return b.handleCommands(user, text)
-	}
-}
+	user := b.GetUserState(ctx, message.ChatID)
+	defer b.SaveUserStateServerless(user)
 
-// handleCommands обрабатывает команды бота
-func (b *Bot) handleCommands(user *UserState, text string) error {
-	// Проверяем команды с параметрами
-	if strings.HasPrefix(text, "/login ") {
-		return b.handleLoginWithParams(user, text)
-	}
-	if strings.HasPrefix(text, "/messages send ") {
-		return b.handleMessageSendWithParams(user, text)
-	}
-	if strings.HasPrefix(text, "/gemini ") {
-		return b.handleGeminiWithParams(user, text)
-	}
-
-	switch text {
-	case "/start":
-		return b.handleStart(user)
-	case "/help":
-		return b.handleHelp(user)
-	case "/login":
-		return b.handleLogin(user)
-	case "/logout":
-		return b.handleLogout(user)
-	case "/diary":
-		return b.handleDiary(user)
-	case "/periods":
-		return b.handlePeriods(user)
-	case "/messages":
-		return b.handleMessages(user)
-	case "/schedule":
-		return b.handleSchedule(user)
-	case "/marks":
-		return b.handleMarks(user)
-	case "/gemini":
-		return b.handleGemini(user)
-	default:
-		return b.SendMessage(user.ChatID, "❓ Неизвестная команда. Используйте /help для получения справки.", nil)
-	}
+	return b.handleStateInput(user, message)
 }
 
 // handleStart обрабатывает команду /start
 func (b *Bot) handleStart(user *UserState) error {
-	log.Printf("[START] User %d - IsAuthenticated: %v, Login: %s, Token length: %d", user.ChatID, user.Client.IsAuthenticated(), user.Client.GetLogin(), len(user.Client.GetToken()))
+	slog.Debug("[START]", "chat_id", user.ChatID, "authenticated", user.Client.IsAuthenticated(), "login", user.Client.GetLogin())
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📚 Дневник", "diary"),
-			tgbotapi.NewInlineKeyboardButtonData("📅 Периоды", "periods"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("📚 Дневник", "diary"),
+			NewButton("📅 Периоды", "periods"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💬 Сообщения", "messages"),
-			tgbotapi.NewInlineKeyboardButtonData("📋 Расписание", "schedule"),
+		NewRow(
+			NewButton("💬 Сообщения", "messages"),
+			NewButton("📋 Расписание", "schedule"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 Оценки", "marks"),
-			tgbotapi.NewInlineKeyboardButtonData("🔐 Войти", "login"),
+		NewRow(
+			NewButton("📊 Оценки", "marks"),
+			NewButton("🔐 Войти", "login"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("ℹ️ Помощь", "help"),
+		NewRow(
+			NewButton("🔔 Уведомления", "notify"),
+			NewButton("ℹ️ Помощь", "help"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🤖 Gemini AI", "gemini"),
+		NewRow(
+			NewButton("🤖 Gemini AI", "gemini"),
 		),
 	)
+	if len(user.Client.Students()) > 1 {
+		keyboard = append(keyboard, NewRow(NewButton("👨‍👩‍👧 Сменить ребенка", "child")))
+	}
 
 	welcomeText := "👋 <b>Добро пожаловать в школьный электронный дневник!</b>\n\n"
 	if user.Client.IsAuthenticated() {
-		welcomeText += "✅ Вы авторизованы\n\n"
+		welcomeText += "✅ Вы авторизованы\n" + activeStudentLine(user) + "\n"
 	} else {
 		welcomeText += "⚠️ Для доступа ко всем функциям необходимо авторизоваться\n\n"
 	}
 	welcomeText += "Выберите действие:"
 
-	return b.SendMessage(user.ChatID, welcomeText, keyboard)
+	return b.reply(user, welcomeText, keyboard)
 }
 
 // handleHelp обрабатывает команду /help
@@ -187,11 +107,16 @@ func (b *Bot) handleHelp(user *UserState) error {
 		"/schedule - Расписание занятий\n" +
 		"/marks - Оценки по предметам\n" +
 		"/gemini - Gemini AI Ассистент\n" +
+		"/notify - Уведомления об оценках и сообщениях\n" +
+		"/child - Выбор ребенка (для родителей)\n" +
+		"/autologin - Автоматический вход при истечении сессии\n" +
+		"/cancel - Отменить текущее действие\n" +
 		"/help - Эта справка\n\n" +
 		"<b>Быстрые команды:</b>\n" +
 		"/login логин пароль - быстрая авторизация\n" +
 		"/messages send ID \"\u0442\u0435\u043c\u0430\" \"\u0442\u0435\u043a\u0441\u0442\" - быстрая отправка сообщения\n" +
-		"/gemini вопрос - быстрый запрос к AI\n\n" +
+		"/gemini вопрос - быстрый запрос к AI\n" +
+		"/gemini reset - начать диалог с AI заново\n\n" +
 		"<b>Примеры использования:</b>\n" +
 		"<code>/login Ivanov password123</code>\n" +
 		"<code>/messages send 123 \"Вопрос\" \"Привет, как дела?\"</code>\n" +
@@ -201,67 +126,57 @@ func (b *Bot) handleHelp(user *UserState) error {
 		"2. Используйте команды или кнопки меню\n" +
 		"3. Выбирайте недели и периоды для просмотра данных"
 
-	return b.SendMessage(user.ChatID, helpText, nil)
+	return b.reply(user, helpText, nil)
 }
 
 // handleLogin обрабатывает авторизацию
 func (b *Bot) handleLogin(user *UserState) error {
 	if user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "✅ Вы уже авторизованы! Используйте /logout для выхода.", nil)
+		return b.reply(user, "✅ Вы уже авторизованы! Используйте /logout для выхода.", nil)
 	}
 
-	user.State = "auth_waiting"
-	user.AuthStep = 1
+	if err := user.setState(StateAuthLogin); err != nil {
+		return err
+	}
 
-	return b.SendMessage(user.ChatID, "🔐 <b>Авторизация</b>\n\nВведите ваш логин и пароль:\n\n<i>Пример: /login Ivanov passwd123</i>", nil)
+	return b.reply(user, "🔐 <b>Авторизация</b>\n\nВведите ваш логин и пароль:\n\n<i>Пример: /login Ivanov passwd123</i>", nil)
 }
 
 // handleLoginWithParams обрабатывает авторизацию с параметрами /login username password
-func (b *Bot) handleLoginWithParams(user *UserState, text string) error {
+func (b *Bot) handleLoginWithParams(user *UserState, username, password string) error {
 	if user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "✅ Вы уже авторизованы! Используйте /logout для выхода.", nil)
-	}
-
-	// Разбираем команду на части
-	parts := strings.Fields(text)
-	if len(parts) != 3 {
-		return b.SendMessage(user.ChatID, "❌ Неверный формат команды.\n\n<b>Используйте:</b>\n/login логин пароль\n\n<b>Пример:</b>\n/login Ivanov password123\n\nИли используйте /login для пошаговой авторизации.", nil)
-	}
-
-	username := strings.TrimSpace(parts[1])
-	password := strings.TrimSpace(parts[2])
-
-	if username == "" || password == "" {
-		return b.SendMessage(user.ChatID, "❌ Логин и пароль не могут быть пустыми.", nil)
+		return b.reply(user, "✅ Вы уже авторизованы! Используйте /logout для выхода.", nil)
 	}
 
 	// Отправляем сообщение о процессе авторизации
-	b.SendMessage(user.ChatID, "🔄 Проверяем данные авторизации...", nil)
+	b.reply(user, "🔄 Проверяем данные авторизации...", nil)
 
 	// Выполняем авторизацию
-	err := user.Client.Authenticate(username, password)
+	err := b.authenticate(user, username, password)
 
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка авторизации: %v\n\nПроверьте правильность логина и пароля.", err), nil)
+		return b.replyEljurError(user, "Ошибка авторизации", err)
 	}
 
 	// Сохраняем состояние после успешной авторизации
 	b.SaveUserStateIfNeeded(user)
 
 	// После успешной авторизации показываем главное меню
-	_ = b.SendMessage(user.ChatID, "✅ Авторизация успешна! Теперь вам доступны все функции дневника.", nil)
+	_ = b.reply(user, "✅ Авторизация успешна! Теперь вам доступны все функции дневника.", nil)
 	return b.handleStart(user)
 }
 
-// handleMessageSendWithParams обрабатывает отправку сообщения с параметрами
-func (b *Bot) handleMessageSendWithParams(user *UserState, text string) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
+// handleLoginFormat объясняет формат команды /login с параметрами
+func (b *Bot) handleLoginFormat(user *UserState) error {
+	if user.Client.IsAuthenticated() {
+		return b.reply(user, "✅ Вы уже авторизованы! Используйте /logout для выхода.", nil)
 	}
+	return b.reply(user, "❌ Неверный формат команды.\n\n<b>Используйте:</b>\n/login логин пароль\n\n<b>Пример:</b>\n/login Ivanov password123\n\nИли используйте /login для пошаговой авторизации.", nil)
+}
 
-	// Убираем "/messages send " из начала команды
-	params := strings.TrimPrefix(text, "/messages send ")
-
+// handleMessageSendWithParams обрабатывает отправку сообщения с параметрами
+// (/messages send получатель_ID "тема" "текст")
+func (b *Bot) handleMessageSendWithParams(user *UserState, params string) error {
 	// Парсим параметры: recipientID "subject" "message text"
 	// Простой парсинг по пробелам и кавычкам
 	parts := []string{}
@@ -287,7 +202,7 @@ func (b *Bot) handleMessageSendWithParams(user *UserState, text string) error {
 	}
 
 	if len(parts) < 3 {
-		return b.SendMessage(user.ChatID, "❌ Неверный формат команды.\n\n<b>Используйте:</b>\n/messages send получатель_ID \"\u0442\u0435\u043c\u0430\" \"\u0442\u0435\u043a\u0441\u0442 \u0441\u043e\u043e\u0431\u0449\u0435\u043d\u0438\u044f\"\n\n<b>Пример:</b>\n/messages send 123 \"Вопрос по уроку\" \"Привет! Можно ли получить домашнее задание?\"", nil)
+		return b.reply(user, "❌ Неверный формат команды.\n\n<b>Используйте:</b>\n/messages send получатель_ID \"\u0442\u0435\u043c\u0430\" \"\u0442\u0435\u043a\u0441\u0442 \u0441\u043e\u043e\u0431\u0449\u0435\u043d\u0438\u044f\"\n\n<b>Пример:</b>\n/messages send 123 \"Вопрос по уроку\" \"Привет! Можно ли получить домашнее задание?\"", nil)
 	}
 
 	recipientID := strings.TrimSpace(parts[0])
@@ -295,247 +210,146 @@ func (b *Bot) handleMessageSendWithParams(user *UserState, text string) error {
 	messageText := strings.TrimSpace(parts[2])
 
 	if recipientID == "" || subject == "" || messageText == "" {
-		return b.SendMessage(user.ChatID, "❌ Все параметры обязательны.", nil)
+		return b.reply(user, "❌ Все параметры обязательны.", nil)
 	}
 
 	// Отправляем сообщение
-	b.SendMessage(user.ChatID, "📤 Отправляем сообщение...", nil)
+	b.reply(user, "📤 Отправляем сообщение...", nil)
 
 	recipients := []string{recipientID}
-	_, err := user.Client.SendMessage(recipients, subject, messageText)
+	_, err := user.Client.SendMessage(user.ctx, recipients, subject, messageText)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка отправки сообщения: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка отправки сообщения", err)
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✉️ Написать еще", "msg_compose"),
-			tgbotapi.NewInlineKeyboardButtonData("📥 К сообщениям", "messages"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("✉️ Написать еще", "msg_compose"),
+			NewButton("📥 К сообщениям", "messages"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, fmt.Sprintf("✅ <b>Сообщение отправлено!</b>\n\n👤 Получатель: %s\n📝 Тема: %s", recipientID, subject), keyboard)
+	return b.reply(user, fmt.Sprintf("✅ <b>Сообщение отправлено!</b>\n\n👤 Получатель: %s\n📝 Тема: %s", recipientID, subject), keyboard)
 }
 
-// handleGeminiWithParams обрабатывает запрос к Gemini AI с параметрами
-func (b *Bot) handleGeminiWithParams(user *UserState, text string) error {
+// handleGeminiWithParams обрабатывает запрос к Gemini AI с параметрами (/gemini вопрос)
+func (b *Bot) handleGeminiWithParams(user *UserState, prompt string) error {
 	// Проверяем, настроен ли Gemini
-	if user.GeminiAPIKey == "" {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо настроить Gemini AI через /gemini", nil)
-	}
-
-	// Убираем "/gemini " из начала команды
-	prompt := strings.TrimPrefix(text, "/gemini ")
-	prompt = strings.TrimSpace(prompt)
-
-	if prompt == "" {
-		return b.SendMessage(user.ChatID, "❌ Пустой запрос.\n\n<b>Используйте:</b>\n/gemini ваш вопрос\n\n<b>Пример:</b>\n/gemini Объясни мне закон Ньютона", nil)
+	if !user.assistantReady() {
+		return b.reply(user, "⚠️ Сначала необходимо настроить Gemini AI через /gemini", nil)
 	}
 
 	// Отправляем сообщение о обработке
-	processingMsg := tgbotapi.NewMessage(user.ChatID, "🤖 Обрабатываем ваш запрос...")
-	sentMsg, _ := b.API.Send(processingMsg)
+	done := b.showProgress(user.ChatID, "🤖 Обрабатываем ваш запрос...")
 
-	// Создаем клиент Gemini
-	client := gemini.NewClient(user.GeminiAPIKey, user.GeminiModel)
-
-	// Отправляем запрос к Gemini
-	response, err := client.SendMessage(prompt, user.GeminiContext)
+	// Отправляем запрос модели с учетом истории диалога
+	response, err := b.askAssistant(user, prompt)
 
 	// Удаляем сообщение "думает"
-	if sentMsg.MessageID != 0 {
-		deleteMsg := tgbotapi.NewDeleteMessage(user.ChatID, sentMsg.MessageID)
-		b.API.Send(deleteMsg)
-	}
+	done()
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка Gemini AI: %v", err), nil)
-	}
-
-	// Ограничиваем длину ответа
-	maxLength := 3900
-	if len(response) > maxLength {
-		response = response[:maxLength] + "...\n\n[Ответ сокращен]"
-	}
-
-	// Очищаем ответ от потенциально проблемных символов
-	response = strings.ReplaceAll(response, "\u0000", "")
-	response = strings.ReplaceAll(response, "`", "'")   // Заменяем обратные кавычки
-	response = strings.ReplaceAll(response, "*", "\\*") // Экранируем звездочки
-	response = strings.ReplaceAll(response, "_", "\\_") // Экранируем подчеркивания
-	response = strings.ReplaceAll(response, "[", "\\[") // Экранируем квадратные скобки
-	response = strings.ReplaceAll(response, "]", "\\]")
-	response = strings.TrimSpace(response)
-
-	if response == "" {
-		return b.SendMessage(user.ChatID, "❌ Gemini вернул пустой ответ. Попробуйте переформулировать вопрос.", nil)
+		return b.reply(user, fmt.Sprintf("❌ Ошибка %s: %v", user.assistantName(), err), nil)
 	}
 
 	// Сохраняем состояние
 	b.SaveUserStateIfNeeded(user)
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💬 Продолжить чат", "gemini_chat"),
-			tgbotapi.NewInlineKeyboardButtonData("🤖 Gemini меню", "gemini"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("💬 Продолжить чат", "gemini_chat"),
+			NewButton("🤖 Gemini меню", "gemini"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
 	// Отправляем ответ
-	return b.SendMessage(user.ChatID, fmt.Sprintf("🤖 <b>Gemini AI:</b>\n\n%s", response), keyboard)
+	return b.sendGeminiReply(user, response, keyboard)
 }
 
 // handleLogout обрабатывает выход из системы
 func (b *Bot) handleLogout(user *UserState) error {
 	user.Client = eljur.NewClient()
-	user.State = "idle"
-	user.AuthStep = 0
-	user.TempLogin = ""
-	user.TempPassword = ""
+	user.expiredLogin = ""
+	user.resetState()
 
-	return b.SendMessage(user.ChatID, "👋 Вы вышли из системы.", nil)
+	return b.reply(user, "👋 Вы вышли из системы.", nil)
 }
 
-// handleAuthInput обрабатывает ввод данных авторизации (оптимизировано для webhook)
-func (b *Bot) handleAuthInput(user *UserState, text string) error {
-	switch user.AuthStep {
-	case 1: // Логин
-		user.TempLogin = strings.TrimSpace(text)
-		user.AuthStep = 2
-		// Сохраняем состояние после обновления
-		b.SaveUserStateIfNeeded(user)
-		return b.SendMessage(user.ChatID, "🔑 Теперь введите ваш пароль:\n\n<i>Пример: password123</i>", nil)
-
-	case 2: // Пароль
-		user.TempPassword = strings.TrimSpace(text)
-
-		// Отправляем сообщение о процессе авторизации
-		b.SendMessage(user.ChatID, "🔄 Проверяем данные авторизации...", nil)
-
-		// Выполняем авторизацию
-		err := user.Client.Authenticate(user.TempLogin, user.TempPassword)
-
-		// Очищаем временные данные
-		user.TempLogin = ""
-		user.TempPassword = ""
-		user.State = "idle"
-		user.AuthStep = 0
-
-		if err != nil {
-			b.SaveUserStateIfNeeded(user)
-			return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка авторизации: %v\n\nПопробуйте еще раз с помощью /login", err), nil)
-		}
+// handleAuthLogin принимает логин при пошаговой авторизации
+func (b *Bot) handleAuthLogin(user *UserState, text string) error {
+	if err := user.setState(StateAuthPassword); err != nil {
+		return err
+	}
+	user.Auth.Login = strings.TrimSpace(text)
 
-		// Сохраняем состояние после успешной авторизации
-		b.SaveUserStateIfNeeded(user)
+	return b.reply(user, "🔑 Теперь введите ваш пароль:\n\n<i>Пример: password123</i>", nil)
+}
+
+// handleAuthPassword принимает пароль и выполняет авторизацию (оптимизировано для webhook)
+func (b *Bot) handleAuthPassword(user *UserState, text string) error {
+	login := user.Auth.Login
+	user.resetState()
 
-		// После успешной авторизации показываем главное меню
-		_ = b.SendMessage(user.ChatID, "✅ Авторизация успешна! Теперь вам доступны все функции дневника.", nil)
-		return b.handleStart(user)
+	// Отправляем сообщение о процессе авторизации
+	b.reply(user, "🔄 Проверяем данные авторизации...", nil)
+
+	// Выполняем авторизацию
+	if err := b.authenticate(user, login, strings.TrimSpace(text)); err != nil {
+		return b.replyEljurError(user, "Ошибка авторизации", err)
 	}
 
-	return nil
+	// Сохраняем состояние после успешной авторизации
+	b.SaveUserStateIfNeeded(user)
+
+	// После успешной авторизации показываем главное меню
+	_ = b.reply(user, "✅ Авторизация успешна! Теперь вам доступны все функции дневника.", nil)
+	return b.handleStart(user)
 }
 
-// HandleCallback обрабатывает нажатия на кнопки
-func (b *Bot) HandleCallback(query *tgbotapi.CallbackQuery) error {
-	user := b.GetUserState(query.Message.Chat.ID)
-	data := query.Data
+// HandleCallback обрабатывает нажатия на кнопки (см. HandleMessage о ctx)
+func (b *Bot) HandleCallback(ctx context.Context, query IncomingCallback) error {
+	unlock := b.lockUser(query.ChatID)
+	defer unlock()
+
+	user := b.GetUserState(ctx, query.ChatID)
+	defer b.SaveUserStateServerless(user)
+
+	// Первый ответ обработчика заменит сообщение с нажатой кнопкой
+	user.editMessageID = query.MessageID
 
 	// Отвечаем на callback query
 	b.AnswerCallback(query.ID, "")
 
-	switch {
-	case data == "start":
-		return b.handleStart(user)
-	case data == "diary":
-		return b.handleDiary(user)
-	case data == "periods":
-		return b.handlePeriods(user)
-	case data == "messages":
-		return b.handleMessages(user)
-	case data == "schedule":
-		return b.handleSchedule(user)
-	case data == "marks":
-		return b.handleMarks(user)
-	case data == "login":
-		return b.handleLogin(user)
-	case data == "help":
-		return b.handleHelp(user)
-	case data == "clear_chat":
-		return b.handleClearChat(user)
-	case data == "gemini":
-		return b.handleGemini(user)
-	case data == "gemini_setup":
-		return b.handleGeminiSetup(user)
-	case data == "gemini_help":
-		return b.handleGeminiHelp(user)
-	case data == "gemini_model_select":
-		return b.handleGeminiModelSelect(user, data) // Показать список моделей
-	case strings.HasPrefix(data, "gemini_model_"):
-		return b.handleGeminiModelSelect(user, data) // Выбор конкретной модели
-	case data == "gemini_change_key":
-		return b.handleGeminiSetup(user) // Показываем форму ввода ключа
-	case data == "gemini_reset":
-		return b.handleGeminiReset(user)
-	case data == "gemini_chat":
-		return b.handleGeminiChatStart(user)
-	case strings.HasPrefix(data, "gemini_context_"):
-		return b.handleGeminiContextSelect(user, data)
-	case strings.HasPrefix(data, "week_"):
-		return b.handleWeekSelect(user, data)
-	case strings.HasPrefix(data, "period_"):
-		return b.handlePeriodSelect(user, data)
-	case strings.HasPrefix(data, "msg_read_"):
-		return b.handleReadMessage(user, data)
-	case strings.HasPrefix(data, "compose_to_"):
-		return b.handleSelectRecipient(user, data)
-	case strings.HasPrefix(data, "msg_"):
-		return b.handleMessageAction(user, data)
-	default:
-		return b.SendMessage(user.ChatID, "🔄 Обрабатываем запрос...", nil)
-	}
+	user.request = PendingRequest{Data: query.Data, Callback: true}
+	return b.dispatchCallback(user, query.Data)
 }
 
 // handleDiary обрабатывает просмотр дневника
 func (b *Bot) handleDiary(user *UserState) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
-	}
-
-	// Получаем периоды для выбора недель
-	periods, err := user.Client.GetPeriods(true, false)
+	// Получаем текущий период для выбора недель
+	period, err := user.Client.CurrentPeriod(user.ctx, time.Now())
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения периодов: %v", err), nil)
-	}
-
-	if len(periods.Response.Result.Students) == 0 {
-		return b.SendMessage(user.ChatID, "❌ Не найдены данные о студенте", nil)
-	}
-
-	student := periods.Response.Result.Students[0]
-	if len(student.Periods) == 0 {
-		return b.SendMessage(user.ChatID, "❌ Не найдены учебные периоды", nil)
+		return b.replyEljurError(user, "Ошибка получения периодов", err)
 	}
 
 	// Показываем выбор недель из текущего периода
-	return b.showWeekSelection(user, student.Periods[len(student.Periods)-1]) // Последний период (текущий)
+	return b.showWeekSelection(user, *period)
 }
 
 // showWeekSelection показывает выбор недель
 func (b *Bot) showWeekSelection(user *UserState, period eljur.Period) error {
-	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var keyboard Keyboard
 
 	text := fmt.Sprintf("📅 <b>Выберите неделю из %s:</b>\n\n", period.FullName)
 
 	for i, week := range period.Weeks {
 		if i%2 == 0 {
-			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{})
+			keyboard = append(keyboard, []Button{})
 		}
 
 		// Преобразуем даты в читабьый формат
@@ -543,8 +357,8 @@ func (b *Bot) showWeekSelection(user *UserState, period eljur.Period) error {
 		endFormatted := formatDateRu(week.End)
 		weekTitle := fmt.Sprintf("%s - %s", startFormatted, endFormatted)
 
-		weekData := fmt.Sprintf("week_%s_%s_%s", period.Name, week.Start, week.End)
-		button := tgbotapi.NewInlineKeyboardButtonData(
+		weekData := user.encodeCallback("week", Params{"period": period.Name, "start": week.Start, "end": week.End})
+		button := NewButton(
 			fmt.Sprintf("📅 %s", weekTitle),
 			weekData,
 		)
@@ -553,30 +367,22 @@ func (b *Bot) showWeekSelection(user *UserState, period eljur.Period) error {
 	}
 
 	// Добавляем кнопку "Назад"
-	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "start"),
+	keyboard = append(keyboard, []Button{
+		NewButton("🔙 Назад", "start"),
 	})
 
-	return b.SendMessage(user.ChatID, text, tgbotapi.NewInlineKeyboardMarkup(keyboard...))
+	return b.reply(user, text, NewKeyboard(keyboard...))
 }
 
 // handleWeekSelect обрабатывает выбор недели
-func (b *Bot) handleWeekSelect(user *UserState, data string) error {
-	parts := strings.Split(data, "_")
-	if len(parts) < 4 {
-		return b.SendMessage(user.ChatID, "❌ Ошибка выбора недели", nil)
-	}
-
-	startDate := parts[2]
-	endDate := parts[3]
-
+func (b *Bot) handleWeekSelect(user *UserState, startDate, endDate string) error {
 	days := fmt.Sprintf("%s-%s", startDate, endDate)
 	user.CurrentWeek = days
 
 	// Получаем дневник за выбранную неделю
-	diary, err := user.Client.GetDiary(days)
+	diary, err := user.Client.GetDiary(user.ctx, days)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения дневника: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения дневника", err)
 	}
 
 	return b.formatDiary(user, diary)
@@ -585,176 +391,110 @@ func (b *Bot) handleWeekSelect(user *UserState, data string) error {
 // formatDiary форматирует и отправляет дневник
 func (b *Bot) formatDiary(user *UserState, diary *eljur.DiaryResponse) error {
 	var diaryText strings.Builder
-	diaryText.WriteString("📚 <b>Дневник за выбранную неделю:</b>\n\n")
+	diaryText.WriteString("📚 <b>Дневник за выбранную неделю:</b>\n")
+	diaryText.WriteString(activeStudentLine(user))
+	diaryText.WriteString("\n")
 
-	result := diary.Response.Result
+	students := diary.Response.Result.SortedStudents()
 	hasLessons := false
 
-	// Ищем ключ "students" в результате
-	studentsData, hasStudents := result["students"]
-	if !hasStudents {
+	if len(students) == 0 {
 		diaryText.WriteString("📝 Данные о дневнике не найдены")
-	} else {
-		// studentsData должно быть объектом, где ключ - это ID студента
-		if studentsMap, ok := studentsData.(map[string]interface{}); ok {
-			// Проходим по каждому студенту
-			for _, studentInfo := range studentsMap {
-				// studentInfo должно содержать данные студента
-				if studentData, ok := studentInfo.(map[string]interface{}); ok {
-
-					// Ищем поле "days" в данных студента
-					daysData, hasDays := studentData["days"]
-					if !hasDays {
-						diaryText.WriteString("📝 Данные о днях не найдены")
-						continue
-					}
+	}
 
-					// days должно быть объектом с датами как ключами
-					if daysMap, ok := daysData.(map[string]interface{}); ok {
-						// Собираем все даты и сортируем их
-						var dates []string
-						for dateKey := range daysMap {
-							if len(dateKey) == 8 && isDate(dateKey) {
-								dates = append(dates, dateKey)
-							}
-						}
+	for _, student := range students {
+		if len(students) > 1 && student.Title != "" {
+			diaryText.WriteString(fmt.Sprintf("👤 <b>%s</b>\n\n", html.EscapeString(student.Title)))
+		}
 
-						// Сортируем даты
-						for i := 0; i < len(dates); i++ {
-							for j := i + 1; j < len(dates); j++ {
-								if dates[i] > dates[j] {
-									dates[i], dates[j] = dates[j], dates[i]
-								}
-							}
-						}
+		for _, day := range student.SortedDays() {
+			if !isDate(day.Date) {
+				continue
+			}
 
-						// Отображаем информацию по дням
-						for _, dateKey := range dates {
-							if dayInfo, exists := daysMap[dateKey]; exists {
-								if dayData, ok := dayInfo.(map[string]interface{}); ok {
-									title, _ := dayData["title"].(string)
-									if title == "" {
-										title = formatDateRu(dateKey)
-									}
-
-									diaryText.WriteString(fmt.Sprintf("📅 <b>%s</b>\n", title))
-
-									// Проверяем есть ли праздник
-									if alert, hasAlert := dayData["alert"]; hasAlert {
-										if alert == "holiday" {
-											if holidayName, ok := dayData["holiday_name"].(string); ok {
-												diaryText.WriteString(fmt.Sprintf("   🎉 %s\n", holidayName))
-											}
-										} else if alert == "today" {
-											diaryText.WriteString("   📍 Сегодня\n")
-										}
-									}
-
-									// Ищем уроки в items
-									itemsData, hasItems := dayData["items"]
-									if !hasItems {
-										diaryText.WriteString("   Уроков нет\n\n")
-										continue
-									}
-
-									items, ok := itemsData.(map[string]interface{})
-									if !ok || len(items) == 0 {
-										diaryText.WriteString("   Уроков нет\n\n")
-										continue
-									}
-
-									hasLessons = true
-
-									// Сортируем уроки по номеру
-									var lessonNumbers []string
-									for lessonNum := range items {
-										lessonNumbers = append(lessonNumbers, lessonNum)
-									}
-
-									// Простая сортировка номеров уроков
-									for i := 0; i < len(lessonNumbers); i++ {
-										for j := i + 1; j < len(lessonNumbers); j++ {
-											num1, _ := strconv.Atoi(lessonNumbers[i])
-											num2, _ := strconv.Atoi(lessonNumbers[j])
-											if num1 > num2 {
-												lessonNumbers[i], lessonNumbers[j] = lessonNumbers[j], lessonNumbers[i]
-											}
-										}
-									}
-
-									// Отображаем уроки
-									for _, lessonNum := range lessonNumbers {
-										if lessonData, exists := items[lessonNum]; exists {
-											if lesson, ok := lessonData.(map[string]interface{}); ok {
-												name, _ := lesson["name"].(string)
-												teacher, _ := lesson["teacher"].(string)
-												room, _ := lesson["room"].(string)
-												starttime, _ := lesson["starttime"].(string)
-												endtime, _ := lesson["endtime"].(string)
-
-												diaryText.WriteString(fmt.Sprintf("   %s. %s", lessonNum, name))
-
-												if teacher != "" {
-													diaryText.WriteString(fmt.Sprintf("\n      👨‍🏫 %s", teacher))
-												}
-
-												if room != "" && room != " " {
-													diaryText.WriteString(fmt.Sprintf("\n      🏫 Кабинет %s", room))
-												}
-
-												if starttime != "" && endtime != "" {
-													diaryText.WriteString(fmt.Sprintf("\n      ⏰ %s - %s", starttime, endtime))
-												}
-
-												// Проверяем домашнее задание
-												if homeworkData, ok := lesson["homework"]; ok {
-													if homework, ok := homeworkData.(map[string]interface{}); ok && len(homework) > 0 {
-														diaryText.WriteString("\n      📝 ДЗ:")
-														for _, hwData := range homework {
-															if hw, ok := hwData.(map[string]interface{}); ok {
-																if value, ok := hw["value"].(string); ok && value != "" {
-																	diaryText.WriteString(fmt.Sprintf(" %s", value))
-																}
-															}
-														}
-													}
-												}
-
-												diaryText.WriteString("\n")
-											}
-										}
-									}
-									diaryText.WriteString("\n")
-								}
-							}
+			title := day.Title
+			if title == "" {
+				title = formatDateRu(day.Date)
+			}
+			diaryText.WriteString(fmt.Sprintf("📅 <b>%s</b>\n", html.EscapeString(title)))
+
+			// Проверяем есть ли праздник
+			switch day.Alert {
+			case "holiday":
+				if day.HolidayName != "" {
+					diaryText.WriteString(fmt.Sprintf("   🎉 %s\n", html.EscapeString(day.HolidayName)))
+				}
+			case "today":
+				diaryText.WriteString("   📍 Сегодня\n")
+			}
+
+			if !day.HasLessons() {
+				diaryText.WriteString("   Уроков нет\n\n")
+				continue
+			}
+
+			hasLessons = true
+
+			// Все данные Эльжур экранируются: сообщение отправляется в режиме HTML
+			for _, lesson := range day.SortedLessons() {
+				diaryText.WriteString(fmt.Sprintf("   %s. %s", html.EscapeString(lesson.Number), html.EscapeString(lesson.Name)))
+
+				if lesson.Teacher != "" {
+					diaryText.WriteString(fmt.Sprintf("\n      👨‍🏫 %s", html.EscapeString(lesson.Teacher)))
+				}
+
+				if lesson.Room != "" {
+					diaryText.WriteString(fmt.Sprintf("\n      🏫 Кабинет %s", html.EscapeString(lesson.Room)))
+				}
+
+				if ring := lesson.RingTime(); ring != "" {
+					diaryText.WriteString(fmt.Sprintf("\n      ⏰ %s", html.EscapeString(ring)))
+				}
+
+				// Проверяем домашнее задание
+				if homework := lesson.HomeworkList(); len(homework) > 0 {
+					diaryText.WriteString("\n      📝 ДЗ:")
+					for _, hw := range homework {
+						if hw.Value != "" {
+							diaryText.WriteString(fmt.Sprintf(" %s", html.EscapeString(hw.Value)))
+						}
+						for _, file := range hw.Files {
+							diaryText.WriteString(fmt.Sprintf("\n      📎 %s", html.EscapeString(file.FileName)))
 						}
 					}
-					if !ok {
-						diaryText.WriteString("📝 Ошибка обработки данных студентов")
-						return nil
+				}
+
+				// Оценки за урок
+				if len(lesson.Marks) > 0 {
+					var values []string
+					for _, mark := range lesson.Marks {
+						values = append(values, html.EscapeString(mark.Value))
 					}
+					diaryText.WriteString(fmt.Sprintf("\n      📊 Оценки: %s", strings.Join(values, ", ")))
 				}
+
+				for _, file := range lesson.Files {
+					diaryText.WriteString(fmt.Sprintf("\n      📎 %s", html.EscapeString(file.FileName)))
+				}
+
+				diaryText.WriteString("\n")
 			}
+			diaryText.WriteString("\n")
 		}
+	}
 
-		if !hasLessons {
-			diaryText.WriteString("📝 Уроков на этой неделе нет")
-			return nil
-		}
+	if len(students) > 0 && !hasLessons {
+		diaryText.WriteString("📝 Уроков на этой неделе нет")
+	}
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Выбрать другую неделю", "diary"),
-				tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
-			),
-		)
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Выбрать другую неделю", "diary"),
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
 
-		if err := b.SendMessage(user.ChatID, diaryText.String(), keyboard); err != nil {
-			return err
-		}
-		return nil
-	}
-	return nil
+	return b.reply(user, diaryText.String(), keyboard)
 }
 
 // isDate проверяет, является ли строка датой в формате YYYYMMDD
@@ -779,85 +519,58 @@ func isDate(s string) bool {
 
 // handlePeriods обрабатывает просмотр периодов
 func (b *Bot) handlePeriods(user *UserState) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
-	}
-
-	periods, err := user.Client.GetPeriods(true, false)
+	periods, err := user.Client.StudyPeriods(user.ctx)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения периодов: %v", err), nil)
-	}
-
-	if len(periods.Response.Result.Students) == 0 {
-		return b.SendMessage(user.ChatID, "❌ Не найдены данные о студенте", nil)
+		return b.replyEljurError(user, "Ошибка получения периодов", err)
 	}
 
-	student := periods.Response.Result.Students[0]
 	text := "📅 <b>Учебные периоды:</b>\n\n"
 
-	for _, period := range student.Periods {
+	for _, period := range periods {
 		status := "✅"
 		if period.Disabled {
 			status = "⏸"
 		}
 
-		text += fmt.Sprintf("%s <b>%s</b>\n", status, period.FullName)
+		text += fmt.Sprintf("%s <b>%s</b>\n", status, period.Title())
 		startFormatted := formatDateRu(period.Start)
 		endFormatted := formatDateRu(period.End)
 		text += fmt.Sprintf("   📅 %s - %s\n", startFormatted, endFormatted)
 		text += fmt.Sprintf("   📊 Недель: %d\n\n", len(period.Weeks))
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // handleMessages обрабатывает просмотр сообщений
 func (b *Bot) handleMessages(user *UserState) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
-	}
-
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📥 Входящие", "msg_inbox"),
-			tgbotapi.NewInlineKeyboardButtonData("📤 Отправленные", "msg_sent"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("📥 Входящие", "msg_inbox"),
+			NewButton("📤 Отправленные", "msg_sent"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✍️ Написать сообщение", "msg_compose"),
+		NewRow(
+			NewButton("✍️ Написать сообщение", "msg_compose"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, "💬 <b>Сообщения</b>\n\nВыберите действие:", keyboard)
-}
-
-// handleMessageAction обрабатывает действия с сообщениями
-func (b *Bot) handleMessageAction(user *UserState, action string) error {
-	switch action {
-	case "msg_inbox":
-		return b.showMessages(user, "inbox")
-	case "msg_sent":
-		return b.showMessages(user, "sent")
-	case "msg_compose":
-		return b.startComposeMessage(user)
-	default:
-		return b.SendMessage(user.ChatID, "❌ Неизвестное действие", nil)
-	}
+	return b.reply(user, "💬 <b>Сообщения</b>\n\nВыберите действие:", keyboard)
 }
 
 // showMessages показывает список сообщений как интерактивные кнопки
 func (b *Bot) showMessages(user *UserState, folder string) error {
-	messages, err := user.Client.GetMessages(folder)
+	messages, err := user.Client.GetMessages(user.ctx, folder)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения сообщений: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения сообщений", err)
 	}
 
 	folderName := "📥 Входящие"
@@ -866,7 +579,7 @@ func (b *Bot) showMessages(user *UserState, folder string) error {
 	}
 
 	text := fmt.Sprintf("💬 <b>%s сообщения:</b>\n\nНажмите на сообщение для просмотра:", folderName)
-	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var keyboard Keyboard
 
 	if len(messages.Response.Result.Messages) == 0 {
 		text += "\n\n<i>Сообщений нет</i>"
@@ -902,58 +615,52 @@ func (b *Bot) showMessages(user *UserState, folder string) error {
 
 			// Создаем кнопку для каждого сообщения
 			buttonText := fmt.Sprintf("%s %s\n👤 %s", readStatus, subject, sender)
-			callbackData := fmt.Sprintf("msg_read_%s_%s", folder, msg.ID)
+			callbackData := user.encodeCallback("msg_read", Params{"folder": folder, "id": msg.ID})
 
-			button := tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData)
-			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{button})
+			button := NewButton(buttonText, callbackData)
+			keyboard = append(keyboard, []Button{button})
 		}
 	}
 
 	// Добавляем кнопки управления
-	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", fmt.Sprintf("msg_%s", folder)),
-		tgbotapi.NewInlineKeyboardButtonData("🗑 Очистить чат", "clear_chat"),
+	keyboard = append(keyboard, []Button{
+		NewButton("🔄 Обновить", fmt.Sprintf("msg_%s", folder)),
+		NewButton("🗑 Очистить чат", "clear_chat"),
 	})
-	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "messages"),
+	keyboard = append(keyboard, []Button{
+		NewButton("🔙 Назад", "messages"),
 	})
 
-	return b.SendMessage(user.ChatID, text, tgbotapi.NewInlineKeyboardMarkup(keyboard...))
+	return b.reply(user, text, NewKeyboard(keyboard...))
 }
 
-// handleClearChat очищает чат
+// handleClearChat удаляет из чата сообщения бота, которые он запомнил
 func (b *Bot) handleClearChat(user *UserState) error {
-	// Отправляем множество пустых сообщений чтобы "очистить" чат
-	for i := 0; i < 20; i++ {
-		_ = b.SendMessage(user.ChatID, ".", nil)
+	for _, messageID := range user.BotMessageIDs {
+		// Сообщения старше 48 часов Telegram удалить не даст - пропускаем их
+		_ = b.Messenger.Delete(user.ChatID, messageID)
 	}
+	user.BotMessageIDs = nil
+	user.editMessageID = 0
 
-	return b.SendMessage(user.ChatID, "🗑 <b>Чат очищен</b>\n\nВыберите действие:",
-		tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+	return b.send(user, "🗑 <b>Чат очищен</b>\n\nВыберите действие:",
+		NewKeyboard(
+			NewRow(
+				NewButton("🏠 Главное меню", "start"),
 			),
 		))
 }
 
 // handleReadMessage показывает содержимое сообщения
-func (b *Bot) handleReadMessage(user *UserState, data string) error {
-	parts := strings.Split(data, "_")
-	if len(parts) < 4 {
-		return b.SendMessage(user.ChatID, "❌ Ошибка открытия сообщения", nil)
-	}
-
-	folder := parts[2]
-	messageID := parts[3]
-
+func (b *Bot) handleReadMessage(user *UserState, folder, messageID string) error {
 	// Получаем детали сообщения
-	msgDetails, err := user.Client.GetMessageDetails(messageID)
+	msgDetails, err := user.Client.GetMessageDetails(user.ctx, messageID)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения сообщения: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения сообщения", err)
 	}
 
 	if msgDetails.Response.State != 200 {
-		return b.SendMessage(user.ChatID, "❌ Сообщение не найдено", nil)
+		return b.reply(user, "❌ Сообщение не найдено", nil)
 	}
 
 	message := msgDetails.Response.Result.Message
@@ -1007,40 +714,36 @@ func (b *Bot) handleReadMessage(user *UserState, data string) error {
 		"📝 Сообщение:\n%s",
 		from, subject, date, text)
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 К сообщениям", fmt.Sprintf("msg_%s", folder)),
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 К сообщениям", fmt.Sprintf("msg_%s", folder)),
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, messageText, keyboard)
+	return b.reply(user, messageText, keyboard)
 }
 
 // handleSelectRecipient обрабатывает выбор получателя для нового сообщения
-func (b *Bot) handleSelectRecipient(user *UserState, data string) error {
-	parts := strings.Split(data, "_")
-	if len(parts) < 3 {
-		return b.SendMessage(user.ChatID, "❌ Ошибка выбора получателя", nil)
+func (b *Bot) handleSelectRecipient(user *UserState, recipientID string) error {
+	if err := user.setState(StateComposeSubject); err != nil {
+		return err
 	}
+	user.Compose.RecipientID = recipientID
 
-	recipientID := parts[2]
-	user.TempRecipient = recipientID
-	user.State = "message_compose_subject"
-
-	return b.SendMessage(user.ChatID, "✍️ <b>Новое сообщение</b>\n\n📝 Введите тему сообщения:", nil)
+	return b.reply(user, "✍️ <b>Новое сообщение</b>\n\n📝 Введите тему сообщения:", nil)
 }
 
 // startComposeMessage начинает создание сообщения с выбором получателя
 func (b *Bot) startComposeMessage(user *UserState) error {
 	// Получаем список получателей
-	receivers, err := user.Client.GetMessageReceivers()
+	receivers, err := user.Client.GetMessageReceivers(user.ctx)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения получателей: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения получателей", err)
 	}
 
 	text := "✍️ <b>Написать сообщение</b>\n\nВыберите получателя:"
-	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var keyboard Keyboard
 	receiversFound := false
 
 	// Проверяем различные варианты структуры ответа
@@ -1059,10 +762,10 @@ func (b *Bot) startComposeMessage(user *UserState) error {
 					name := fmt.Sprintf("%v", receiver["name"])
 
 					buttonText := fmt.Sprintf("👤 %s", name)
-					callbackData := fmt.Sprintf("compose_to_%s", id)
+					callbackData := user.encodeCallback("compose_to", Params{"id": id})
 
-					button := tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData)
-					keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{button})
+					button := NewButton(buttonText, callbackData)
+					keyboard = append(keyboard, []Button{button})
 					receiversFound = true
 				}
 			}
@@ -1088,10 +791,10 @@ func (b *Bot) startComposeMessage(user *UserState) error {
 									name := fmt.Sprintf("%v", receiver["name"])
 
 									buttonText := fmt.Sprintf("👤 %s", name)
-									callbackData := fmt.Sprintf("compose_to_%s", id)
+									callbackData := user.encodeCallback("compose_to", Params{"id": id})
 
-									button := tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData)
-									keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{button})
+									button := NewButton(buttonText, callbackData)
+									keyboard = append(keyboard, []Button{button})
 									receiversFound = true
 								}
 							}
@@ -1104,47 +807,47 @@ func (b *Bot) startComposeMessage(user *UserState) error {
 	}
 
 	if !receiversFound {
-		return b.SendMessage(user.ChatID, "❌ Нет доступных получателей", nil)
+		return b.reply(user, "❌ Нет доступных получателей", nil)
 	}
 
-	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "messages"),
+	keyboard = append(keyboard, []Button{
+		NewButton("🔙 Назад", "messages"),
 	})
 
-	return b.SendMessage(user.ChatID, text, tgbotapi.NewInlineKeyboardMarkup(keyboard...))
+	return b.reply(user, text, NewKeyboard(keyboard...))
 }
 
 // handleMessageSubject обрабатывает ввод темы сообщения
 func (b *Bot) handleMessageSubject(user *UserState, subject string) error {
-	user.TempLogin = subject // Временно используем для хранения темы
-	user.State = "message_compose_text"
-	return b.SendMessage(user.ChatID, "📝 Теперь введите текст сообщения:", nil)
+	if err := user.setState(StateComposeText); err != nil {
+		return err
+	}
+	user.Compose.Subject = subject
+	return b.reply(user, "📝 Теперь введите текст сообщения:", nil)
 }
 
 // handleMessageText обрабатывает ввод текста сообщения
 func (b *Bot) handleMessageText(user *UserState, text string) error {
-	subject := user.TempLogin
-	recipientID := user.TempRecipient
+	subject := user.Compose.Subject
+	recipientID := user.Compose.RecipientID
 
 	// Очищаем временные данные
-	user.TempLogin = ""
-	user.TempRecipient = ""
-	user.State = "idle"
+	user.resetState()
 
 	if recipientID == "" {
-		return b.SendMessage(user.ChatID, "❌ Получатель не выбран", nil)
+		return b.reply(user, "❌ Получатель не выбран", nil)
 	}
 
 	// Отправляем сообщение выбранному получателю
 	recipients := []string{recipientID}
 
-	_, err := user.Client.SendMessage(recipients, subject, text)
+	_, err := user.Client.SendMessage(user.ctx, recipients, subject, text)
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка отправки сообщения: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка отправки сообщения", err)
 	}
 
 	// Получаем информацию о получателе для отображения
-	receivers, err := user.Client.GetMessageReceivers()
+	receivers, err := user.Client.GetMessageReceivers(user.ctx)
 	recipientName := recipientID
 	if err == nil {
 		result := receivers.Response.Result
@@ -1165,125 +868,159 @@ func (b *Bot) handleMessageText(user *UserState, text string) error {
 		}
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✍️ Написать еще", "msg_compose"),
-			tgbotapi.NewInlineKeyboardButtonData("📥 К сообщениям", "messages"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("✍️ Написать еще", "msg_compose"),
+			NewButton("📥 К сообщениям", "messages"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, fmt.Sprintf("✅ <b>Сообщение отправлено!</b>\n\n👤 Получатель: %s\n📝 Тема: %s", recipientName, subject), keyboard)
+	return b.reply(user, fmt.Sprintf("✅ <b>Сообщение отправлено!</b>\n\n👤 Получатель: %s\n📝 Тема: %s", recipientName, subject), keyboard)
 }
 
-// handleSchedule обрабатывает просмотр расписания
+// handleSchedule обрабатывает просмотр расписания на текущую неделю
 func (b *Bot) handleSchedule(user *UserState) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
+	week, err := user.Client.CurrentWeek(user.ctx, time.Now())
+	if err != nil {
+		return b.replyEljurError(user, "Ошибка получения периодов", err)
 	}
 
-	schedule, err := user.Client.GetSchedule("", "")
+	return b.showSchedule(user, week)
+}
+
+// showSchedule показывает расписание на неделю с навигацией по неделям
+func (b *Bot) showSchedule(user *UserState, week eljur.Week) error {
+	schedule, err := user.Client.GetSchedule(user.ctx, week.Days(), "")
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения расписания: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения расписания", err)
 	}
 
-	text := "📋 <b>Расписание занятий:</b>\n\n"
+	user.CurrentWeek = week.Days()
+
+	text := fmt.Sprintf("📋 <b>Расписание занятий</b>\n📅 %s - %s\n%s\n", formatDateRu(week.Start), formatDateRu(week.End), activeStudentLine(user))
 
-	if len(schedule.Response.Result.Students) == 0 {
+	if student := schedule.Student(user.Client.GetStudentID()); student == nil {
 		text += "<i>Расписание не найдено</i>"
 	} else {
-		student := schedule.Response.Result.Students[0]
 		for _, day := range student.Days {
 			// Преобразуем дату в читабьый формат
 			dayFormatted := formatDateRu(day.Date)
-			text += fmt.Sprintf("📅 <b>%s</b>\n", dayFormatted)
+			text += fmt.Sprintf("📅 <b>%s</b>\n", html.EscapeString(dayFormatted))
 
 			if len(day.Lessons) == 0 {
 				text += "   <i>Занятий нет</i>\n\n"
 				continue
 			}
 
+			// Все данные Эльжур экранируются: сообщение отправляется в режиме HTML
 			for _, lesson := range day.Lessons {
-				text += fmt.Sprintf("   %d. <b>%s</b>\n", lesson.Number, lesson.Name)
+				text += fmt.Sprintf("   %d. <b>%s</b>\n", lesson.Number, html.EscapeString(lesson.Name))
 				if lesson.Teacher != "" {
-					text += fmt.Sprintf("      👨‍🏫 %s\n", lesson.Teacher)
+					text += fmt.Sprintf("      👨‍🏫 %s\n", html.EscapeString(lesson.Teacher))
 				}
 				if lesson.Room != "" {
-					text += fmt.Sprintf("      🏫 Кабинет %s\n", lesson.Room)
+					text += fmt.Sprintf("      🏫 Кабинет %s\n", html.EscapeString(lesson.Room))
 				}
 				if lesson.Time != "" {
-					text += fmt.Sprintf("      ⏰ %s\n", lesson.Time)
+					text += fmt.Sprintf("      ⏰ %s\n", html.EscapeString(lesson.Time))
 				}
 			}
 			text += "\n"
 		}
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
-		),
-	)
+	// Навигация по неделям
+	var navigation []Button
+	if prev, ok := user.Client.ShiftWeek(user.ctx, week, -1); ok {
+		navigation = append(navigation, NewButton("⬅️ Пред. неделя", scheduleCallback(user, prev)))
+	}
+	if next, ok := user.Client.ShiftWeek(user.ctx, week, 1); ok {
+		navigation = append(navigation, NewButton("След. неделя ➡️", scheduleCallback(user, next)))
+	}
+
+	var keyboard Keyboard
+	if len(navigation) > 0 {
+		keyboard = append(keyboard, navigation)
+	}
+	keyboard = append(keyboard, []Button{
+		NewButton("📍 Текущая неделя", "schedule"),
+		NewButton("🏠 Главное меню", "start"),
+	})
+
+	return b.reply(user, text, NewKeyboard(keyboard...))
+}
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+// scheduleCallback формирует callback data для недели расписания
+func scheduleCallback(user *UserState, week eljur.Week) string {
+	return user.encodeCallback("schedule_week", Params{"start": week.Start, "end": week.End})
 }
 
 // handleMarks обрабатывает просмотр оценок
 func (b *Bot) handleMarks(user *UserState) error {
-	if !user.Client.IsAuthenticated() {
-		return b.SendMessage(user.ChatID, "⚠️ Сначала необходимо авторизоваться через /login", nil)
+	periods, err := user.Client.StudyPeriods(user.ctx)
+	if err != nil {
+		return b.replyEljurError(user, "Ошибка получения периодов", err)
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("1️⃣ I четверть", "period_1"),
-			tgbotapi.NewInlineKeyboardButtonData("2️⃣ II четверть", "period_2"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("3️⃣ III четверть", "period_3"),
-			tgbotapi.NewInlineKeyboardButtonData("4️⃣ IV четверть", "period_4"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📊 За весь год", "period_year"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
-		),
+	// Кнопки строим из периодов, которые есть в школе (четверти, триместры, полугодия)
+	var keyboard Keyboard
+	now := time.Now()
+
+	for i, period := range periods {
+		if i%2 == 0 {
+			keyboard = append(keyboard, []Button{})
+		}
+
+		title := period.Title()
+		if period.Contains(now) {
+			title = "📍 " + title
+		}
+
+		button := NewButton(title, user.encodeCallback("period", Params{"period": period.Name}))
+		keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+	}
+
+	keyboard = append(keyboard,
+		[]Button{
+			NewButton("📊 За весь год", "period_year"),
+		},
+		[]Button{
+			NewButton("🏠 Главное меню", "start"),
+		},
 	)
 
-	return b.SendMessage(user.ChatID, "📊 *Выберите период для просмотра оценок:*", keyboard)
+	return b.reply(user, "📊 <b>Выберите период для просмотра оценок:</b>", NewKeyboard(keyboard...))
 }
 
 // handlePeriodSelect обрабатывает выбор периода для оценок
-func (b *Bot) handlePeriodSelect(user *UserState, data string) error {
-	var period int
+func (b *Bot) handlePeriodSelect(user *UserState, name string) error {
+	var marks *eljur.MarksResponse
 	var periodName string
+	var err error
 
-	switch data {
-	case "period_1":
-		period = 1
-		periodName = "I четверть"
-	case "period_2":
-		period = 2
-		periodName = "II четверть"
-	case "period_3":
-		period = 3
-		periodName = "III четверть"
-	case "period_4":
-		period = 4
-		periodName = "IV четверть"
-	case "period_year":
-		period = 0 // За весь год
+	// Пустое имя - оценки за весь год
+	if name == "" {
+		start, end, rangeErr := user.Client.YearRange(user.ctx)
+		if rangeErr != nil {
+			return b.reply(user, fmt.Sprintf("❌ Ошибка получения периодов: %v", rangeErr), nil)
+		}
 		periodName = "Весь учебный год"
-	default:
-		return b.SendMessage(user.ChatID, "❌ Неизвестный период", nil)
+		marks, err = user.Client.GetMarks(user.ctx, "", start, end)
+	} else {
+		period, findErr := user.Client.FindPeriod(user.ctx, name)
+		if findErr != nil {
+			return b.reply(user, "❌ Неизвестный период", nil)
+		}
+		periodName = period.Title()
+		user.CurrentPeriod = period.Name
+		marks, err = user.Client.GetMarks(user.ctx, period.Name, "", "")
 	}
 
-	marks, err := user.Client.GetMarks(period, "", "")
 	if err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка получения оценок: %v", err), nil)
+		return b.replyEljurError(user, "Ошибка получения оценок", err)
 	}
 
 	return b.formatMarks(user, marks, periodName)
@@ -1291,25 +1028,23 @@ func (b *Bot) handlePeriodSelect(user *UserState, data string) error {
 
 // formatMarks форматирует и отправляет оценки
 func (b *Bot) formatMarks(user *UserState, marks *eljur.MarksResponse, periodName string) error {
-	text := fmt.Sprintf("📊 <b>Оценки - %s:</b>\n\n", periodName)
+	text := fmt.Sprintf("📊 <b>Оценки - %s:</b>\n%s\n", html.EscapeString(periodName), activeStudentLine(user))
 
-	if len(marks.Response.Result.Students) == 0 {
+	if student := marks.Student(user.Client.GetStudentID()); student == nil {
 		text += "<i>Оценки не найдены</i>"
 	} else {
-		student := marks.Response.Result.Students[0]
-
 		if len(student.Subjects) == 0 {
 			text += "<i>Оценки отсутствуют за выбранный период</i>"
 		} else {
 			for _, subject := range student.Subjects {
-				text += fmt.Sprintf("📚 <b>%s</b>\n", subject.Name)
+				text += fmt.Sprintf("📚 <b>%s</b>\n", html.EscapeString(subject.Name))
 
 				if len(subject.Marks) == 0 {
 					text += "   <i>Оценок нет</i>\n\n"
 				} else {
 					text += "   "
 					for _, mark := range subject.Marks {
-						text += fmt.Sprintf("[%s] ", mark.Value)
+						text += fmt.Sprintf("[%s] ", html.EscapeString(mark.Value))
 					}
 
 					// Вычисляем средний балл (упрощенно)
@@ -1332,22 +1067,22 @@ func (b *Bot) formatMarks(user *UserState, marks *eljur.MarksResponse, periodNam
 		}
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Выбрать период", "marks"),
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Выбрать период", "marks"),
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // handleGemini обрабатывает главное меню Gemini
 func (b *Bot) handleGemini(user *UserState) error {
 	var text string
-	var keyboard tgbotapi.InlineKeyboardMarkup
+	var keyboard Keyboard
 
-	if user.GeminiAPIKey == "" {
+	if !user.assistantReady() {
 		text = "🤖 *Gemini AI Ассистент*\n\n" +
 			"⚠️ API ключ не настроен!\n\n" +
 			"🔧 Для использования Gemini AI необходимо:\n" +
@@ -1360,46 +1095,122 @@ func (b *Bot) handleGemini(user *UserState) error {
 			"• Искать материалы для изучения\n" +
 			"• Анализировать учебную информацию"
 
-		keyboard = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔧 Настроить API", "gemini_setup"),
+		rows := Keyboard{
+			NewRow(
+				NewButton("🔧 Настроить API", "gemini_setup"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("📖 Инструкция", "gemini_help"),
+			NewRow(
+				NewButton("📖 Инструкция", "gemini_help"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Главное меню", "start"),
-			),
-		)
-	} else {
-		modelName := user.GeminiModel
-		if modelName == "" {
-			modelName = "gemini-1.5-flash"
 		}
+		if llm.OpenAIConfigured() {
+			rows = append(rows, NewRow(
+				NewButton("🖥 Использовать модель сервера", "gemini_provider_"+llm.ProviderOpenAI),
+			))
+		}
+		rows = append(rows, NewRow(
+			NewButton("🔙 Главное меню", "start"),
+		))
+		keyboard = NewKeyboard(rows...)
+	} else {
+		var settingsRow []Button
+		if user.LLMProvider == llm.ProviderOpenAI {
+			text = "🤖 <b>AI Ассистент</b>\n\n" +
+				fmt.Sprintf("🖥 Провайдер: %s\n\n", html.EscapeString(user.assistantName())) +
+				"Выберите действие:"
+			settingsRow = NewRow(
+				NewButton("🔌 Провайдер", "gemini_provider"),
+			)
+		} else {
+			modelName := user.GeminiModel
+			if modelName == "" {
+				modelName = "gemini-1.5-flash"
+			}
 
-		text = "🤖 <b>Gemini AI Ассистент</b>\n\n" +
-			fmt.Sprintf("✅ API ключ настроен\n🧠 Модель: %s\n\n", modelName) +
-			"Выберите действие:"
+			text = "🤖 <b>Gemini AI Ассистент</b>\n\n" +
+				fmt.Sprintf("✅ API ключ настроен\n🧠 Модель: %s\n\n", modelName) +
+				"Выберите действие:"
+			settingsRow = NewRow(
+				NewButton("🔧 Сменить модель", "gemini_model_select"),
+				NewButton("⚙️ Настройки", "gemini_setup"),
+			)
+		}
 
-		keyboard = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("💬 Задать вопрос", "gemini_chat"),
-			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("📚 Помощь с ДЗ", "gemini_context_homework"),
-				tgbotapi.NewInlineKeyboardButtonData("📖 Объяснить тему", "gemini_context_explain"),
+		rows := Keyboard{
+			NewRow(
+				NewButton("💬 Задать вопрос", "gemini_chat"),
+				NewButton("🆕 Новый чат", "gemini_new_chat"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔧 Сменить модель", "gemini_model_select"),
-				tgbotapi.NewInlineKeyboardButtonData("⚙️ Настройки", "gemini_setup"),
+			NewRow(
+				NewButton("📚 Помощь с ДЗ", "gemini_context_homework"),
+				NewButton("📖 Объяснить тему", "gemini_context_explain"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Главное меню", "start"),
-			),
-		)
+			settingsRow,
+		}
+		if llm.OpenAIConfigured() && user.LLMProvider != llm.ProviderOpenAI {
+			rows = append(rows, NewRow(
+				NewButton("🔌 Провайдер", "gemini_provider"),
+			))
+		}
+		rows = append(rows, NewRow(
+			NewButton("🔙 Главное меню", "start"),
+		))
+		keyboard = NewKeyboard(rows...)
+	}
+
+	return b.reply(user, text, keyboard)
+}
+
+// handleGeminiProvider показывает выбор провайдера AI или переключает его
+func (b *Bot) handleGeminiProvider(user *UserState, provider string) error {
+	switch provider {
+	case llm.ProviderGemini:
+		user.LLMProvider = llm.ProviderGemini
+		if user.GeminiAPIKey == "" {
+			return b.handleGeminiSetup(user)
+		}
+		return b.handleGemini(user)
+	case llm.ProviderOpenAI:
+		if !llm.OpenAIConfigured() {
+			return b.reply(user, "❌ Модель сервера не настроена.", nil)
+		}
+		user.LLMProvider = llm.ProviderOpenAI
+		return b.handleGemini(user)
+	}
+
+	current := llm.ProviderGemini
+	if user.LLMProvider == llm.ProviderOpenAI {
+		current = llm.ProviderOpenAI
+	}
+
+	type providerOption struct {
+		id    string
+		title string
+	}
+	options := []providerOption{
+		{llm.ProviderGemini, "✨ Google Gemini (нужен свой API ключ)"},
+	}
+	if provider, err := llm.NewOpenAIFromEnv(); err == nil {
+		options = append(options, providerOption{llm.ProviderOpenAI, "🖥 " + provider.Name()})
 	}
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	var keyboard Keyboard
+	for _, option := range options {
+		title := option.title
+		if option.id == current {
+			title = "✅ " + title
+		}
+		keyboard = append(keyboard, NewRow(
+			NewButton(title, "gemini_provider_"+option.id),
+		))
+	}
+	keyboard = append(keyboard, NewRow(
+		NewButton("🔙 Назад", "gemini"),
+	))
+
+	text := "🔌 <b>Выберите провайдера AI:</b>\n\n" +
+		"Модель сервера настраивает администратор бота, свой API ключ для нее не нужен."
+	return b.reply(user, text, NewKeyboard(keyboard...))
 }
 
 // handleGeminiSetup обрабатывает настройку Gemini
@@ -1411,20 +1222,20 @@ func (b *Bot) handleGeminiSetup(user *UserState) error {
 			fmt.Sprintf("🧠 Модель: %s\n\n", user.GeminiModel) +
 			"Выберите действие:"
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔄 Сменить API ключ", "gemini_change_key"),
-				tgbotapi.NewInlineKeyboardButtonData("🧠 Сменить модель", "gemini_model_select"),
+		keyboard := NewKeyboard(
+			NewRow(
+				NewButton("🔄 Сменить API ключ", "gemini_change_key"),
+				NewButton("🧠 Сменить модель", "gemini_model_select"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("❌ Удалить настройки", "gemini_reset"),
+			NewRow(
+				NewButton("❌ Удалить настройки", "gemini_reset"),
 			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
+			NewRow(
+				NewButton("🔙 Назад", "gemini"),
 			),
 		)
 
-		return b.SendMessage(user.ChatID, text, keyboard)
+		return b.reply(user, text, keyboard)
 	}
 
 	// Показываем инструкцию по получению API ключа
@@ -1438,15 +1249,17 @@ func (b *Bot) handleGeminiSetup(user *UserState) error {
 		"⚠️ <b>Важно:</b> Никому не передавайте свой API ключ!\n\n" +
 		"🔑 Введите ваш API ключ:"
 
-	user.State = "gemini_api_setup"
+	if err := user.setState(StateGeminiAPISetup); err != nil {
+		return err
+	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Отмена", "gemini"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Отмена", "gemini"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // handleGeminiAPISetup обрабатывает ввод API ключа
@@ -1454,58 +1267,39 @@ func (b *Bot) handleGeminiAPISetup(user *UserState, apiKey string) error {
 	apiKey = strings.TrimSpace(apiKey)
 
 	if len(apiKey) < 10 {
-		return b.SendMessage(user.ChatID, "❌ API ключ слишком короткий. Попробуйте еще раз:", nil)
+		return b.reply(user, "❌ API ключ слишком короткий. Попробуйте еще раз:", nil)
 	}
 
 	// Проверяем валидность ключа
 	testClient := gemini.NewClient(apiKey, "gemini-1.5-flash")
-	if err := testClient.ValidateAPIKey(); err != nil {
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Неверный API ключ: %v\n\nПопробуйте еще раз:", err), nil)
+	if err := testClient.ValidateAPIKey(user.ctx); err != nil {
+		return b.reply(user, fmt.Sprintf("❌ Неверный API ключ: %v\n\nПопробуйте еще раз:", err), nil)
 	}
 
 	user.GeminiAPIKey = apiKey
 	user.GeminiModel = "gemini-1.5-flash" // Модель по умолчанию
-	user.State = "idle"
+	user.resetState()
 
 	text := "✅ <b>API ключ успешно сохранен!</b>\n\n" +
 		"🧠 Выбрана модель: gemini-1.5-flash\n\n" +
 		"Теперь вы можете использовать Gemini AI для помощи с учебой!"
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🤖 Использовать Gemini", "gemini"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🤖 Использовать Gemini", "gemini"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // handleGeminiModelSelect показывает выбор модели
-func (b *Bot) handleGeminiModelSelect(user *UserState, data string) error {
-	if strings.HasPrefix(data, "gemini_model_") && data != "gemini_model_select" {
-		// Выбор конкретной модели
-		model := strings.TrimPrefix(data, "gemini_model_")
-		user.GeminiModel = model
-
-		description := gemini.GetModelDescription(model)
-		text := fmt.Sprintf("✅ <b>Модель изменена!</b>\n\n🧠 Выбрана: %s\n%s", model, description)
-
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("💬 Попробовать", "gemini_chat"),
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
-			),
-		)
-
-		return b.SendMessage(user.ChatID, text, keyboard)
-	}
-
-	// Показ списка моделей
+func (b *Bot) handleGeminiModelSelect(user *UserState) error {
 	text := "🧠 <b>Выберите модель Gemini:</b>\n\n"
-	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var keyboard Keyboard
 
 	for _, model := range gemini.GetAvailableModels() {
 		description := gemini.GetModelDescription(model)
@@ -1515,177 +1309,334 @@ func (b *Bot) handleGeminiModelSelect(user *UserState, data string) error {
 		}
 
 		buttonText := fmt.Sprintf("%s%s", model, current)
-		callbackData := fmt.Sprintf("gemini_model_%s", model)
+		callbackData := user.encodeCallback("gemini_model", Params{"model": model})
 
-		button := tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData)
-		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{button})
+		button := NewButton(buttonText, callbackData)
+		keyboard = append(keyboard, []Button{button})
 
 		text += fmt.Sprintf("%s\n\n", description)
 	}
 
-	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
+	keyboard = append(keyboard, []Button{
+		NewButton("🔙 Назад", "gemini"),
 	})
 
-	return b.SendMessage(user.ChatID, text, tgbotapi.NewInlineKeyboardMarkup(keyboard...))
+	return b.reply(user, text, NewKeyboard(keyboard...))
+}
+
+// handleGeminiModelSet сохраняет выбранную модель Gemini
+func (b *Bot) handleGeminiModelSet(user *UserState, model string) error {
+	user.GeminiModel = model
+
+	description := gemini.GetModelDescription(model)
+	text := fmt.Sprintf("✅ <b>Модель изменена!</b>\n\n🧠 Выбрана: %s\n%s", model, description)
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("💬 Попробовать", "gemini_chat"),
+			NewButton("🔙 Назад", "gemini"),
+		),
+	)
+
+	return b.reply(user, text, keyboard)
 }
 
-// handleGeminiContextSelect обрабатывает выбор контекста
-func (b *Bot) handleGeminiContextSelect(user *UserState, data string) error {
+// handleGeminiContextSelect обрабатывает выбор контекста (gemini_context_<name>)
+func (b *Bot) handleGeminiContextSelect(user *UserState, name string) error {
 	context := ""
 	contextName := ""
 
-	switch data {
-	case "gemini_context_homework":
+	switch name {
+	case "homework_free":
 		context = "Ты помощник по домашнему заданию. Помоги найти информацию, объясни сложные темы, предложи ресурсы для изучения."
 		contextName = "Помощь с домашним заданием"
-	case "gemini_context_explain":
+	case "explain":
 		context = "Ты учитель-объяснитель. Объясни тему простым языком, приведи примеры, дай ссылки на полезные видео и материалы."
 		contextName = "Объяснение темы"
 	default:
-		context = "Ты помощник ученика. Отвечай на вопросы, помогай с учебой."
+		context = defaultGeminiContext
 		contextName = "Общий чат"
 	}
 
+	// Новый контекст - новый диалог
 	user.GeminiContext = context
-	user.State = "gemini_chat"
+	user.resetGeminiHistory()
+	if err := user.setState(StateGeminiChat); err != nil {
+		return err
+	}
 
 	text := fmt.Sprintf("🤖 <b>%s</b>\n\n💭 Введите ваш вопрос:", contextName)
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Назад", "gemini"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
+}
+
+// handleGeminiHomework показывает домашние задания на ближайшие дни для выбора
+func (b *Bot) handleGeminiHomework(user *UserState) error {
+	if !user.assistantReady() {
+		return b.reply(user, "⚠️ Сначала необходимо настроить Gemini AI через /gemini", nil)
+	}
+
+	freeButton := NewButton("✏️ Свой вопрос по ДЗ", "gemini_context_homework_free")
+	backButton := NewButton("🔙 Назад", "gemini")
+
+	if user.Client == nil || !user.Client.IsAuthenticated() {
+		keyboard := NewKeyboard(
+			NewRow(freeButton),
+			NewRow(backButton),
+		)
+		return b.reply(user, "📚 <b>Помощь с ДЗ</b>\n\n"+
+			"Чтобы Gemini видел ваши задания из дневника, авторизуйтесь через /login.\n"+
+			"Или задайте вопрос по заданию своими словами.", keyboard)
+	}
+
+	assignments, err := user.Client.UpcomingHomework(user.ctx, time.Now())
+	if err != nil {
+		return b.replyEljurError(user, "Ошибка получения домашних заданий", err)
+	}
+
+	if len(assignments) == 0 {
+		keyboard := NewKeyboard(
+			NewRow(freeButton),
+			NewRow(backButton),
+		)
+		return b.reply(user, "📚 <b>Помощь с ДЗ</b>\n\nНа ближайшую неделю домашних заданий нет 🎉", keyboard)
+	}
+
+	// Ограничиваем количество кнопок
+	maxAssignments := 15
+	if len(assignments) > maxAssignments {
+		assignments = assignments[:maxAssignments]
+	}
+
+	var keyboard Keyboard
+	for _, assignment := range assignments {
+		label := fmt.Sprintf("%s · %s", formatShortDate(assignment.Date), assignment.Subject)
+		keyboard = append(keyboard, NewRow(
+			NewButton(label, user.encodeCallback("gemini_hw", Params{"key": assignment.Key()})),
+		))
+	}
+	keyboard = append(keyboard,
+		NewRow(freeButton),
+		NewRow(backButton),
+	)
+
+	text := "📚 <b>Помощь с ДЗ</b>\n\nВыберите задание, с которым нужна помощь:"
+	return b.reply(user, text, NewKeyboard(keyboard...))
+}
+
+// handleGeminiHomeworkSelect начинает чат с Gemini по выбранному домашнему заданию
+func (b *Bot) handleGeminiHomeworkSelect(user *UserState, key string) error {
+	if !user.assistantReady() {
+		return b.reply(user, "⚠️ Сначала необходимо настроить Gemini AI через /gemini", nil)
+	}
+
+	assignment, err := user.Client.GetAssignment(user.ctx, key)
+	if err != nil {
+		return b.replyEljurError(user, "Не удалось найти задание", err)
+	}
+
+	// Новое задание - новый диалог
+	user.GeminiContext = homeworkContext(assignment)
+	user.resetGeminiHistory()
+	if err := user.setState(StateGeminiChat); err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	text.WriteString("📚 <b>Помощь с ДЗ</b>\n\n")
+	text.WriteString(fmt.Sprintf("📖 <b>%s</b>\n", html.EscapeString(assignment.Subject)))
+	text.WriteString(fmt.Sprintf("📅 Срок: %s\n", formatDateRu(assignment.Date)))
+	if assignment.Text != "" {
+		text.WriteString(fmt.Sprintf("📝 %s\n", html.EscapeString(assignment.Text)))
+	}
+	for _, name := range assignment.FileNames() {
+		text.WriteString(fmt.Sprintf("📎 %s\n", html.EscapeString(name)))
+	}
+	text.WriteString("\n💭 Задайте вопрос по заданию:")
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("📚 Другое задание", "gemini_context_homework"),
+			NewButton("🔙 Назад", "gemini"),
+		),
+	)
+
+	return b.reply(user, text.String(), keyboard)
+}
+
+// homeworkContext формирует системную инструкцию Gemini для конкретного задания
+func homeworkContext(assignment *eljur.Assignment) string {
+	var context strings.Builder
+	context.WriteString("Ты помощник ученика по домашнему заданию. ")
+	context.WriteString("Помогай разобраться с заданием: объясняй ход решения и теорию, наводи на ответ, не выдавай готовое решение без объяснений.\n\n")
+	context.WriteString(fmt.Sprintf("Предмет: %s\n", assignment.Subject))
+	context.WriteString(fmt.Sprintf("Срок сдачи: %s (урок %s)\n", formatDateRu(assignment.Date), assignment.Lesson))
+	if assignment.Text != "" {
+		context.WriteString(fmt.Sprintf("Задание: %s\n", assignment.Text))
+	}
+	if names := assignment.FileNames(); len(names) > 0 {
+		context.WriteString(fmt.Sprintf("Прикрепленные файлы (содержимое недоступно): %s\n", strings.Join(names, ", ")))
+	}
+	return context.String()
+}
+
+// formatShortDate преобразует дату из формата YYYYMMDD в "DD.MM"
+func formatShortDate(dateStr string) string {
+	if len(dateStr) != 8 {
+		return dateStr
+	}
+	return dateStr[6:8] + "." + dateStr[4:6]
 }
 
 // handleGeminiChatStart начинает чат с Gemini
 func (b *Bot) handleGeminiChatStart(user *UserState) error {
-	if user.GeminiAPIKey == "" {
-		return b.SendMessage(user.ChatID, "❌ Сначала настройте API ключ через /gemini_setup", nil)
+	if !user.assistantReady() {
+		return b.reply(user, "❌ Сначала настройте API ключ через /gemini_setup", nil)
 	}
 
-	user.State = "gemini_chat"
-	user.GeminiContext = "Ты помощник ученика. Отвечай на вопросы, помогай с учебой."
+	if err := user.setState(StateGeminiChat); err != nil {
+		return err
+	}
+	if user.GeminiContext == "" {
+		user.GeminiContext = defaultGeminiContext
+	}
+
+	// Продолжаем существующий диалог
+	if len(user.GeminiHistory) > 0 {
+		text := fmt.Sprintf("🤖 <b>Чат с Gemini AI</b>\n\n💬 Продолжаем диалог (сообщений в истории: %d).\n\n", len(user.GeminiHistory)) +
+			"💭 Задайте следующий вопрос или начните новый чат."
+
+		keyboard := NewKeyboard(
+			NewRow(
+				NewButton("🆕 Новый чат", "gemini_new_chat"),
+				NewButton("🔙 Назад", "gemini"),
+			),
+		)
+
+		return b.reply(user, text, keyboard)
+	}
 
 	text := "🤖 <b>Чат с Gemini AI</b>\n\n💭 Задайте ваш вопрос:\n\n" +
 		"<i>Примеры:</i>\n" +
 		"• Объясни что такое квадратные уравнения\n" +
 		"• Найди информацию о Великой Отечественной войне\n" +
 		"• Помоги решить задачу по физике\n" +
-		"• Дай ссылки на видео по алгебре"
+		"• Дай ссылки на видео по алгебре\n\n" +
+		"📷 Можно отправить фото задания - с подписью-вопросом или без."
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Назад", "gemini"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
+}
+
+// handleGeminiNewChat очищает историю диалога и начинает новый чат
+func (b *Bot) handleGeminiNewChat(user *UserState) error {
+	if !user.assistantReady() {
+		return b.reply(user, "⚠️ Сначала необходимо настроить Gemini AI через /gemini", nil)
+	}
+
+	user.resetGeminiHistory()
+	user.GeminiContext = defaultGeminiContext
+	if err := user.setState(StateGeminiChat); err != nil {
+		return err
+	}
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔙 Меню Gemini", "gemini"),
+		),
+	)
+
+	return b.reply(user, "🆕 <b>История диалога очищена</b>\n\n💭 Задайте ваш вопрос:", keyboard)
 }
 
 // handleGeminiChat обрабатывает сообщения в чате с Gemini
 func (b *Bot) handleGeminiChat(user *UserState, message string) error {
-	if user.GeminiAPIKey == "" {
-		return b.SendMessage(user.ChatID, "❌ API ключ не настроен. Используйте /gemini_setup", nil)
+	if !user.assistantReady() {
+		return b.reply(user, "❌ API ключ не настроен. Используйте /gemini_setup", nil)
 	}
 
 	// Проверяем валидность сообщения
 	if len(strings.TrimSpace(message)) == 0 {
-		return b.SendMessage(user.ChatID, "❌ Пожалуйста, введите вопрос", nil)
+		return b.reply(user, "❌ Пожалуйста, введите вопрос", nil)
 	}
 
 	// Отправляем сообщение о том, что обрабатываем запрос
-	processingMsg := tgbotapi.NewMessage(user.ChatID, "🤔 Gemini думает...")
-	sentMsg, _ := b.API.Send(processingMsg)
-
-	// Создаем клиент Gemini
-	client := gemini.NewClient(user.GeminiAPIKey, user.GeminiModel)
+	done := b.showProgress(user.ChatID, "🤔 Gemini думает...")
 
-	// Отправляем сообщение в Gemini
-	response, err := client.SendMessage(message, user.GeminiContext)
+	// Отправляем сообщение модели с учетом истории диалога
+	response, err := b.askAssistant(user, message)
 
 	// Удаляем сообщение "думает"
-	if sentMsg.MessageID != 0 {
-		deleteMsg := tgbotapi.NewDeleteMessage(user.ChatID, sentMsg.MessageID)
-		b.API.Send(deleteMsg)
-	}
+	done()
 
 	if err != nil {
-		user.State = "idle"
-		return b.SendMessage(user.ChatID, fmt.Sprintf("❌ Ошибка Gemini: %v\n\nПопробуйте еще раз или проверьте API ключ.", err), nil)
+		user.resetState()
+		return b.reply(user, fmt.Sprintf("❌ Ошибка %s: %v\n\nПопробуйте еще раз или проверьте настройки в /gemini.", user.assistantName(), err), nil)
 	}
 
-	// Очищаем ответ от потенциально проблемных символов
-	response = strings.ReplaceAll(response, "\u0000", "")
-	response = strings.ReplaceAll(response, "`", "'")   // Заменяем обратные кавычки
-	response = strings.ReplaceAll(response, "*", "\\*") // Экранируем звездочки
-	response = strings.ReplaceAll(response, "_", "\\_") // Экранируем подчеркивания
-	response = strings.ReplaceAll(response, "[", "\\[") // Экранируем квадратные скобки
-	response = strings.ReplaceAll(response, "]", "\\]")
-	response = strings.TrimSpace(response)
-
-	if response == "" {
-		return b.SendMessage(user.ChatID, "❌ Gemini вернул пустой ответ. Попробуйте переформулировать вопрос.", nil)
-	}
-
-	// Проверяем длину ответа и разбиваем на части если нужно
-	maxLength := 3900 // Оставляем место для заголовка и кнопок
-
-	if len(response) <= maxLength {
-		// Ответ помещается в одно сообщение
-		text := fmt.Sprintf("🤖 <b>Gemini AI:</b>\n\n%s", response)
-
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("💬 Продолжить чат", "gemini_chat"),
-			),
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔙 Меню Gemini", "gemini"),
-				tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
-			),
-		)
-
-		return b.SendMessage(user.ChatID, text, keyboard)
-	} else {
-		// Разбиваем ответ на части
-		parts := splitMessage(response, maxLength-100) // Оставляем место для заголовка части
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("💬 Продолжить чат", "gemini_chat"),
+		),
+		NewRow(
+			NewButton("🔙 Меню Gemini", "gemini"),
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
 
-		for i, part := range parts {
-			var text string
-			var keyboard tgbotapi.InlineKeyboardMarkup
+	return b.sendGeminiReply(user, response, keyboard)
+}
 
-			if i == 0 {
-				text = fmt.Sprintf("🤖 <b>Gemini AI</b> (часть %d/%d):\n\n%s", i+1, len(parts), part)
-			} else {
-				text = fmt.Sprintf("🤖 <b>Продолжение</b> (часть %d/%d):\n\n%s", i+1, len(parts), part)
-			}
+// sendGeminiReply преобразует Markdown-ответ модели в HTML и отправляет его,
+// при необходимости разбивая на части. Кнопки добавляются к последней части.
+func (b *Bot) sendGeminiReply(user *UserState, response string, keyboard Keyboard) error {
+	formatted := render.MarkdownToHTML(response)
+	if formatted == "" {
+		return b.reply(user, "❌ Модель вернула пустой ответ. Попробуйте переформулировать вопрос.", nil)
+	}
+
+	parts := render.SplitHTML(formatted, maxGeminiReplyLength)
+	name := user.assistantName()
+
+	for i, part := range parts {
+		var text string
+		switch {
+		case len(parts) == 1:
+			text = fmt.Sprintf("🤖 <b>%s:</b>\n\n%s", html.EscapeString(name), part)
+		case i == 0:
+			text = fmt.Sprintf("🤖 <b>%s</b> (часть %d/%d):\n\n%s", html.EscapeString(name), i+1, len(parts), part)
+		default:
+			text = fmt.Sprintf("🤖 <b>Продолжение</b> (часть %d/%d):\n\n%s", i+1, len(parts), part)
+		}
 
-			// Добавляем кнопки только к последней части
-			if i == len(parts)-1 {
-				keyboard = tgbotapi.NewInlineKeyboardMarkup(
-					tgbotapi.NewInlineKeyboardRow(
-						tgbotapi.NewInlineKeyboardButtonData("💬 Продолжить чат", "gemini_chat"),
-					),
-					tgbotapi.NewInlineKeyboardRow(
-						tgbotapi.NewInlineKeyboardButtonData("🔙 Меню Gemini", "gemini"),
-						tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
-					),
-				)
-			}
+		// Добавляем кнопки только к последней части
+		var markup Keyboard
+		if i == len(parts)-1 {
+			markup = keyboard
+		}
 
-			if err := b.SendMessage(user.ChatID, text, keyboard); err != nil {
-				return err
-			}
+		if err := b.reply(user, text, markup); err != nil {
+			return err
+		}
 
+		if i < len(parts)-1 {
 			// Небольшая задержка между сообщениями
 			time.Sleep(500 * time.Millisecond)
 		}
-
-		return nil
 	}
+
+	return nil
 }
 
 // handleGeminiHelp показывает инструкцию по использованию Gemini
@@ -1703,23 +1654,24 @@ func (b *Bot) handleGeminiHelp(user *UserState) error {
 		"• Объяснение сложных тем\n" +
 		"• Поиск учебных материалов\n" +
 		"• Ссылки на обучающие видео\n" +
-		"• Решение задач и примеров\n\n" +
+		"• Решение задач и примеров\n" +
+		"• Разбор заданий по фото\n\n" +
 		"💡 <b>Примеры вопросов:</b>\n" +
 		"• «Объясни теорему Пифагора»\n" +
 		"• «Найди видео про квадратные уравнения»\n" +
 		"• «Помоги с задачей по химии»\n" +
 		"• «Что такое митоз в биологии?»"
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔧 Настроить API", "gemini_setup"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔧 Настроить API", "gemini_setup"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Назад", "gemini"),
+		NewRow(
+			NewButton("🔙 Назад", "gemini"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // handleGeminiReset сбрасывает настройки Gemini
@@ -1727,21 +1679,23 @@ func (b *Bot) handleGeminiReset(user *UserState) error {
 	user.GeminiAPIKey = ""
 	user.GeminiModel = ""
 	user.GeminiContext = ""
-	user.State = "idle"
+	user.LLMProvider = ""
+	user.resetGeminiHistory()
+	user.resetState()
 
 	text := "🗑 <b>Настройки Gemini сброшены</b>\n\n" +
 		"Все данные удалены. Для повторного использования необходимо заново настроить API ключ."
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔧 Настроить заново", "gemini_setup"),
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔧 Настроить заново", "gemini_setup"),
 		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Главное меню", "start"),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
 		),
 	)
 
-	return b.SendMessage(user.ChatID, text, keyboard)
+	return b.reply(user, text, keyboard)
 }
 
 // min возвращает минимальное из двух чисел
@@ -0,0 +1,81 @@
+package bot
+
+import "errors"
+
+// ErrNotModified возвращается Edit, если новое содержимое совпадает с текущим
+var ErrNotModified = errors.New("сообщение не изменилось")
+
+// Messenger доставляет сообщения пользователю. Обработчики бота работают только
+// через этот интерфейс, поэтому транспорт (Telegram, терминал, тестовый) можно заменить,
+// не меняя логику обработчиков. Тексты сообщений передаются в HTML разметке Telegram.
+type Messenger interface {
+	// Send отправляет сообщение и возвращает его ID
+	Send(chatID int64, text string, keyboard Keyboard) (int, error)
+	// Edit заменяет текст и клавиатуру ранее отправленного сообщения.
+	// Если содержимое не изменилось, возвращает ErrNotModified.
+	Edit(chatID int64, messageID int, text string, keyboard Keyboard) error
+	// Delete удаляет сообщение
+	Delete(chatID int64, messageID int) error
+	// AnswerCallback подтверждает нажатие на кнопку, text показывается как уведомление
+	AnswerCallback(callbackID, text string) error
+	// SendDocument отправляет файл с подписью и возвращает ID сообщения
+	SendDocument(chatID int64, name string, data []byte, caption string) (int, error)
+	// SendPhoto отправляет изображение с подписью и возвращает ID сообщения
+	SendPhoto(chatID int64, name string, data []byte, caption string) (int, error)
+	// DownloadFile скачивает файл из входящего сообщения, ограничивая размер maxSize байтами
+	DownloadFile(fileID string, maxSize int) ([]byte, error)
+}
+
+// Button представляет кнопку inline клавиатуры
+type Button struct {
+	Text string
+	Data string // callback данные
+	URL  string // ссылка (вместо callback данных)
+}
+
+// Keyboard представляет inline клавиатуру: ряды кнопок
+type Keyboard [][]Button
+
+// NewButton создает кнопку с callback данными
+func NewButton(text, data string) Button {
+	return Button{Text: text, Data: data}
+}
+
+// NewURLButton создает кнопку-ссылку
+func NewURLButton(text, url string) Button {
+	return Button{Text: text, URL: url}
+}
+
+// NewRow создает ряд кнопок
+func NewRow(buttons ...Button) []Button {
+	return buttons
+}
+
+// NewKeyboard создает клавиатуру из рядов кнопок
+func NewKeyboard(rows ...[]Button) Keyboard {
+	return rows
+}
+
+// Attachment описывает файл во входящем сообщении
+type Attachment struct {
+	FileID   string
+	MimeType string
+	FileSize int
+}
+
+// IncomingMessage представляет входящее сообщение пользователя независимо от транспорта
+type IncomingMessage struct {
+	ChatID    int64
+	MessageID int
+	Text      string
+	Caption   string      // подпись к вложению
+	Image     *Attachment // изображение (фото или документ-картинка), если есть
+}
+
+// IncomingCallback представляет нажатие на кнопку inline клавиатуры
+type IncomingCallback struct {
+	ID        string
+	ChatID    int64
+	MessageID int // сообщение, под которым нажата кнопка
+	Data      string
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// htmlTagPattern находит HTML теги для вывода сообщений в терминал
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// CLIMessenger выводит сообщения бота в терминал. Используется для локальной отладки
+// обработчиков без Telegram (BOT_TRANSPORT=cli).
+//
+// Ввод в Run:
+//   - номер кнопки под последним сообщением - нажатие на кнопку;
+//   - "/photo путь [подпись]" - отправка изображения из файла;
+//   - любой другой текст - обычное сообщение.
+type CLIMessenger struct {
+	out io.Writer
+
+	mu              sync.Mutex
+	lastMessageID   int
+	buttons         []Button // кнопки последнего сообщения с клавиатурой
+	buttonMessageID int      // ID сообщения с этими кнопками
+}
+
+// NewCLIMessenger создает транспорт, выводящий сообщения в out
+func NewCLIMessenger(out io.Writer) *CLIMessenger {
+	return &CLIMessenger{out: out}
+}
+
+// Send выводит сообщение и его клавиатуру
+func (c *CLIMessenger) Send(chatID int64, text string, keyboard Keyboard) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastMessageID++
+	fmt.Fprintf(c.out, "\n── #%d ──\n%s\n", c.lastMessageID, plainText(text))
+	c.printKeyboard(c.lastMessageID, keyboard)
+	return c.lastMessageID, nil
+}
+
+// Edit выводит новую версию сообщения
+func (c *CLIMessenger) Edit(chatID int64, messageID int, text string, keyboard Keyboard) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.out, "\n── #%d (изменено) ──\n%s\n", messageID, plainText(text))
+	if messageID == c.buttonMessageID {
+		c.buttons = nil
+	}
+	c.printKeyboard(messageID, keyboard)
+	return nil
+}
+
+// Delete сообщает об удалении сообщения
+func (c *CLIMessenger) Delete(chatID int64, messageID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.out, "(сообщение #%d удалено)\n", messageID)
+	if messageID == c.buttonMessageID {
+		c.buttons = nil
+	}
+	return nil
+}
+
+// AnswerCallback выводит уведомление, если оно есть
+func (c *CLIMessenger) AnswerCallback(callbackID, text string) error {
+	if text == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.out, "ℹ️ %s\n", text)
+	return nil
+}
+
+// SendDocument сохраняет файл во временный каталог и выводит путь к нему
+func (c *CLIMessenger) SendDocument(chatID int64, name string, data []byte, caption string) (int, error) {
+	return c.sendFile("📎", name, data, caption)
+}
+
+// SendPhoto сохраняет изображение во временный каталог и выводит путь к нему
+func (c *CLIMessenger) SendPhoto(chatID int64, name string, data []byte, caption string) (int, error) {
+	return c.sendFile("🖼", name, data, caption)
+}
+
+// DownloadFile читает локальный файл: в терминальном режиме fileID - это путь к файлу
+func (c *CLIMessenger) DownloadFile(fileID string, maxSize int) ([]byte, error) {
+	file, err := os.Open(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("файл слишком большой")
+	}
+	return data, nil
+}
+
+// Run читает ввод пользователя построчно и передает его боту, пока ввод не закончится
+func (c *CLIMessenger) Run(ctx context.Context, b *Bot, chatID int64, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	messageID := 0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		messageID++
+
+		var err error
+		if button, source, ok := c.button(line); ok {
+			err = b.HandleCallback(ctx, IncomingCallback{ID: strconv.Itoa(messageID), ChatID: chatID, MessageID: source, Data: button.Data})
+		} else {
+			err = b.HandleMessage(ctx, c.message(chatID, messageID, line))
+		}
+
+		if err != nil {
+			c.mu.Lock()
+			fmt.Fprintf(c.out, "⚠️ Ошибка обработки: %v\n", err)
+			c.mu.Unlock()
+		}
+	}
+
+	return scanner.Err()
+}
+
+// button возвращает кнопку последнего сообщения по ее номеру и ID этого сообщения
+func (c *CLIMessenger) button(line string) (Button, int, bool) {
+	number, err := strconv.Atoi(line)
+	if err != nil {
+		return Button{}, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if number < 1 || number > len(c.buttons) || c.buttons[number-1].Data == "" {
+		return Button{}, 0, false
+	}
+	return c.buttons[number-1], c.buttonMessageID, true
+}
+
+// message создает входящее сообщение из строки ввода
+func (c *CLIMessenger) message(chatID int64, messageID int, line string) IncomingMessage {
+	message := IncomingMessage{ChatID: chatID, MessageID: messageID, Text: line}
+
+	args, ok := strings.CutPrefix(line, "/photo ")
+	if !ok {
+		return message
+	}
+
+	path, caption, _ := strings.Cut(strings.TrimSpace(args), " ")
+	image := &Attachment{FileID: path, MimeType: mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))}
+	if info, err := os.Stat(path); err == nil {
+		image.FileSize = int(info.Size())
+	}
+
+	return IncomingMessage{ChatID: chatID, MessageID: messageID, Caption: caption, Image: image}
+}
+
+// sendFile сохраняет файл во временный каталог и выводит путь к нему
+func (c *CLIMessenger) sendFile(icon, name string, data []byte, caption string) (int, error) {
+	file, err := os.CreateTemp("", "diary-*-"+filepath.Base(name))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastMessageID++
+	fmt.Fprintf(c.out, "\n── #%d ──\n%s %s (%d байт): %s\n", c.lastMessageID, icon, name, len(data), file.Name())
+	if caption != "" {
+		fmt.Fprintln(c.out, plainText(caption))
+	}
+	return c.lastMessageID, nil
+}
+
+// printKeyboard выводит кнопки сообщения с номерами и запоминает их. Вызывается под c.mu.
+func (c *CLIMessenger) printKeyboard(messageID int, keyboard Keyboard) {
+	if len(keyboard) == 0 {
+		return
+	}
+
+	c.buttons = nil
+	c.buttonMessageID = messageID
+	for _, row := range keyboard {
+		labels := make([]string, 0, len(row))
+		for _, button := range row {
+			c.buttons = append(c.buttons, button)
+			label := fmt.Sprintf("[%d] %s", len(c.buttons), button.Text)
+			if button.URL != "" {
+				label += " (" + button.URL + ")"
+			}
+			labels = append(labels, label)
+		}
+		fmt.Fprintln(c.out, "  "+strings.Join(labels, "   "))
+	}
+}
+
+// plainText убирает HTML разметку для вывода в терминал
+func plainText(text string) string {
+	return html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+}
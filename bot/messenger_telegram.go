@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TelegramMessenger доставляет сообщения через Telegram Bot API
+type TelegramMessenger struct {
+	API *tgbotapi.BotAPI
+
+	fileEndpoint string // шаблон адреса для скачивания файлов (токен, путь)
+	httpClient   *http.Client
+}
+
+// NewTelegramMessenger создает транспорт Telegram для токена бота
+func NewTelegramMessenger(token string) (*TelegramMessenger, error) {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Отключаем debug в production для лучшей производительности
+	api.Debug = false
+
+	return &TelegramMessenger{
+		API:          api,
+		fileEndpoint: tgbotapi.FileEndpoint,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Send отправляет сообщение с HTML разметкой
+func (t *TelegramMessenger) Send(chatID int64, text string, keyboard Keyboard) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "HTML" // Используем HTML вместо Markdown для лучшей совместимости
+	if markup := telegramKeyboard(keyboard); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+
+	sent, err := t.API.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// Edit редактирует сообщение
+func (t *TelegramMessenger) Edit(chatID int64, messageID int, text string, keyboard Keyboard) error {
+	msg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = telegramKeyboard(keyboard)
+
+	_, err := t.API.Send(msg)
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "message is not modified") {
+		return ErrNotModified
+	}
+	return err
+}
+
+// Delete удаляет сообщение
+func (t *TelegramMessenger) Delete(chatID int64, messageID int) error {
+	_, err := t.API.Request(tgbotapi.NewDeleteMessage(chatID, messageID))
+	return err
+}
+
+// AnswerCallback отвечает на callback query
+func (t *TelegramMessenger) AnswerCallback(callbackID, text string) error {
+	_, err := t.API.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+// SendDocument отправляет файл
+func (t *TelegramMessenger) SendDocument(chatID int64, name string, data []byte, caption string) (int, error) {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	doc.ParseMode = "HTML"
+
+	sent, err := t.API.Send(doc)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// SendPhoto отправляет изображение
+func (t *TelegramMessenger) SendPhoto(chatID int64, name string, data []byte, caption string) (int, error) {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	photo.Caption = caption
+	photo.ParseMode = "HTML"
+
+	sent, err := t.API.Send(photo)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// DownloadFile скачивает файл из Telegram, ограничивая размер maxSize байтами
+func (t *TelegramMessenger) DownloadFile(fileID string, maxSize int) ([]byte, error) {
+	file, err := t.API.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+	url := fmt.Sprintf(t.fileEndpoint, t.API.Token, file.FilePath)
+
+	resp, err := t.httpClient.Get(url)
+	if err != nil {
+		// URL содержит токен бота, поэтому не выводим исходную ошибку
+		return nil, fmt.Errorf("ошибка загрузки файла")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка загрузки файла: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла")
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("файл слишком большой")
+	}
+
+	return data, nil
+}
+
+// telegramKeyboard преобразует клавиатуру в формат Bot API (nil для пустой клавиатуры)
+func telegramKeyboard(keyboard Keyboard) *tgbotapi.InlineKeyboardMarkup {
+	if len(keyboard) == 0 {
+		return nil
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(keyboard))
+	for _, row := range keyboard {
+		buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, button := range row {
+			if button.URL != "" {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL))
+			} else {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(button.Text, button.Data))
+			}
+		}
+		rows = append(rows, buttons)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// TelegramMessage преобразует сообщение Bot API во входящее сообщение бота
+func TelegramMessage(message *tgbotapi.Message) IncomingMessage {
+	return IncomingMessage{
+		ChatID:    message.Chat.ID,
+		MessageID: message.MessageID,
+		Text:      message.Text,
+		Caption:   message.Caption,
+		Image:     telegramImage(message),
+	}
+}
+
+// TelegramCallback преобразует callback query Bot API в нажатие на кнопку
+func TelegramCallback(query *tgbotapi.CallbackQuery) IncomingCallback {
+	callback := IncomingCallback{ID: query.ID, Data: query.Data}
+	if query.Message != nil {
+		callback.ChatID = query.Message.Chat.ID
+		callback.MessageID = query.Message.MessageID
+	} else if query.From != nil {
+		// Для сообщений inline режима Telegram не присылает сообщение, отвечаем в личный чат
+		callback.ChatID = query.From.ID
+	}
+	return callback
+}
+
+// telegramImage возвращает изображение из сообщения: самое большое фото
+// или документ-картинку. Возвращает nil, если изображений нет.
+func telegramImage(message *tgbotapi.Message) *Attachment {
+	if len(message.Photo) > 0 {
+		// Telegram присылает размеры по возрастанию, последний - самый большой
+		photo := message.Photo[len(message.Photo)-1]
+		return &Attachment{FileID: photo.FileID, MimeType: "image/jpeg", FileSize: photo.FileSize}
+	}
+
+	if doc := message.Document; doc != nil && strings.HasPrefix(doc.MimeType, "image/") {
+		return &Attachment{FileID: doc.FileID, MimeType: doc.MimeType, FileSize: doc.FileSize}
+	}
+
+	return nil
+}
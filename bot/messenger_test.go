@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+	"school-diary-bot/bot/telegramtest"
+)
+
+func TestCLIMessengerRun(t *testing.T) {
+	s := newScenario(t)
+
+	var out bytes.Buffer
+	cli := NewCLIMessenger(&out)
+	b := NewBotWithMessenger(cli)
+	b.limiter = nil
+
+	// Кнопка [1] главного меню - "Дневник", [1] выбора недель - первая неделя
+	input := strings.Join([]string{
+		"/login " + eljurtest.DefaultLogin + " " + eljurtest.DefaultPassword,
+		"1",
+		"1",
+	}, "\n")
+	if err := cli.Run(context.Background(), b, testChatID, strings.NewReader(input)); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{"Авторизация успешна", "[1] 📚 Дневник", "Выберите неделю из II четверть", "№ 123, 124"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "<b>") {
+		t.Errorf("output contains HTML tags:\n%s", output)
+	}
+	if got := s.eljur.Requests("getdiary"); len(got) != 1 || got[0].Query.Get("days") != "20241104-20241110" {
+		t.Errorf("getdiary requests = %+v, want first week of II period", got)
+	}
+}
+
+func TestCLIMessengerDownloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task.png")
+	if err := os.WriteFile(path, []byte("png-data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := NewCLIMessenger(&bytes.Buffer{})
+	message := cli.message(testChatID, 1, "/photo "+path+" реши задачу")
+	if message.Image == nil || message.Image.MimeType != "image/png" || message.Image.FileSize != 8 {
+		t.Fatalf("message image = %+v, want png of 8 bytes", message.Image)
+	}
+	if message.Caption != "реши задачу" {
+		t.Errorf("caption = %q, want %q", message.Caption, "реши задачу")
+	}
+
+	data, err := cli.DownloadFile(message.Image.FileID, maxImageSize)
+	if err != nil || string(data) != "png-data" {
+		t.Errorf("DownloadFile() = %q, %v", data, err)
+	}
+	if _, err := cli.DownloadFile(path, 4); err == nil {
+		t.Error("DownloadFile() over maxSize returned no error")
+	}
+}
+
+// newTestTelegramMessenger создает транспорт Telegram, работающий с тестовым сервером Bot API
+func newTestTelegramMessenger(t *testing.T, tg *telegramtest.Server) *TelegramMessenger {
+	t.Helper()
+
+	api, err := tgbotapi.NewBotAPIWithClient(tg.Token, tg.APIEndpoint(), &http.Client{})
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient() error = %v", err)
+	}
+	return &TelegramMessenger{
+		API:          api,
+		fileEndpoint: tg.FileEndpoint(),
+		httpClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func TestTelegramMessenger(t *testing.T) {
+	tg := telegramtest.NewServer()
+	defer tg.Close()
+
+	telegram := newTestTelegramMessenger(t, tg)
+
+	keyboard := NewKeyboard(NewRow(NewButton("📚 Дневник", "diary"), NewURLButton("Сайт", "https://example.org")))
+	id, err := telegram.Send(testChatID, "<b>Меню</b>", keyboard)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	call := tg.LastCall("sendMessage")
+	if call.Params.Get("parse_mode") != "HTML" || !call.HasButton("diary") {
+		t.Errorf("sendMessage params = %v", call.Params)
+	}
+	if buttons := call.Buttons(); len(buttons) != 2 || buttons[1].URL == nil || *buttons[1].URL != "https://example.org" {
+		t.Errorf("buttons = %+v, want data and url buttons", buttons)
+	}
+
+	if err := telegram.Edit(testChatID, id, "Новое меню", nil); err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if message, _ := tg.LastBotMessage(testChatID); message.Text != "Новое меню" || message.Keyboard != nil {
+		t.Errorf("edited message = %+v", message)
+	}
+
+	if _, err := telegram.SendDocument(testChatID, "marks.csv", []byte("a;b"), "Оценки"); err != nil {
+		t.Fatalf("SendDocument() error = %v", err)
+	}
+	if message, _ := tg.LastBotMessage(testChatID); message.File == nil || message.File.Name != "marks.csv" || string(message.File.Data) != "a;b" {
+		t.Errorf("document message = %+v", message)
+	}
+
+	if err := telegram.Delete(testChatID, id); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := telegram.Delete(testChatID, id); err == nil {
+		t.Error("Delete() of deleted message returned no error")
+	}
+
+	tg.AddFile("photo1", []byte("jpeg-data"))
+	data, err := telegram.DownloadFile("photo1", maxImageSize)
+	if err != nil || string(data) != "jpeg-data" {
+		t.Errorf("DownloadFile() = %q, %v", data, err)
+	}
+	if _, err := telegram.DownloadFile("photo1", 4); err == nil {
+		t.Error("DownloadFile() over maxSize returned no error")
+	}
+}
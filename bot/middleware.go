@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitBurst сколько запросов подряд пользователь может отправить без ожидания
+	rateLimitBurst = 20
+	// rateLimitInterval за какое время восстанавливается один запрос
+	rateLimitInterval = time.Second
+	// rateLimitMaxChats после скольких отслеживаемых чатов удаляются неактивные
+	rateLimitMaxChats = 10000
+)
+
+// requireAuth пропускает запрос только для авторизованных в Эльжур пользователей.
+// Если сессия истекла, запрос приостанавливается до ввода пароля.
+func (b *Bot) requireAuth(next HandlerFunc) HandlerFunc {
+	return func(req *Request) error {
+		if req.User.Client == nil || !req.User.Client.IsAuthenticated() {
+			if req.User.expiredLogin != "" {
+				return b.promptReauth(req.User)
+			}
+			return b.reply(req.User, "⚠️ Сначала необходимо авторизоваться через /login", nil)
+		}
+		return next(req)
+	}
+}
+
+// logRequests логирует маршрут и время обработки. Логируется шаблон маршрута,
+// а не исходный текст, чтобы пароли из /login не попадали в логи.
+func (b *Bot) logRequests(next HandlerFunc) HandlerFunc {
+	return func(req *Request) error {
+		started := time.Now()
+		err := next(req)
+
+		route := req.Pattern
+		if route == "" {
+			route = "<не найден>"
+		}
+		attrs := []any{"chat_id", req.User.ChatID, "route", route, "duration", time.Since(started)}
+		if err != nil {
+			slog.Warn("[ROUTE] Ошибка обработчика", append(attrs, "err", err)...)
+		} else {
+			slog.Info("[ROUTE] Запрос обработан", attrs...)
+		}
+		return err
+	}
+}
+
+// recoverPanics превращает панику в обработчике в ошибку и сообщает пользователю о сбое
+func (b *Bot) recoverPanics(next HandlerFunc) HandlerFunc {
+	return func(req *Request) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				slog.Error("[PANIC] Паника в обработчике", "chat_id", req.User.ChatID, "route", req.Pattern, "panic", p, "stack", string(debug.Stack()))
+				b.reply(req.User, "❌ Внутренняя ошибка бота. Попробуйте еще раз позже.", nil)
+				err = fmt.Errorf("паника в обработчике %s: %v", req.Pattern, p)
+			}
+		}()
+		return next(req)
+	}
+}
+
+// rateLimit ограничивает частоту запросов одного пользователя
+func (b *Bot) rateLimit(next HandlerFunc) HandlerFunc {
+	return func(req *Request) error {
+		if b.limiter == nil {
+			return next(req)
+		}
+
+		allowed, warn := b.limiter.allow(req.User.ChatID, time.Now())
+		if allowed {
+			return next(req)
+		}
+		if warn {
+			// Предупреждаем один раз, чтобы ответы на лишние нажатия сами не засоряли чат
+			return b.send(req.User, "⏳ Слишком много запросов. Подождите несколько секунд.", nil)
+		}
+		return nil
+	}
+}
+
+// rateLimiter реализует token bucket для каждого чата
+type rateLimiter struct {
+	burst    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+// bucket хранит оставшиеся запросы пользователя
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	warned  bool
+}
+
+// newRateLimiter создает ограничитель: burst запросов подряд, затем один запрос за interval
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{burst: burst, interval: interval, buckets: make(map[int64]*bucket)}
+}
+
+// allow проверяет, можно ли обработать запрос. warn=true для первого отклоненного
+// запроса подряд, чтобы предупредить пользователя только один раз.
+func (l *rateLimiter) allow(chatID int64, now time.Time) (allowed, warn bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bkt, ok := l.buckets[chatID]
+	if !ok {
+		if len(l.buckets) >= rateLimitMaxChats {
+			l.prune(now)
+		}
+		bkt = &bucket{tokens: float64(l.burst), updated: now}
+		l.buckets[chatID] = bkt
+	}
+
+	bkt.tokens += float64(now.Sub(bkt.updated)) / float64(l.interval)
+	if bkt.tokens > float64(l.burst) {
+		bkt.tokens = float64(l.burst)
+	}
+	bkt.updated = now
+
+	if bkt.tokens >= 1 {
+		bkt.tokens--
+		bkt.warned = false
+		return true, false
+	}
+
+	warn = !bkt.warned
+	bkt.warned = true
+	return false, warn
+}
+
+// prune удаляет чаты, лимит которых уже полностью восстановился. Вызывается под l.mu.
+func (l *rateLimiter) prune(now time.Time) {
+	idle := time.Duration(l.burst) * l.interval
+	for chatID, bkt := range l.buckets {
+		if now.Sub(bkt.updated) >= idle {
+			delete(l.buckets, chatID)
+		}
+	}
+}
+
+// sharedRateLimiter общий для всех экземпляров бота в процессе: в serverless режиме
+// бот создается на каждый запрос, а теплый экземпляр функции сохраняет пакетные переменные
+var sharedRateLimiter = newRateLimiter(rateLimitBurst, rateLimitInterval)
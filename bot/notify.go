@@ -0,0 +1,485 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // часовые пояса для тихих часов в окружениях без zoneinfo
+
+	"school-diary-bot/bot/eljur"
+)
+
+// markChange описывает новую или измененную оценку
+type markChange struct {
+	Key      string // ключ оценки в снимке
+	Student  string // имя и класс ребенка, если их у пользователя несколько
+	Subject  string
+	Value    string
+	OldValue string // пусто для новой оценки
+	Date     string
+	Type     string
+}
+
+// PollNotifications проверяет новые оценки и сообщения у всех подписанных пользователей
+// и отправляет уведомления. Проверка прекращается по истечении дедлайна ctx, запросы
+// к Эльжур в этот момент прерываются; первыми проверяются пользователи, которых
+// проверяли давнее всего. Возвращает количество проверенных пользователей.
+//
+// Подписчики берутся из хранилища сессий, поэтому проверка видит только сессии,
+// доступные этому процессу: в serverless окружении нужно хранилище, общее для
+// webhook и cron функций (см. NewSessionStoreFromEnv). Проверка не продлевает
+// сессию: неактивные пользователи удаляются по SESSION_TTL, даже если подписаны.
+func (b *Bot) PollNotifications(ctx context.Context) (int, error) {
+	sessions, err := globalSessionManager.ListSessions()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения сессий: %w", err)
+	}
+
+	var subscribers []*SessionData
+	for _, session := range sessions {
+		if !session.NotifyMarks && !session.NotifyMessages {
+			continue
+		}
+		if session.EljurAuth != nil && session.EljurAuth.Token != "" {
+			subscribers = append(subscribers, session)
+		}
+	}
+
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].NotifyCheckedAt.Before(subscribers[j].NotifyCheckedAt)
+	})
+
+	checked := 0
+	for _, session := range subscribers {
+		if ctx.Err() != nil {
+			slog.Warn("[NOTIFY] Deadline reached", "checked", checked, "subscribers", len(subscribers))
+			break
+		}
+
+		b.checkUserNotifications(ctx, session.ChatID)
+		checked++
+	}
+
+	return checked, nil
+}
+
+// checkUserNotifications проверяет оценки и входящие сообщения одного пользователя
+func (b *Bot) checkUserNotifications(ctx context.Context, chatID int64) {
+	unlock := b.lockUser(chatID)
+	defer unlock()
+
+	user := b.GetUserStateServerless(ctx, chatID)
+	defer b.SaveUserStateServerless(user)
+
+	user.NotifyCheckedAt = time.Now()
+
+	if !user.Client.IsAuthenticated() {
+		slog.Debug("[NOTIFY] User is not authenticated, skipping", "chat_id", chatID)
+		return
+	}
+
+	// В тихие часы ничего не проверяем: новые события будут отправлены после их окончания
+	if user.inQuietHours(time.Now()) {
+		return
+	}
+
+	if user.NotifyMarks {
+		if err := b.checkUserMarks(user); err != nil {
+			slog.Warn("[NOTIFY] Failed to check marks", "chat_id", chatID, "err", err)
+		}
+	}
+
+	if user.NotifyMessages {
+		if err := b.checkUserMessages(user); err != nil {
+			slog.Warn("[NOTIFY] Failed to check messages", "chat_id", chatID, "err", err)
+		}
+	}
+}
+
+// checkUserMarks сравнивает текущие оценки каждого ребенка пользователя со снимком
+// и отправляет уведомления. Ошибка по одному ребенку не мешает проверить остальных:
+// снимок продвигается только на отправленные уведомления, остальные изменения будут
+// найдены при следующей проверке.
+func (b *Bot) checkUserMarks(user *UserState) error {
+	students := user.Client.Students()
+	if len(students) == 0 {
+		students = []eljur.Student{user.Client.ActiveStudent()}
+	}
+	if user.MarksSnapshots == nil {
+		user.MarksSnapshots = make(map[string]map[string]string)
+	}
+
+	sent := 0
+	for _, student := range students {
+		// Четверти у детей из разных классов могут не совпадать
+		period, err := user.Client.StudentCurrentPeriod(user.ctx, student.ID, time.Now())
+		if err != nil {
+			slog.Warn("[NOTIFY] Failed to get current period", "chat_id", user.ChatID, "student_id", student.ID, "err", err)
+			continue
+		}
+
+		marks, err := user.Client.GetStudentMarks(user.ctx, student.ID, period.Start, period.End)
+		if err != nil {
+			slog.Warn("[NOTIFY] Failed to get marks", "chat_id", user.ChatID, "student_id", student.ID, "err", err)
+			continue
+		}
+
+		var snapshot map[string]string
+		if studentMarks := marks.Student(student.ID); studentMarks != nil {
+			snapshot = marksSnapshot(studentMarks)
+		} else {
+			snapshot = make(map[string]string)
+		}
+
+		// Первая проверка только запоминает текущие оценки
+		previous, known := user.MarksSnapshots[student.ID]
+		if !known {
+			user.MarksSnapshots[student.ID] = snapshot
+			continue
+		}
+
+		count, err := b.sendMarkChanges(user, student, len(students) > 1, previous, snapshot)
+		sent += count
+		if err != nil {
+			slog.Warn("[NOTIFY] Failed to send mark notification", "chat_id", user.ChatID, "student_id", student.ID, "err", err)
+		}
+	}
+
+	if sent > 0 {
+		slog.Info("[NOTIFY] Sent mark notifications", "chat_id", user.ChatID, "count", sent)
+	}
+
+	return nil
+}
+
+// sendMarkChanges отправляет уведомления об изменениях оценок ребенка и возвращает их число.
+// Как и LastSeenMessageID для сообщений, снимок продвигается после каждого отправленного
+// уведомления, поэтому при ошибке отправки неотправленные изменения не теряются.
+func (b *Bot) sendMarkChanges(user *UserState, student eljur.Student, withName bool, previous, current map[string]string) (int, error) {
+	sent := 0
+	advanced := make(map[string]string, len(previous))
+	for key, value := range previous {
+		advanced[key] = value
+	}
+	user.MarksSnapshots[student.ID] = advanced
+
+	for _, change := range diffMarks(previous, current) {
+		if withName {
+			change.Student = student.Label()
+		}
+		if err := b.send(user, formatMarkChange(change), nil); err != nil {
+			return sent, err
+		}
+		advanced[change.Key] = change.Value
+		sent++
+	}
+
+	// Все изменения отправлены: снимок совпадает с текущими оценками, включая удаленные
+	user.MarksSnapshots[student.ID] = current
+	return sent, nil
+}
+
+// checkUserMessages ищет непрочитанные входящие сообщения новее последнего известного
+func (b *Bot) checkUserMessages(user *UserState) error {
+	messages, err := user.Client.GetMessages(user.ctx, "inbox")
+	if err != nil {
+		return err
+	}
+
+	inbox := messages.Response.Result.Messages
+	newest := user.LastSeenMessageID
+	for _, msg := range inbox {
+		if messageIDLess(newest, msg.ID) {
+			newest = msg.ID
+		}
+	}
+
+	// Первая проверка только запоминает последнее сообщение. Она отмечается отдельно:
+	// при пустом ящике LastSeenMessageID остается пустым, и первое сообщение учителя
+	// иначе снова было бы принято за существующее. Сессии, сохраненные до появления
+	// MessagesCheckedAt, уже прошли первую проверку, если знают последнее сообщение.
+	firstCheck := user.MessagesCheckedAt.IsZero() && user.LastSeenMessageID == ""
+	user.MessagesCheckedAt = time.Now()
+	if firstCheck {
+		user.LastSeenMessageID = newest
+		return nil
+	}
+
+	var fresh []eljur.Message
+	for _, msg := range inbox {
+		if !msg.Read && messageIDLess(user.LastSeenMessageID, msg.ID) {
+			fresh = append(fresh, msg)
+		}
+	}
+
+	sort.Slice(fresh, func(i, j int) bool {
+		return messageIDLess(fresh[i].ID, fresh[j].ID)
+	})
+
+	for _, msg := range fresh {
+		text, keyboard := formatMessageAlert(user, msg)
+		if err := b.send(user, text, keyboard); err != nil {
+			return err
+		}
+		user.LastSeenMessageID = msg.ID
+	}
+
+	user.LastSeenMessageID = newest
+
+	if len(fresh) > 0 {
+		slog.Info("[NOTIFY] Sent message alerts", "chat_id", user.ChatID, "count", len(fresh))
+	}
+
+	return nil
+}
+
+// messageIDLess сравнивает ID сообщений численно, если это возможно
+func messageIDLess(a, b string) bool {
+	if a == "" {
+		return b != ""
+	}
+
+	numA, errA := strconv.ParseInt(a, 10, 64)
+	numB, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		return numA < numB
+	}
+
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// formatMessageAlert форматирует уведомление о новом сообщении с кнопкой прочтения
+func formatMessageAlert(user *UserState, msg eljur.Message) (string, Keyboard) {
+	sender := strings.TrimSpace(fmt.Sprintf("%s %s", msg.UserFrom.LastName, msg.UserFrom.FirstName))
+	if sender == "" {
+		sender = msg.UserFrom.Name
+	}
+	if sender == "" {
+		sender = "Неизвестный отправитель"
+	}
+
+	subject := msg.Subject
+	if subject == "" {
+		subject = "Без темы"
+	}
+
+	text := "📩 <b>Новое сообщение</b>\n\n" +
+		fmt.Sprintf("👤 От: %s\n📋 Тема: %s", html.EscapeString(sender), html.EscapeString(subject))
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("📖 Прочитать", user.encodeCallback("msg_read", Params{"folder": "inbox", "id": msg.ID})),
+		),
+	)
+
+	return text, keyboard
+}
+
+// quietHoursPresets варианты тихих часов, доступные в настройках (с, до)
+var quietHoursPresets = [][2]int{
+	{22, 7},
+	{21, 8},
+	{23, 9},
+}
+
+// inQuietHours проверяет, попадает ли время в тихие часы пользователя
+func (u *UserState) inQuietHours(now time.Time) bool {
+	if u.QuietFrom == u.QuietTo {
+		return false
+	}
+
+	hour := now.In(notifyLocation()).Hour()
+	if u.QuietFrom < u.QuietTo {
+		return hour >= u.QuietFrom && hour < u.QuietTo
+	}
+	// Интервал через полночь, например 22-7
+	return hour >= u.QuietFrom || hour < u.QuietTo
+}
+
+// notifyLocation возвращает часовой пояс для тихих часов из BOT_TIMEZONE
+func notifyLocation() *time.Location {
+	name := os.Getenv("BOT_TIMEZONE")
+	if name == "" {
+		name = "Europe/Chisinau"
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("[NOTIFY] Unknown BOT_TIMEZONE, using UTC", "value", name)
+		return time.UTC
+	}
+	return location
+}
+
+// marksSnapshot строит снимок оценок: ключ "предмет|дата|тип|порядковый номер" -> значение
+func marksSnapshot(student *eljur.MarksStudent) map[string]string {
+	snapshot := make(map[string]string)
+
+	for _, subject := range student.Subjects {
+		seen := make(map[string]int)
+		for _, mark := range subject.Marks {
+			base := strings.Join([]string{subject.Name, mark.Date, mark.Type}, "|")
+			key := fmt.Sprintf("%s|%d", base, seen[base])
+			seen[base]++
+			snapshot[key] = mark.Value
+		}
+	}
+
+	return snapshot
+}
+
+// diffMarks возвращает новые и измененные оценки в порядке дат
+func diffMarks(previous, current map[string]string) []markChange {
+	var changes []markChange
+
+	for key, value := range current {
+		oldValue, existed := previous[key]
+		if existed && oldValue == value {
+			continue
+		}
+
+		parts := strings.SplitN(key, "|", 4)
+		if len(parts) < 3 {
+			continue
+		}
+
+		changes = append(changes, markChange{
+			Key:      key,
+			Subject:  parts[0],
+			Date:     parts[1],
+			Type:     parts[2],
+			Value:    value,
+			OldValue: oldValue,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Date != changes[j].Date {
+			return changes[i].Date < changes[j].Date
+		}
+		return changes[i].Subject < changes[j].Subject
+	})
+
+	return changes
+}
+
+// formatMarkChange форматирует уведомление об оценке
+func formatMarkChange(change markChange) string {
+	var text strings.Builder
+
+	if change.OldValue == "" {
+		text.WriteString("🆕 <b>Новая оценка</b>\n\n")
+		text.WriteString(fmt.Sprintf("📚 %s\n📊 Оценка: <b>%s</b>\n", html.EscapeString(change.Subject), html.EscapeString(change.Value)))
+	} else {
+		text.WriteString("✏️ <b>Оценка изменена</b>\n\n")
+		text.WriteString(fmt.Sprintf("📚 %s\n📊 Оценка: %s → <b>%s</b>\n",
+			html.EscapeString(change.Subject), html.EscapeString(change.OldValue), html.EscapeString(change.Value)))
+	}
+
+	if change.Student != "" {
+		text.WriteString(fmt.Sprintf("👤 %s\n", html.EscapeString(change.Student)))
+	}
+
+	if change.Date != "" {
+		text.WriteString(fmt.Sprintf("📅 %s\n", formatDateRu(strings.ReplaceAll(change.Date, "-", ""))))
+	}
+	if change.Type != "" {
+		text.WriteString(fmt.Sprintf("📝 %s\n", html.EscapeString(change.Type)))
+	}
+
+	return text.String()
+}
+
+// handleNotify показывает настройки уведомлений
+func (b *Bot) handleNotify(user *UserState) error {
+	marksStatus := "🔕 выключены"
+	marksToggle := NewButton("🔔 Оценки: включить", "notify_marks_on")
+	if user.NotifyMarks {
+		marksStatus = "🔔 включены"
+		marksToggle = NewButton("🔕 Оценки: выключить", "notify_marks_off")
+	}
+
+	messagesStatus := "🔕 выключены"
+	messagesToggle := NewButton("🔔 Сообщения: включить", "notify_messages_on")
+	if user.NotifyMessages {
+		messagesStatus = "🔔 включены"
+		messagesToggle = NewButton("🔕 Сообщения: выключить", "notify_messages_off")
+	}
+
+	quietStatus := "выключены"
+	if user.QuietFrom != user.QuietTo {
+		quietStatus = fmt.Sprintf("%02d:00 - %02d:00", user.QuietFrom, user.QuietTo)
+	}
+
+	text := "🔔 <b>Уведомления</b>\n\n" +
+		fmt.Sprintf("📊 Новые оценки: %s\n", marksStatus) +
+		fmt.Sprintf("📩 Новые сообщения: %s\n", messagesStatus) +
+		fmt.Sprintf("🌙 Тихие часы: %s\n\n", quietStatus) +
+		"<i>Бот периодически проверяет дневник и присылает сообщение о каждой новой оценке и каждом новом письме. " +
+		"В тихие часы уведомления откладываются до утра.</i>"
+
+	var quietRow []Button
+	for _, preset := range quietHoursPresets {
+		label := fmt.Sprintf("🌙 %d-%d", preset[0], preset[1])
+		if user.QuietFrom == preset[0] && user.QuietTo == preset[1] {
+			label = "✅ " + label
+		}
+		quietRow = append(quietRow, NewButton(label, fmt.Sprintf("notify_quiet_%d_%d", preset[0], preset[1])))
+	}
+
+	keyboard := NewKeyboard(
+		NewRow(marksToggle),
+		NewRow(messagesToggle),
+		quietRow,
+		NewRow(
+			NewButton("☀️ Без тихих часов", "notify_quiet_off"),
+		),
+		NewRow(
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+
+	return b.reply(user, text, keyboard)
+}
+
+// handleNotifyToggle включает или выключает уведомления (notify_<setting>_on/off)
+func (b *Bot) handleNotifyToggle(user *UserState, setting string, enabled bool) error {
+	switch setting {
+	case "marks":
+		user.NotifyMarks = enabled
+		// Снимок будет построен при первой проверке, старые оценки не присылаем
+		user.MarksSnapshots = nil
+	case "messages":
+		user.NotifyMessages = enabled
+		user.LastSeenMessageID = ""
+		user.MessagesCheckedAt = time.Time{}
+	case "quiet":
+		if enabled {
+			return b.reply(user, "❌ Неверные тихие часы", nil)
+		}
+		user.QuietFrom, user.QuietTo = 0, 0
+	default:
+		return b.reply(user, "❌ Неизвестная настройка уведомлений", nil)
+	}
+
+	return b.handleNotify(user)
+}
+
+// handleQuietHours задает тихие часы (notify_quiet_<from>_<to>)
+func (b *Bot) handleQuietHours(user *UserState, from, to int) error {
+	if from < 0 || from > 23 || to < 0 || to > 23 {
+		return b.reply(user, "❌ Неверные тихие часы", nil)
+	}
+	user.QuietFrom, user.QuietTo = from, to
+
+	return b.handleNotify(user)
+}
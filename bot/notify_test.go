@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+)
+
+// poll запускает проверку уведомлений и возвращает тексты отправленных сообщений
+func (s *scenario) poll() []string {
+	s.t.Helper()
+	s.tg.Reset()
+	if _, err := s.bot.PollNotifications(context.Background()); err != nil {
+		s.t.Fatalf("PollNotifications() error = %v", err)
+	}
+	var texts []string
+	for _, call := range s.tg.Calls("sendMessage") {
+		texts = append(texts, call.Text())
+	}
+	return texts
+}
+
+func TestScenarioPollKeepsLastAccess(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	s.press("notify_marks_on")
+
+	lastAccess := time.Now().Add(-time.Hour).Truncate(time.Second)
+	session := globalSessionManager.GetSession(testChatID)
+	session.LastAccess = lastAccess
+	globalSessionManager.SaveSession(session)
+
+	checked, err := s.bot.PollNotifications(context.Background())
+	if err != nil || checked != 1 {
+		t.Fatalf("PollNotifications() = %d, %v, want 1 subscriber", checked, err)
+	}
+
+	// Фоновая проверка не продлевает сессию, а обращение пользователя продлевает
+	session = globalSessionManager.GetSession(testChatID)
+	if session.NotifyCheckedAt.IsZero() {
+		t.Error("NotifyCheckedAt is not updated by poll")
+	}
+	if !session.LastAccess.Equal(lastAccess) {
+		t.Errorf("LastAccess after poll = %v, want %v", session.LastAccess, lastAccess)
+	}
+
+	s.send("/help")
+	if session := globalSessionManager.GetSession(testChatID); !session.LastAccess.After(lastAccess) {
+		t.Errorf("LastAccess after user message = %v, want refreshed", session.LastAccess)
+	}
+}
+
+// parentMarks ответ getmarks с оценками обоих детей из parentRules
+func parentMarks(ivan, maria string) string {
+	return `{"students": [
+		{"name": "12345", "subjects": [{"name": "Математика", "marks": [{"value": "` + ivan + `", "date": "2024-11-05"}]}]},
+		{"name": "12346", "subjects": [{"name": "Чтение", "marks": [{"value": "` + maria + `", "date": "2024-11-05"}]}]}
+	]}`
+}
+
+func TestScenarioPollChildrenMarks(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getrules", parentRules)
+	// У детей из разных классов свои границы четвертей
+	s.eljur.SetResult("getperiods", `{"students": [
+		{"name": "12345", "periods": [{"name": "I", "start": "20240101", "end": "20301231"}]},
+		{"name": "12346", "periods": [{"name": "1", "start": "20240201", "end": "20301130"}]}
+	]}`)
+	s.eljur.SetResult("getmarks", parentMarks("4", "4"))
+	s.login()
+	s.press("notify_marks_on")
+
+	// Первая проверка запоминает оценки; периоды и оценки запрашиваются для каждого ребенка
+	if texts := s.poll(); len(texts) != 0 {
+		t.Errorf("first poll sent %q, want nothing", texts)
+	}
+	days := make(map[string]string)
+	for _, request := range s.eljur.Requests("getmarks") {
+		days[request.Query.Get("student")] = request.Query.Get("days")
+	}
+	if days["12345"] != "20240101-20301231" || days["12346"] != "20240201-20301130" {
+		t.Errorf("getmarks days by student = %v, want each child's own period", days)
+	}
+
+	// Ошибка по первому ребенку не мешает уведомить о втором
+	s.eljur.SetResult("getmarks", parentMarks("5", "5"))
+	s.eljur.Fail("getmarks", eljurtest.Failure{Status: http.StatusBadRequest, Times: 1})
+	texts := s.poll()
+	if len(texts) != 1 || !strings.Contains(texts[0], "Иванова Мария") {
+		t.Fatalf("poll with failed child sent %q, want only the second child's mark", texts)
+	}
+
+	// Изменение у первого ребенка найдено при следующей проверке
+	texts = s.poll()
+	if len(texts) != 1 || !strings.Contains(texts[0], "Иванов Иван") {
+		t.Errorf("next poll sent %q, want the first child's mark", texts)
+	}
+}
+
+func TestScenarioPollMarksSendFailure(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getrules", parentRules)
+	s.eljur.SetResult("getmarks", parentMarks("4", "4"))
+	s.login()
+	s.press("notify_marks_on")
+
+	s.poll()
+
+	// Уведомление первому ребенку не отправилось, второму - отправлено
+	s.eljur.SetResult("getmarks", parentMarks("<5", "5"))
+	s.tg.Fail("sendMessage", http.StatusBadRequest, "Bad Request: can't parse entities")
+	texts := s.poll()
+	if len(texts) != 2 || !strings.Contains(texts[1], "Иванова Мария") {
+		t.Fatalf("poll with failed send = %q, want failed first and sent second alert", texts)
+	}
+
+	// Неотправленное изменение не потеряно, значение оценки экранировано
+	texts = s.poll()
+	if len(texts) != 1 || !strings.Contains(texts[0], "Иванов Иван") || !strings.Contains(texts[0], "4 → <b>&lt;5</b>") {
+		t.Errorf("next poll sent %q, want the first child's escaped mark", texts)
+	}
+	if texts := s.poll(); len(texts) != 0 {
+		t.Errorf("third poll sent %q, want nothing", texts)
+	}
+}
+
+func TestScenarioPollFirstMessageAfterEmptyInbox(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getmessages", `{"messages": []}`)
+	s.login()
+	s.press("notify_messages_on")
+
+	// Первая проверка с пустым ящиком ничего не присылает, но запоминается
+	if texts := s.poll(); len(texts) != 0 {
+		t.Errorf("first poll sent %q, want nothing", texts)
+	}
+
+	s.eljur.SetResult("getmessages", `{"messages": [{"id": "601", "subject": "Контрольная & зачет", "read": false,
+		"user_from": {"lastname": "Петрова", "firstname": "Анна"}}]}`)
+	texts := s.poll()
+	if len(texts) != 1 || !strings.Contains(texts[0], "Контрольная &amp; зачет") {
+		t.Fatalf("poll after first message sent %q, want one alert", texts)
+	}
+	if texts := s.poll(); len(texts) != 0 {
+		t.Errorf("repeated poll sent %q, want nothing", texts)
+	}
+}
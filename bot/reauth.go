@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+
+	"school-diary-bot/bot/eljur"
+)
+
+// PendingRequest запрос пользователя (команда или нажатие кнопки), который можно
+// выполнить повторно, например после входа при истекшей сессии
+type PendingRequest struct {
+	Data     string `json:"data"`
+	Callback bool   `json:"callback,omitempty"`
+}
+
+// resumable проверяет, можно ли повторить запрос после входа. Команды /login
+// не повторяются: они содержат пароль и сами выполняют вход.
+func (r PendingRequest) resumable() bool {
+	return r.Data != "" && !strings.HasPrefix(strings.TrimSpace(r.Data), "/login")
+}
+
+// authenticate выполняет вход в Эльжур и, если пользователь разрешил, сохраняет
+// пароль для автоматического входа при истечении токена
+func (b *Bot) authenticate(user *UserState, login, password string) error {
+	if err := user.Client.Authenticate(user.ctx, login, password); err != nil {
+		return err
+	}
+	if user.RememberPassword && globalSessionManager.Encrypted() {
+		user.Client.SetPassword(password)
+	}
+	user.expiredLogin = ""
+	return nil
+}
+
+// promptReauth приостанавливает текущее действие при истекшей сессии и просит
+// ввести пароль. После входа действие выполняется заново (см. handleReauthPassword).
+func (b *Bot) promptReauth(user *UserState) error {
+	login := user.Client.GetLogin()
+	if login == "" {
+		login = user.expiredLogin
+	}
+	if login == "" {
+		return b.replySessionExpired(user)
+	}
+	slog.Info("Eljur session expired, asking for password", "chat_id", user.ChatID)
+
+	// Недействительный токен больше не используется, выбранный ребенок сохраняется
+	studentID := user.Client.GetStudentID()
+	user.Client = eljur.NewClient()
+	user.Client.SetStudent(studentID)
+	user.expiredLogin = login
+
+	if err := user.setState(StateReauthPassword); err != nil {
+		return err
+	}
+	user.Auth.Login = login
+	if user.request.resumable() {
+		request := user.request
+		user.Auth.Resume = &request
+	}
+
+	text := fmt.Sprintf("🔑 <b>Сессия Эльжур истекла</b>\n\n"+
+		"Введите пароль от учетной записи <code>%s</code>, и бот продолжит с того же места.\n\n"+
+		"Войти под другим логином: /login, отменить: /cancel", html.EscapeString(login))
+	if !user.RememberPassword && globalSessionManager.Encrypted() {
+		text += "\n\n<i>Чтобы бот входил сам, включите /autologin</i>"
+	}
+	return b.reply(user, text, nil)
+}
+
+// replySessionExpired завершает недействительную сессию и предлагает войти заново,
+// если логин пользователя неизвестен
+func (b *Bot) replySessionExpired(user *UserState) error {
+	user.Client = eljur.NewClient()
+	user.resetState()
+
+	keyboard := NewKeyboard(
+		NewRow(
+			NewButton("🔐 Войти", "login"),
+			NewButton("🏠 Главное меню", "start"),
+		),
+	)
+	return b.reply(user, "🔑 <b>Сессия Эльжур истекла</b>\n\nВойдите заново, чтобы продолжить.", keyboard)
+}
+
+// handleReauthPassword принимает пароль при истекшей сессии, выполняет вход
+// и повторяет прерванный запрос
+func (b *Bot) handleReauthPassword(user *UserState, text string) error {
+	login, resume := user.Auth.Login, user.Auth.Resume
+	user.resetState()
+
+	b.reply(user, "🔄 Проверяем данные авторизации...", nil)
+
+	if err := b.authenticate(user, login, strings.TrimSpace(text)); err != nil {
+		return b.replyEljurError(user, "Ошибка авторизации", err)
+	}
+	b.SaveUserStateIfNeeded(user)
+
+	if resume == nil {
+		_ = b.reply(user, "✅ Вход выполнен.", nil)
+		return b.handleStart(user)
+	}
+
+	_ = b.reply(user, "✅ Вход выполнен, продолжаем.", nil)
+	user.request = *resume
+	if resume.Callback {
+		return b.dispatchCallback(user, resume.Data)
+	}
+	return b.router.Dispatch(user, resume.Data, false)
+}
+
+// handleAutoLogin показывает настройку автоматического входа (/autologin)
+func (b *Bot) handleAutoLogin(user *UserState) error {
+	if !globalSessionManager.Encrypted() {
+		return b.reply(user, "🔒 Автоматический вход недоступен: на сервере бота не настроено шифрование сессий, "+
+			"поэтому пароль не может быть сохранен безопасно.", nil)
+	}
+
+	status := "❌ Выключен: при истечении сессии бот попросит ввести пароль."
+	toggle := NewButton("✅ Включить", "autologin_on")
+	if user.RememberPassword {
+		status = "✅ Включен: при истечении сессии бот войдет заново сам."
+		toggle = NewButton("❌ Выключить", "autologin_off")
+	}
+
+	text := "🔐 <b>Автоматический вход</b>\n\n" +
+		"Сессия Эльжур периодически истекает. Бот может хранить ваш пароль в зашифрованном виде " +
+		"и входить заново без вашего участия.\n\n" + status
+
+	keyboard := NewKeyboard(
+		NewRow(toggle),
+		NewRow(NewButton("🏠 Главное меню", "start")),
+	)
+	return b.reply(user, text, keyboard)
+}
+
+// handleAutoLoginToggle включает или выключает автоматический вход. Для включения
+// пароль запрашивается заново: бот не хранит его после обычного входа.
+func (b *Bot) handleAutoLoginToggle(user *UserState, enabled bool) error {
+	if !enabled {
+		user.RememberPassword = false
+		user.Client.SetPassword("")
+		return b.handleAutoLogin(user)
+	}
+
+	if !globalSessionManager.Encrypted() {
+		return b.handleAutoLogin(user)
+	}
+	if err := user.setState(StateAutoLogin); err != nil {
+		return err
+	}
+	return b.reply(user, fmt.Sprintf("🔑 Введите пароль от учетной записи <code>%s</code>.\n\n"+
+		"Сообщение с паролем будет удалено, а сам пароль сохранен в зашифрованном виде. Отменить: /cancel",
+		html.EscapeString(user.Client.GetLogin())), nil)
+}
+
+// handleAutoLoginPassword проверяет пароль входом в Эльжур и включает автоматический вход
+func (b *Bot) handleAutoLoginPassword(user *UserState, text string) error {
+	user.resetState()
+
+	user.RememberPassword = true
+	err := b.authenticate(user, user.Client.GetLogin(), strings.TrimSpace(text))
+	if err != nil {
+		user.RememberPassword = false
+	}
+	if errors.Is(err, eljur.ErrInvalidCredentials) {
+		return b.reply(user, "❌ Неверный пароль, автоматический вход не включен.\n\nПопробовать снова: /autologin", nil)
+	} else if err != nil {
+		return b.replyEljurError(user, "Автоматический вход не включен", err)
+	}
+
+	b.SaveUserStateIfNeeded(user)
+	return b.handleAutoLogin(user)
+}
@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+	"school-diary-bot/internal/secrets"
+)
+
+// sendPassword отправляет пароль и проверяет, что сообщение с ним удалено из чата
+func (s *scenario) sendPassword(password string) string {
+	s.t.Helper()
+	message := s.tg.Message(testChatID, password)
+	s.tg.Reset()
+	if err := s.bot.HandleMessage(s.ctx, TelegramMessage(message)); err != nil {
+		s.t.Fatalf("HandleMessage(password) error = %v", err)
+	}
+	for _, m := range s.tg.Messages(testChatID) {
+		if m.ID == message.MessageID {
+			s.t.Errorf("message with password %d was not deleted", message.MessageID)
+		}
+	}
+	return s.tg.LastCall("sendMessage").Text()
+}
+
+func TestScenarioExpiredTokenResumesAction(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	s.eljur.Fail("getperiods", eljurtest.Failure{Status: http.StatusUnauthorized, Error: "Auth token is invalid", Times: 1})
+
+	reply := s.press("diary")
+	if !strings.Contains(reply.Text(), "Сессия Эльжур истекла") || !strings.Contains(reply.Text(), eljurtest.DefaultLogin) {
+		t.Fatalf("reply on expired token = %q, want password prompt", reply.Text())
+	}
+	session := globalSessionManager.GetSession(testChatID)
+	if session.EljurAuth == nil || session.EljurAuth.Token != "" || session.EljurAuth.Login != eljurtest.DefaultLogin {
+		t.Errorf("session auth after expiry = %+v, want login without token", session.EljurAuth)
+	}
+
+	// Запрос приостановлен до ввода пароля и продолжается после входа
+	if text := s.sendPassword(eljurtest.DefaultPassword); !strings.Contains(text, "Выберите неделю") {
+		t.Errorf("reply after password = %q, want resumed diary", text)
+	}
+	if session := globalSessionManager.GetSession(testChatID); session.EljurAuth.Password != "" {
+		t.Error("password stored without /autologin")
+	}
+}
+
+func TestScenarioExpiredTokenOnRestore(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	s.eljur.ExpireToken()
+
+	// Истечение обнаруживается при восстановлении сессии, команда ждет пароля
+	if reply := s.send("/marks"); !strings.Contains(reply.Text(), "Введите пароль") {
+		t.Fatalf("/marks with expired token = %q, want password prompt", reply.Text())
+	}
+
+	if text := s.sendPassword("wrong"); !strings.Contains(text, "неверный логин или пароль") {
+		t.Errorf("reply to wrong password = %q", text)
+	}
+	if reply := s.send("/marks"); !strings.Contains(reply.Text(), "Введите пароль") {
+		t.Fatalf("/marks after wrong password = %q, want password prompt again", reply.Text())
+	}
+	if text := s.sendPassword(eljurtest.DefaultPassword); !strings.Contains(text, "Выберите период") {
+		t.Errorf("reply after password = %q, want resumed marks", text)
+	}
+
+	// Выход забывает истекшую сессию
+	s.eljur.ExpireToken()
+	s.send("/logout")
+	if reply := s.send("/marks"); !strings.Contains(reply.Text(), "Сначала необходимо авторизоваться") {
+		t.Errorf("/marks after logout = %q, want login prompt", reply.Text())
+	}
+}
+
+func TestScenarioAutoLogin(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	if reply := s.send("/autologin"); !strings.Contains(reply.Text(), "недоступен") {
+		t.Errorf("/autologin without encryption = %q, want unavailable notice", reply.Text())
+	}
+
+	keyring, err := secrets.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemorySessionStore()
+	globalSessionManager = NewSessionManager(store, keyring)
+	s.login()
+
+	s.send("/autologin")
+	if reply := s.press("autologin_on"); !strings.Contains(reply.Text(), "Введите пароль") {
+		t.Fatalf("autologin_on = %q, want password prompt", reply.Text())
+	}
+	if text := s.sendPassword(eljurtest.DefaultPassword); !strings.Contains(text, "Включен") {
+		t.Fatalf("reply after password = %q, want enabled autologin", text)
+	}
+
+	stored, err := store.Load(testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsSealed(stored.EljurAuth.Password) {
+		t.Errorf("stored password = %q, want encrypted", stored.EljurAuth.Password)
+	}
+
+	// Истекший токен обновляется без участия пользователя
+	s.eljur.ExpireToken()
+	if reply := s.press("diary"); !strings.Contains(reply.Text(), "Выберите неделю") {
+		t.Errorf("diary with expired token = %q, want week selection", reply.Text())
+	}
+
+	s.press("autologin_off")
+	if session := globalSessionManager.GetSession(testChatID); session.EljurAuth.Password != "" || session.RememberPassword {
+		t.Error("password kept after disabling autologin")
+	}
+}
+
+func TestScenarioLoginPromptsEscapeHTML(t *testing.T) {
+	s := newScenario(t)
+	keyring, err := secrets.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalSessionManager = NewSessionManager(NewMemorySessionStore(), keyring)
+
+	s.eljur.Login = "ivan<&ov"
+	if reply := s.send("/login ivan<&ov " + eljurtest.DefaultPassword); !reply.HasButton("diary") {
+		t.Fatalf("/login = %q, want main menu", reply.Text())
+	}
+	const escaped = "<code>ivan&lt;&amp;ov</code>"
+
+	s.send("/autologin")
+	if reply := s.press("autologin_on"); !strings.Contains(reply.Text(), escaped) {
+		t.Errorf("autologin prompt = %q, want escaped login", reply.Text())
+	}
+	s.send("/cancel")
+
+	s.eljur.Fail("getperiods", eljurtest.Failure{Status: http.StatusUnauthorized, Error: "Auth token is invalid", Times: 1})
+	if reply := s.press("diary"); !strings.Contains(reply.Text(), escaped) {
+		t.Errorf("reauth prompt = %q, want escaped login", reply.Text())
+	}
+}
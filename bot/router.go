@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// HandlerFunc обрабатывает команду или нажатие на кнопку
+type HandlerFunc func(req *Request) error
+
+// Middleware оборачивает обработчик дополнительной логикой (проверка авторизации, логирование и т.д.)
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Request описывает входящую команду или нажатие на кнопку, сопоставленные с маршрутом
+type Request struct {
+	User     *UserState
+	Data     string // текст команды или callback данные
+	Pattern  string // шаблон сработавшего маршрута (пустой, если маршрут не найден)
+	Params   Params
+	Callback bool
+}
+
+// Params содержит параметры маршрута. Типы параметров проверяются при сопоставлении,
+// поэтому обработчику не нужно повторно проверять формат.
+type Params map[string]string
+
+// String возвращает параметр как строку
+func (p Params) String(name string) string {
+	return p[name]
+}
+
+// Int возвращает параметр типа int
+func (p Params) Int(name string) int {
+	value, _ := strconv.Atoi(p[name])
+	return value
+}
+
+// Date возвращает параметр типа date (YYYYMMDD)
+func (p Params) Date(name string) time.Time {
+	value, _ := time.Parse("20060102", p[name])
+	return value
+}
+
+// paramTypes проверяют значения типизированных параметров ({name:type})
+var paramTypes = map[string]func(string) bool{
+	"int": func(value string) bool {
+		_, err := strconv.Atoi(value)
+		return err == nil
+	},
+	"date": isDate,
+}
+
+// segment представляет часть шаблона маршрута: литерал или параметр
+type segment struct {
+	literal string
+	param   string
+	kind    string // тип параметра из paramTypes, пустой для строки
+	rest    bool   // параметр забирает остаток данных ({name...})
+}
+
+// route представляет зарегистрированный маршрут
+type route struct {
+	pattern  string
+	segments []segment
+	literals int
+	handler  HandlerFunc
+	order    int
+}
+
+// routeTable хранит маршруты одного вида (команды или callback данные)
+type routeTable struct {
+	separator func(rune) bool
+	routes    []*route
+}
+
+// Router сопоставляет команды и callback данные с обработчиками.
+//
+// Шаблон маршрута состоит из частей, разделенных "_" (для callback данных) или пробелами
+// (для команд). Часть может быть литералом или параметром: {name} - одна часть,
+// {name:int} и {name:date} - часть с проверкой типа, {name...} - весь остаток.
+// Если подходят несколько маршрутов, выбирается самый конкретный (с большим числом
+// литералов), поэтому порядок регистрации не важен:
+//
+//	r.Callback("notify_quiet_off", ...)
+//	r.Callback("notify_quiet_{from:int}_{to:int}", ...)
+//	r.Command("/login {login} {password}", ...)
+type Router struct {
+	commands   routeTable
+	callbacks  routeTable
+	actions    map[string]HandlerFunc
+	middleware []Middleware
+
+	notFoundCommand  HandlerFunc
+	notFoundCallback HandlerFunc
+}
+
+// NewRouter создает пустой маршрутизатор
+func NewRouter() *Router {
+	return &Router{
+		commands:  routeTable{separator: unicode.IsSpace},
+		callbacks: routeTable{separator: func(r rune) bool { return r == '_' }},
+		actions:   make(map[string]HandlerFunc),
+	}
+}
+
+// Use добавляет middleware, применяемые ко всем маршрутам (в порядке добавления, снаружи внутрь)
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Command регистрирует команду. middleware применяются только к этому маршруту.
+func (r *Router) Command(pattern string, handler HandlerFunc, middleware ...Middleware) {
+	r.commands.add(pattern, chain(handler, middleware))
+}
+
+// Callback регистрирует обработчик callback данных
+func (r *Router) Callback(pattern string, handler HandlerFunc, middleware ...Middleware) {
+	r.callbacks.add(pattern, chain(handler, middleware))
+}
+
+// Action регистрирует действие кнопки с параметрами (см. encodeCallback).
+// Действия вызываются только через DispatchAction и не сопоставляются с callback данными.
+func (r *Router) Action(name string, handler HandlerFunc, middleware ...Middleware) {
+	if _, exists := r.actions[name]; exists {
+		panic(fmt.Sprintf("bot: действие %q уже зарегистрировано", name))
+	}
+	r.actions[name] = chain(handler, middleware)
+}
+
+// NotFound задает обработчики для неизвестных команд и callback данных
+func (r *Router) NotFound(command, callback HandlerFunc) {
+	r.notFoundCommand = command
+	r.notFoundCallback = callback
+}
+
+// Dispatch находит маршрут для команды (или callback данных, если callback=true) и вызывает его
+func (r *Router) Dispatch(user *UserState, data string, callback bool) error {
+	table, handler := &r.commands, r.notFoundCommand
+	if callback {
+		table, handler = &r.callbacks, r.notFoundCallback
+	}
+
+	req := &Request{User: user, Data: data, Callback: callback}
+	if route, params := table.match(data); route != nil {
+		req.Pattern, req.Params, handler = route.pattern, params, route.handler
+	}
+	if handler == nil {
+		return fmt.Errorf("маршрут не найден: %s", data)
+	}
+
+	return chain(handler, r.middleware)(req)
+}
+
+// DispatchAction вызывает действие кнопки с уже разобранными параметрами
+func (r *Router) DispatchAction(user *UserState, action string, params Params) error {
+	req := &Request{User: user, Data: action, Params: params, Callback: true}
+
+	handler, ok := r.actions[action]
+	if ok {
+		req.Pattern = action
+	} else if handler = r.notFoundCallback; handler == nil {
+		return fmt.Errorf("действие не найдено: %s", action)
+	}
+
+	return chain(handler, r.middleware)(req)
+}
+
+// chain оборачивает обработчик в middleware так, что первый middleware выполняется первым
+func chain(handler HandlerFunc, middleware []Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// add разбирает шаблон и добавляет маршрут. Некорректный шаблон - ошибка программиста, поэтому паникуем.
+func (t *routeTable) add(pattern string, handler HandlerFunc) {
+	rt := &route{pattern: pattern, handler: handler, order: len(t.routes)}
+
+	parts := strings.FieldsFunc(pattern, t.separator)
+	for i, part := range parts {
+		name, ok := strings.CutPrefix(part, "{")
+		if !ok {
+			rt.segments = append(rt.segments, segment{literal: part})
+			rt.literals++
+			continue
+		}
+
+		name, ok = strings.CutSuffix(name, "}")
+		if !ok || name == "" {
+			panic(fmt.Sprintf("bot: некорректный параметр %q в маршруте %q", part, pattern))
+		}
+
+		seg := segment{}
+		if name, seg.rest = strings.CutSuffix(name, "..."); seg.rest && i != len(parts)-1 {
+			panic(fmt.Sprintf("bot: параметр %q должен быть последним в маршруте %q", part, pattern))
+		}
+		if name, kind, typed := strings.Cut(name, ":"); typed {
+			if _, known := paramTypes[kind]; !known {
+				panic(fmt.Sprintf("bot: неизвестный тип %q в маршруте %q", kind, pattern))
+			}
+			seg.param, seg.kind = name, kind
+		} else {
+			seg.param = name
+		}
+		rt.segments = append(rt.segments, seg)
+	}
+
+	if len(rt.segments) == 0 {
+		panic(fmt.Sprintf("bot: пустой маршрут %q", pattern))
+	}
+
+	t.routes = append(t.routes, rt)
+
+	// Сначала проверяем более конкретные маршруты: с большим числом литералов, затем более длинные
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		a, b := t.routes[i], t.routes[j]
+		if a.literals != b.literals {
+			return a.literals > b.literals
+		}
+		if len(a.segments) != len(b.segments) {
+			return len(a.segments) > len(b.segments)
+		}
+		return a.order < b.order
+	})
+}
+
+// match возвращает первый подходящий маршрут и его параметры
+func (t *routeTable) match(data string) (*route, Params) {
+	parts, offsets := t.split(data)
+
+	for _, rt := range t.routes {
+		if params, ok := rt.match(data, parts, offsets); ok {
+			return rt, params
+		}
+	}
+	return nil, nil
+}
+
+// split разбивает данные на части и запоминает смещение начала каждой части
+func (t *routeTable) split(data string) ([]string, []int) {
+	var parts []string
+	var offsets []int
+
+	start := -1
+	for i, r := range data {
+		switch {
+		case t.separator(r) && start >= 0:
+			parts = append(parts, data[start:i])
+			start = -1
+		case !t.separator(r) && start < 0:
+			start = i
+			offsets = append(offsets, i)
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, data[start:])
+	}
+	return parts, offsets
+}
+
+// match сопоставляет части данных с шаблоном маршрута
+func (rt *route) match(data string, parts []string, offsets []int) (Params, bool) {
+	last := rt.segments[len(rt.segments)-1]
+	if len(parts) < len(rt.segments) || (!last.rest && len(parts) != len(rt.segments)) {
+		return nil, false
+	}
+
+	params := make(Params)
+	for i, seg := range rt.segments {
+		value := parts[i]
+		if seg.rest {
+			// Остаток берем из исходных данных, чтобы сохранить разделители (переводы строк в тексте)
+			value = strings.TrimSpace(data[offsets[i]:])
+		}
+
+		switch {
+		case seg.param == "":
+			if value != seg.literal {
+				return nil, false
+			}
+		case seg.kind != "" && !paramTypes[seg.kind](value):
+			return nil, false
+		default:
+			params[seg.param] = value
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur"
+)
+
+func TestRouterMatch(t *testing.T) {
+	r := NewRouter()
+	var got *Request
+	record := func(req *Request) error {
+		got = req
+		return nil
+	}
+
+	// Общие шаблоны регистрируются раньше конкретных: порядок не должен влиять на выбор
+	r.Callback("msg_{action}", record)
+	r.Callback("msg_read_{folder}_{id...}", record)
+	r.Callback("msg_inbox", record)
+	r.Callback("schedule_{start:date}_{end:date}", record)
+	r.Callback("notify_quiet_{from:int}_{to:int}", record)
+	r.Command("/login {args...}", record)
+	r.Command("/login {login} {password}", record)
+	r.Command("/gemini {prompt...}", record)
+	r.NotFound(nil, func(req *Request) error {
+		got = req
+		return nil
+	})
+
+	tests := []struct {
+		data     string
+		callback bool
+		pattern  string
+		params   Params
+	}{
+		{"msg_inbox", true, "msg_inbox", Params{}},
+		{"msg_sent", true, "msg_{action}", Params{"action": "sent"}},
+		{"msg_read_inbox_42", true, "msg_read_{folder}_{id...}", Params{"folder": "inbox", "id": "42"}},
+		{"msg_read_sent_a_b", true, "msg_read_{folder}_{id...}", Params{"folder": "sent", "id": "a_b"}},
+		{"schedule_20241104_20241110", true, "schedule_{start:date}_{end:date}", Params{"start": "20241104", "end": "20241110"}},
+		{"schedule_20241104_next", true, "", nil},
+		{"schedule_20241104", true, "", nil},
+		{"notify_quiet_22_7", true, "notify_quiet_{from:int}_{to:int}", Params{"from": "22", "to": "7"}},
+		{"notify_quiet_x_7", true, "", nil},
+		{"/login Ivanov secret", false, "/login {login} {password}", Params{"login": "Ivanov", "password": "secret"}},
+		{"/login Ivanov", false, "/login {args...}", Params{"args": "Ivanov"}},
+		{"/gemini реши\n  2+2", false, "/gemini {prompt...}", Params{"prompt": "реши\n  2+2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got = nil
+			if err := r.Dispatch(&UserState{}, tt.data, tt.callback); err != nil {
+				t.Fatalf("Dispatch() error = %v", err)
+			}
+			if got.Pattern != tt.pattern {
+				t.Fatalf("pattern = %q, want %q", got.Pattern, tt.pattern)
+			}
+			if len(got.Params) != len(tt.params) {
+				t.Fatalf("params = %v, want %v", got.Params, tt.params)
+			}
+			for name, want := range tt.params {
+				if got.Params.String(name) != want {
+					t.Errorf("param %s = %q, want %q", name, got.Params.String(name), want)
+				}
+			}
+		})
+	}
+
+	if err := r.Dispatch(&UserState{}, "/unknown", false); err == nil {
+		t.Error("Dispatch() without NotFound handler returned no error")
+	}
+}
+
+func TestRouterTypedParams(t *testing.T) {
+	params := Params{"hour": "23", "date": "20241104"}
+	if got := params.Int("hour"); got != 23 {
+		t.Errorf("Int() = %d, want 23", got)
+	}
+	if got := params.Date("date"); !got.Equal(time.Date(2024, 11, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date() = %v, want 2024-11-04", got)
+	}
+
+	for _, pattern := range []string{"", "week_{}", "week_{start:time}", "week_{rest...}_end", "week_{start"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Callback(%q) did not panic", pattern)
+				}
+			}()
+			NewRouter().Callback(pattern, func(*Request) error { return nil })
+		}()
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	b := NewBotWithMessenger(NewCLIMessenger(&out))
+	b.limiter = newRateLimiter(2, time.Hour)
+
+	r := NewRouter()
+	r.Use(b.recoverPanics, b.rateLimit)
+	called := 0
+	r.Command("/diary", func(*Request) error {
+		called++
+		return nil
+	}, b.requireAuth)
+	r.Command("/panic", func(*Request) error {
+		panic("boom")
+	})
+
+	user := &UserState{ChatID: testChatID, Client: eljur.NewClient()}
+
+	if err := r.Dispatch(user, "/diary", false); err != nil || called != 0 {
+		t.Fatalf("Dispatch() = %v, called = %d, want auth prompt", err, called)
+	}
+	if !strings.Contains(out.String(), "авторизоваться через /login") {
+		t.Errorf("output does not contain auth prompt:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := r.Dispatch(user, "/panic", false); err == nil {
+		t.Error("Dispatch() after panic returned no error")
+	}
+	if !strings.Contains(out.String(), "Внутренняя ошибка бота") {
+		t.Errorf("output does not contain panic notice:\n%s", out.String())
+	}
+
+	// Два запроса выше исчерпали лимит, предупреждение отправляется только один раз
+	out.Reset()
+	for i := 0; i < 3; i++ {
+		if err := r.Dispatch(user, "/diary", false); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+	if got := strings.Count(out.String(), "Слишком много запросов"); got != 1 {
+		t.Errorf("rate limit warnings = %d, want 1:\n%s", got, out.String())
+	}
+	if strings.Contains(out.String(), "авторизоваться") {
+		t.Errorf("rate limited request reached the handler:\n%s", out.String())
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import "school-diary-bot/bot/eljur"
+
+// routes регистрирует все команды и кнопки бота
+func (b *Bot) routes() *Router {
+	r := NewRouter()
+	r.Use(b.recoverPanics, b.logRequests, b.rateLimit)
+
+	// Команды
+	r.Command("/start", userHandler(b.handleStart))
+	r.Command("/help", userHandler(b.handleHelp))
+	r.Command("/login", userHandler(b.handleLogin))
+	r.Command("/login {login} {password}", func(req *Request) error {
+		return b.handleLoginWithParams(req.User, req.Params.String("login"), req.Params.String("password"))
+	})
+	r.Command("/login {args...}", userHandler(b.handleLoginFormat))
+	r.Command("/logout", userHandler(b.handleLogout))
+	r.Command("/cancel", userHandler(b.handleCancel))
+	r.Command("/diary", userHandler(b.handleDiary), b.requireAuth)
+	r.Command("/periods", userHandler(b.handlePeriods), b.requireAuth)
+	r.Command("/messages", userHandler(b.handleMessages), b.requireAuth)
+	r.Command("/messages send {args...}", func(req *Request) error {
+		return b.handleMessageSendWithParams(req.User, req.Params.String("args"))
+	}, b.requireAuth)
+	r.Command("/schedule", userHandler(b.handleSchedule), b.requireAuth)
+	r.Command("/marks", userHandler(b.handleMarks), b.requireAuth)
+	r.Command("/gemini", userHandler(b.handleGemini))
+	r.Command("/gemini reset", userHandler(b.handleGeminiNewChat))
+	r.Command("/gemini {prompt...}", func(req *Request) error {
+		return b.handleGeminiWithParams(req.User, req.Params.String("prompt"))
+	})
+	r.Command("/notify", userHandler(b.handleNotify), b.requireAuth)
+	r.Command("/child", userHandler(b.handleChild), b.requireAuth)
+	r.Command("/autologin", userHandler(b.handleAutoLogin), b.requireAuth)
+
+	// Главное меню
+	r.Callback("start", userHandler(b.handleStart))
+	r.Callback("login", userHandler(b.handleLogin))
+	r.Callback("help", userHandler(b.handleHelp))
+	r.Callback("clear_chat", userHandler(b.handleClearChat))
+	r.Callback("child", userHandler(b.handleChild), b.requireAuth)
+	r.Action("child", func(req *Request) error {
+		return b.handleChildSelect(req.User, req.Params.String("id"))
+	}, b.requireAuth)
+
+	// Дневник, расписание и оценки
+	r.Callback("diary", userHandler(b.handleDiary), b.requireAuth)
+	r.Action("week", func(req *Request) error {
+		return b.handleWeekSelect(req.User, req.Params.String("start"), req.Params.String("end"))
+	}, b.requireAuth)
+	r.Callback("periods", userHandler(b.handlePeriods), b.requireAuth)
+	r.Callback("schedule", userHandler(b.handleSchedule), b.requireAuth)
+	r.Action("schedule_week", func(req *Request) error {
+		return b.showSchedule(req.User, eljur.Week{Start: req.Params.String("start"), End: req.Params.String("end")})
+	}, b.requireAuth)
+	r.Callback("marks", userHandler(b.handleMarks), b.requireAuth)
+	r.Action("period", func(req *Request) error {
+		return b.handlePeriodSelect(req.User, req.Params.String("period"))
+	}, b.requireAuth)
+	r.Callback("period_year", func(req *Request) error {
+		return b.handlePeriodSelect(req.User, "")
+	}, b.requireAuth)
+
+	// Сообщения
+	r.Callback("messages", userHandler(b.handleMessages), b.requireAuth)
+	r.Callback("msg_inbox", func(req *Request) error {
+		return b.showMessages(req.User, "inbox")
+	}, b.requireAuth)
+	r.Callback("msg_sent", func(req *Request) error {
+		return b.showMessages(req.User, "sent")
+	}, b.requireAuth)
+	r.Callback("msg_compose", userHandler(b.startComposeMessage), b.requireAuth)
+	r.Action("msg_read", func(req *Request) error {
+		return b.handleReadMessage(req.User, req.Params.String("folder"), req.Params.String("id"))
+	}, b.requireAuth)
+	r.Action("compose_to", func(req *Request) error {
+		return b.handleSelectRecipient(req.User, req.Params.String("id"))
+	}, b.requireAuth)
+
+	// Уведомления
+	r.Callback("notify", userHandler(b.handleNotify), b.requireAuth)
+	r.Callback("notify_{setting}_on", func(req *Request) error {
+		return b.handleNotifyToggle(req.User, req.Params.String("setting"), true)
+	}, b.requireAuth)
+	r.Callback("notify_{setting}_off", func(req *Request) error {
+		return b.handleNotifyToggle(req.User, req.Params.String("setting"), false)
+	}, b.requireAuth)
+	r.Callback("notify_quiet_{from:int}_{to:int}", func(req *Request) error {
+		return b.handleQuietHours(req.User, req.Params.Int("from"), req.Params.Int("to"))
+	}, b.requireAuth)
+
+	// Автоматический вход
+	r.Callback("autologin", userHandler(b.handleAutoLogin), b.requireAuth)
+	r.Callback("autologin_on", func(req *Request) error {
+		return b.handleAutoLoginToggle(req.User, true)
+	}, b.requireAuth)
+	r.Callback("autologin_off", func(req *Request) error {
+		return b.handleAutoLoginToggle(req.User, false)
+	}, b.requireAuth)
+
+	// AI ассистент
+	r.Callback("gemini", userHandler(b.handleGemini))
+	r.Callback("gemini_setup", userHandler(b.handleGeminiSetup))
+	r.Callback("gemini_change_key", userHandler(b.handleGeminiSetup))
+	r.Callback("gemini_help", userHandler(b.handleGeminiHelp))
+	r.Callback("gemini_reset", userHandler(b.handleGeminiReset))
+	r.Callback("gemini_chat", userHandler(b.handleGeminiChatStart))
+	r.Callback("gemini_new_chat", userHandler(b.handleGeminiNewChat))
+	r.Callback("gemini_provider", func(req *Request) error {
+		return b.handleGeminiProvider(req.User, "")
+	})
+	r.Callback("gemini_provider_{provider}", func(req *Request) error {
+		return b.handleGeminiProvider(req.User, req.Params.String("provider"))
+	})
+	r.Callback("gemini_model_select", userHandler(b.handleGeminiModelSelect))
+	r.Action("gemini_model", func(req *Request) error {
+		return b.handleGeminiModelSet(req.User, req.Params.String("model"))
+	})
+	r.Callback("gemini_context_homework", userHandler(b.handleGeminiHomework))
+	r.Callback("gemini_context_{context...}", func(req *Request) error {
+		return b.handleGeminiContextSelect(req.User, req.Params.String("context"))
+	})
+	r.Action("gemini_hw", func(req *Request) error {
+		return b.handleGeminiHomeworkSelect(req.User, req.Params.String("key"))
+	}, b.requireAuth)
+
+	r.NotFound(
+		func(req *Request) error {
+			return b.reply(req.User, "❓ Неизвестная команда. Используйте /help для получения справки.", nil)
+		},
+		// Неизвестные callback данные приходят от кнопок старых версий бота
+		func(req *Request) error {
+			return b.handleExpiredCallback(req.User)
+		},
+	)
+
+	return r
+}
+
+// userHandler адаптирует обработчик без параметров к HandlerFunc
+func userHandler(handler func(user *UserState) error) HandlerFunc {
+	return func(req *Request) error {
+		return handler(req.User)
+	}
+}
@@ -0,0 +1,425 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"school-diary-bot/bot/eljur/eljurtest"
+	"school-diary-bot/bot/telegramtest"
+	"school-diary-bot/internal/logging"
+)
+
+const testChatID int64 = 1001
+
+// scenario связывает бота с тестовыми серверами Telegram и Эльжур
+type scenario struct {
+	t     *testing.T
+	ctx   context.Context // контекст обработки обновлений (дедлайн webhook)
+	bot   *Bot
+	tg    *telegramtest.Server
+	eljur *eljurtest.Server
+}
+
+// newScenario запускает тестовые серверы и создает бота с пустым хранилищем сессий
+func newScenario(t *testing.T) *scenario {
+	t.Helper()
+
+	eljurServer := eljurtest.NewServer()
+	t.Cleanup(eljurServer.Close)
+	t.Setenv("ELJUR_API_URL", eljurServer.BaseURL())
+	t.Setenv("ELJUR_DEV_KEY", eljurServer.DevKey)
+
+	tg := telegramtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	previous := globalSessionManager
+	globalSessionManager = NewSessionManager(NewMemorySessionStore(), nil)
+	t.Cleanup(func() { globalSessionManager = previous })
+
+	return &scenario{t: t, ctx: context.Background(), bot: newTelegramBot(t, tg), tg: tg, eljur: eljurServer}
+}
+
+// newTelegramBot создает бота, работающего с тестовым сервером Bot API
+func newTelegramBot(t *testing.T, tg *telegramtest.Server) *Bot {
+	t.Helper()
+
+	b := NewBotWithMessenger(newTestTelegramMessenger(t, tg))
+	// Сценарии быстро отправляют много запросов от одного чата
+	b.limiter = nil
+	return b
+}
+
+// send отправляет боту текстовое сообщение и возвращает последний ответ
+func (s *scenario) send(text string) telegramtest.Call {
+	s.t.Helper()
+	s.tg.Reset()
+	if err := s.bot.HandleMessage(s.ctx, TelegramMessage(s.tg.Message(testChatID, text))); err != nil {
+		s.t.Fatalf("HandleMessage(%q) error = %v", text, err)
+	}
+	return s.tg.LastCall("sendMessage")
+}
+
+// press нажимает кнопку под последним сообщением бота и возвращает последний ответ:
+// новое сообщение или правку сообщения с кнопкой
+func (s *scenario) press(data string) telegramtest.Call {
+	s.t.Helper()
+	s.tg.Reset()
+	if err := s.bot.HandleCallback(s.ctx, TelegramCallback(s.tg.Callback(testChatID, data))); err != nil {
+		s.t.Fatalf("HandleCallback(%q) error = %v", data, err)
+	}
+	if len(s.tg.Calls("answerCallbackQuery")) != 1 {
+		s.t.Errorf("HandleCallback(%q) answered callback %d times, want 1", data, len(s.tg.Calls("answerCallbackQuery")))
+	}
+
+	var reply telegramtest.Call
+	for _, call := range s.tg.Calls("") {
+		if call.Method == "sendMessage" || call.Method == "editMessageText" {
+			reply = call
+		}
+	}
+	return reply
+}
+
+// login авторизует пользователя тестовыми учетными данными
+func (s *scenario) login() {
+	s.t.Helper()
+	reply := s.send("/login " + eljurtest.DefaultLogin + " " + eljurtest.DefaultPassword)
+	if !reply.HasButton("diary") {
+		s.t.Fatalf("after /login got %q without main menu", reply.Text())
+	}
+}
+
+func TestScenarioLoginDiaryHomework(t *testing.T) {
+	s := newScenario(t)
+
+	s.login()
+	var texts []string
+	for _, call := range s.tg.Calls("sendMessage") {
+		texts = append(texts, call.Text())
+	}
+	if !strings.Contains(strings.Join(texts, "\n"), "Авторизация успешна") {
+		t.Errorf("login replies = %q, want success message", texts)
+	}
+	if reply := s.tg.LastCall("sendMessage"); !strings.Contains(reply.Text(), "✅ Вы авторизованы") {
+		t.Errorf("main menu = %q, want authenticated greeting", reply.Text())
+	}
+
+	reply := s.press("diary")
+	if !strings.Contains(reply.Text(), "II четверть") {
+		t.Errorf("week selection = %q, want current period", reply.Text())
+	}
+	week, ok := reply.ButtonData("4 ноября")
+	if !ok {
+		t.Fatalf("week selection has no first week button: %+v", reply.Buttons())
+	}
+	if !strings.HasPrefix(week, callbackPrefix) || len(week) > 64 {
+		t.Errorf("week button data = %q, want short encoded callback", week)
+	}
+
+	reply = s.press(week)
+	for _, want := range []string{"Дневник за выбранную неделю", "Математика", "№ 123, 124", "Параграф 5, упр. 3"} {
+		if !strings.Contains(reply.Text(), want) {
+			t.Errorf("diary reply does not contain %q:\n%s", want, reply.Text())
+		}
+	}
+	if reply.Params.Get("parse_mode") != "HTML" {
+		t.Errorf("parse_mode = %q, want HTML", reply.Params.Get("parse_mode"))
+	}
+
+	requests := s.eljur.Requests("getdiary")
+	if len(requests) != 1 {
+		t.Fatalf("getdiary requests = %d, want 1", len(requests))
+	}
+	if got := requests[0].Query.Get("days"); got != "20241104-20241110" {
+		t.Errorf("getdiary days = %q, want 20241104-20241110", got)
+	}
+}
+
+func TestScenarioDiaryEscapesHTML(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getdiary", `{"students": {"12345": {"name": "12345", "days": {"20241104": {
+		"name": "20241104",
+		"items": [{"num": 1, "name": "Алгебра <углубл.>", "teacher": "Петров & Ко",
+			"homework": [{"id": 1, "value": "Решить x < 5 && y > 3", "files": [{"filename": "<b>тест</b>.pdf"}]}]}]
+	}}}}}`)
+	s.login()
+
+	week, ok := s.press("diary").ButtonData("4 ноября")
+	if !ok {
+		t.Fatal("week selection has no first week button")
+	}
+	reply := s.press(week)
+	for _, want := range []string{"Алгебра &lt;углубл.&gt;", "Петров &amp; Ко", "Решить x &lt; 5 &amp;&amp; y &gt; 3", "&lt;b&gt;тест&lt;/b&gt;.pdf"} {
+		if !strings.Contains(reply.Text(), want) {
+			t.Errorf("diary reply does not contain %q:\n%s", want, reply.Text())
+		}
+	}
+}
+
+func TestScenarioMarksEscapeHTML(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getperiods", `{"students": [{"name": "12345", "periods": [
+		{"name": "I", "fullname": "I <полугодие> & зачет", "start": "20240902", "end": "20241229"}]}]}`)
+	s.eljur.SetResult("getmarks", `{"students": [{"name": "12345", "subjects": [
+		{"name": "Физика & астрономия", "marks": [{"value": "<5", "date": "2024-10-14"}]}]}]}`)
+	s.login()
+
+	period, ok := s.press("marks").ButtonData("I <полугодие> & зачет")
+	if !ok {
+		t.Fatal("marks menu has no period button")
+	}
+	reply := s.press(period)
+	for _, want := range []string{"I &lt;полугодие&gt; &amp; зачет", "Физика &amp; астрономия", "[&lt;5]"} {
+		if !strings.Contains(reply.Text(), want) {
+			t.Errorf("marks reply does not contain %q:\n%s", want, reply.Text())
+		}
+	}
+}
+
+func TestScenarioScheduleEscapesHTML(t *testing.T) {
+	s := newScenario(t)
+	s.eljur.SetResult("getschedule", `{"students": [{"name": "12345", "days": [{"date": "20241104", "lessons": [
+		{"name": "Алгебра <углубл.>", "number": 1, "teacher": "Петров & Ко", "room": "Зал <А>", "time": "08:00 & 08:45"}]}]}]}`)
+	s.login()
+
+	reply := s.send("/schedule")
+	for _, want := range []string{"Алгебра &lt;углубл.&gt;", "Петров &amp; Ко", "Зал &lt;А&gt;", "08:00 &amp; 08:45"} {
+		if !strings.Contains(reply.Text(), want) {
+			t.Errorf("schedule reply does not contain %q:\n%s", want, reply.Text())
+		}
+	}
+}
+
+func TestScenarioLoginRejected(t *testing.T) {
+	s := newScenario(t)
+
+	reply := s.send("/login " + eljurtest.DefaultLogin + " wrong")
+	if !strings.Contains(reply.Text(), "Ошибка авторизации") {
+		t.Errorf("reply = %q, want authorization error", reply.Text())
+	}
+
+	reply = s.press("diary")
+	if !strings.Contains(reply.Text(), "Сначала необходимо авторизоваться") {
+		t.Errorf("diary reply = %q, want login prompt", reply.Text())
+	}
+	if len(s.eljur.Requests("getdiary")) != 0 {
+		t.Errorf("diary requested without authorization")
+	}
+}
+
+// captureLogs перенаправляет логи уровня debug в буфер до конца теста
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug, false))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// checkNoSecrets проверяет, что в логах нет тестовых пароля, токена и devkey
+func checkNoSecrets(t *testing.T, out string) {
+	t.Helper()
+	if regexp.MustCompile(`\b` + eljurtest.DefaultPassword + `\b`).MatchString(out) {
+		t.Errorf("log output leaks password: %s", out)
+	}
+	for _, secret := range []string{eljurtest.DefaultToken, eljurtest.DefaultDevKey} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q: %s", secret, out)
+		}
+	}
+}
+
+func TestScenarioLogsHideSecrets(t *testing.T) {
+	buf := captureLogs(t)
+
+	// Даже на уровне debug в логах нет пароля, токена и devkey
+	s := newScenario(t)
+	s.login()
+	s.press("diary")
+
+	out := buf.String()
+	if !strings.Contains(out, "endpoint=getperiods") {
+		t.Fatalf("debug log has no Eljur requests: %s", out)
+	}
+	checkNoSecrets(t, out)
+}
+
+func TestScenarioLogsHideStepByStepPassword(t *testing.T) {
+	buf := captureLogs(t)
+
+	// Пароль, введенный отдельным сообщением, ничем не отличается от обычного текста
+	s := newScenario(t)
+	s.send("/login")
+	s.send(eljurtest.DefaultLogin)
+	if reply := s.send(eljurtest.DefaultPassword); !reply.HasButton("diary") {
+		t.Fatalf("after password got %q without main menu", reply.Text())
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "state=auth_password") {
+		t.Fatalf("debug log has no password input: %s", out)
+	}
+	checkNoSecrets(t, out)
+}
+
+func TestScenarioSessionSurvivesRestart(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	// Новый экземпляр бота (как новый вызов serverless функции) читает сессию из хранилища
+	s.bot = newTelegramBot(t, s.tg)
+
+	reply := s.press("diary")
+	if _, ok := reply.ButtonData("23 декабря"); !ok {
+		t.Errorf("week selection after restart = %q, want week buttons", reply.Text())
+	}
+}
+
+func TestScenarioGeminiKeyMessageDeleted(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	// Короткий ключ отклоняется без обращения к Gemini, но сообщение все равно удаляется
+	s.press("gemini_setup")
+	key := s.tg.Message(testChatID, "AIza")
+	s.tg.Reset()
+	if err := s.bot.HandleMessage(s.ctx, TelegramMessage(key)); err != nil {
+		t.Fatalf("HandleMessage() error = %v", err)
+	}
+
+	for _, message := range s.tg.Messages(testChatID) {
+		if message.ID == key.MessageID {
+			t.Errorf("message with API key %d was not deleted", key.MessageID)
+		}
+	}
+	if reply := s.tg.LastCall("sendMessage"); !strings.Contains(reply.Text(), "слишком короткий") {
+		t.Errorf("reply = %q, want short key error", reply.Text())
+	}
+}
+
+func TestScenarioNavigationEditsMenu(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	menu, _ := s.tg.LastBotMessage(testChatID)
+	before := len(s.tg.Messages(testChatID))
+
+	week, _ := s.press("diary").ButtonData("4 ноября")
+	s.press(week)
+	reply := s.press("start")
+
+	if got := len(s.tg.Calls("sendMessage")); got != 0 {
+		t.Errorf("navigation sent %d new messages, want 0", got)
+	}
+	if got := len(s.tg.Messages(testChatID)); got != before {
+		t.Errorf("chat has %d messages after navigation, want %d", got, before)
+	}
+	if reply.Method != "editMessageText" || reply.Params.Get("message_id") != strconv.Itoa(menu.ID) {
+		t.Errorf("last reply = %s %v, want edit of menu %d", reply.Method, reply.Params, menu.ID)
+	}
+
+	// Повторное нажатие на ту же кнопку не меняет сообщение и не должно приводить к отправке нового
+	s.press("start")
+	if got := len(s.tg.Calls("sendMessage")); got != 0 {
+		t.Errorf("unchanged screen sent %d new messages, want 0", got)
+	}
+}
+
+func TestScenarioEditFallsBackToSend(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	s.tg.Fail("editMessageText", http.StatusBadRequest, "Bad Request: there is no text in the message to edit")
+	reply := s.press("diary")
+	if _, ok := reply.ButtonData("4 ноября"); reply.Method != "sendMessage" || !ok {
+		t.Errorf("reply = %s %q, want week selection as new message", reply.Method, reply.Text())
+	}
+}
+
+func TestScenarioClearChatDeletesTrackedMessages(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	s.press("diary")
+
+	var botMessages []int
+	for _, message := range s.tg.Messages(testChatID) {
+		if message.FromBot {
+			botMessages = append(botMessages, message.ID)
+		}
+	}
+
+	// Кнопка очистки находится в списке сообщений
+	s.press("messages")
+	s.press("msg_inbox")
+	reply := s.press("clear_chat")
+	if reply.Method != "sendMessage" || !strings.Contains(reply.Text(), "Чат очищен") {
+		t.Errorf("reply = %s %q, want new message about cleared chat", reply.Method, reply.Text())
+	}
+	if got := len(s.tg.Calls("deleteMessage")); got != len(botMessages) {
+		t.Errorf("deleted %d messages, want %d", got, len(botMessages))
+	}
+
+	var remaining []string
+	for _, message := range s.tg.Messages(testChatID) {
+		if message.FromBot {
+			remaining = append(remaining, message.Text)
+		}
+	}
+	if len(remaining) != 1 {
+		t.Errorf("bot messages after clear = %q, want only the confirmation", remaining)
+	}
+}
+
+func TestScenarioSlowServer(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+
+	// Сервер школы отвечает дольше, чем осталось времени у webhook
+	s.eljur.Fail("getperiods", eljurtest.Failure{Delay: 300 * time.Millisecond, Times: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.ctx = ctx
+
+	reply := s.press("diary")
+	if !strings.Contains(reply.Text(), "отвечает слишком долго") || !reply.HasButton("start") {
+		t.Fatalf("reply on timeout = %q, want slow server notice", reply.Text())
+	}
+
+	// Таймаут не завершает сессию
+	s.ctx = context.Background()
+	if reply := s.press("diary"); !strings.Contains(reply.Text(), "Выберите неделю") {
+		t.Errorf("diary after timeout = %q, want week selection", reply.Text())
+	}
+}
+
+func TestScenarioServerOutage(t *testing.T) {
+	s := newScenario(t)
+	s.login()
+	for _, endpoint := range []string{"getrules", "getperiods"} {
+		s.eljur.Fail(endpoint, eljurtest.Failure{Status: http.StatusServiceUnavailable})
+	}
+
+	// Повторы запросов не помогают, и после серии сбоев открывается автомат защиты
+	s.press("diary")
+	reply := s.press("diary")
+	if !strings.Contains(reply.Text(), "Сервер школы сейчас недоступен") || !reply.HasButton("start") {
+		t.Fatalf("reply during outage = %q, want outage notice", reply.Text())
+	}
+
+	requests := len(s.eljur.Requests("getperiods"))
+	s.press("diary")
+	if got := len(s.eljur.Requests("getperiods")); got != requests {
+		t.Errorf("bot made %d requests to the unavailable server", got-requests)
+	}
+	if session := globalSessionManager.GetSession(testChatID); session.EljurAuth == nil {
+		t.Error("outage logged the user out")
+	}
+}
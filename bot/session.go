@@ -1,85 +1,210 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"sync"
 	"time"
 
 	"school-diary-bot/bot/eljur"
+	"school-diary-bot/internal/secrets"
 )
 
 // SessionData represents user session data for serverless environment
 type SessionData struct {
-	ChatID        int64          `json:"chat_id"`
-	State         string         `json:"state"`
-	AuthStep      int            `json:"auth_step"`
-	TempLogin     string         `json:"temp_login"`
-	TempPassword  string         `json:"temp_password"`
-	TempRecipient string         `json:"temp_recipient"`
-	CurrentWeek   string         `json:"current_week"`
-	CurrentPeriod string         `json:"current_period"`
-	GeminiAPIKey  string         `json:"gemini_api_key"`
-	GeminiModel   string         `json:"gemini_model"`
-	GeminiContext string         `json:"gemini_context"`
-	CreatedAt     time.Time      `json:"created_at"`
-	LastAccess    time.Time      `json:"last_access"`
-	EljurAuth     *EljurAuthData `json:"eljur_auth,omitempty"`
-}
-
-// EljurAuthData stores authentication information for Eljur
+	ChatID            int64                        `json:"chat_id"`
+	State             State                        `json:"state"`
+	StateChangedAt    time.Time                    `json:"state_changed_at,omitempty"`
+	Auth              AuthFlow                     `json:"auth_flow"`
+	Compose           ComposeFlow                  `json:"compose_flow"`
+	CurrentWeek       string                       `json:"current_week"`
+	CurrentPeriod     string                       `json:"current_period"`
+	GeminiAPIKey      string                       `json:"gemini_api_key"`
+	GeminiModel       string                       `json:"gemini_model"`
+	GeminiContext     string                       `json:"gemini_context"`
+	GeminiHistory     []ChatTurn                   `json:"gemini_history,omitempty"`
+	LLMProvider       string                       `json:"llm_provider,omitempty"`
+	Periods           []eljur.Period               `json:"periods,omitempty"`            // кэш getperiods
+	PeriodsFetchedAt  time.Time                    `json:"periods_fetched_at,omitempty"` // время получения кэша периодов
+	NotifyMarks       bool                         `json:"notify_marks,omitempty"`
+	MarksSnapshots    map[string]map[string]string `json:"marks_snapshots,omitempty"` // keyed by student ID
+	NotifyCheckedAt   time.Time                    `json:"notify_checked_at,omitempty"`
+	NotifyMessages    bool                         `json:"notify_messages,omitempty"`
+	LastSeenMessageID string                       `json:"last_seen_message_id,omitempty"`
+	MessagesCheckedAt time.Time                    `json:"messages_checked_at,omitempty"`
+	QuietFrom         int                          `json:"quiet_from,omitempty"`
+	QuietTo           int                          `json:"quiet_to,omitempty"`
+	BotMessageIDs     []int                        `json:"bot_message_ids,omitempty"`
+	Callbacks         map[string]CallbackPayload   `json:"callbacks,omitempty"`
+	RememberPassword  bool                         `json:"remember_password,omitempty"`
+	CreatedAt         time.Time                    `json:"created_at"`
+	LastAccess        time.Time                    `json:"last_access"`
+	EljurAuth         *EljurAuthData               `json:"eljur_auth,omitempty"`
+}
+
+// EljurAuthData stores authentication information for Eljur.
+// An empty Token with a Login means the session has expired and the user is asked for the password.
 type EljurAuthData struct {
-	Login    string `json:"login"`
+	Login string `json:"login"`
+	// Password is kept only when the user enabled /autologin and sessions are encrypted
 	Password string `json:"password"`
 	Token    string `json:"token"`
+	Domain   string `json:"domain"`
+	// StudentID is the child selected with /child on parent accounts
+	StudentID string `json:"student_id,omitempty"`
 }
 
-// SessionManager manages user sessions in serverless environment
+// defaultSessionTTL is how long an idle session is kept before cleanup
+const defaultSessionTTL = 24 * time.Hour
+
+// cleanupInterval limits how often expired sessions are purged from the store
+const cleanupInterval = time.Hour
+
+// redactedValue replaces secrets in debug output
+const redactedValue = "[REDACTED]"
+
+// SessionManager manages user sessions on top of a pluggable SessionStore.
+// Secret fields are encrypted with keyring before they reach the store.
 type SessionManager struct {
-	sessions map[int64]*SessionData
-	mutex    sync.RWMutex
+	store       SessionStore
+	keyring     *secrets.Keyring
+	ttl         time.Duration
+	mutex       sync.Mutex
+	lastCleanup time.Time
 }
 
-// Global session manager instance
-var globalSessionManager = &SessionManager{
-	sessions: make(map[int64]*SessionData),
+// NewSessionManager creates a session manager backed by store.
+// A nil keyring stores secrets in plaintext.
+// Idle session lifetime can be overridden with SESSION_TTL (e.g. "720h").
+func NewSessionManager(store SessionStore, keyring *secrets.Keyring) *SessionManager {
+	ttl := defaultSessionTTL
+	if value := os.Getenv("SESSION_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			ttl = parsed
+		} else {
+			slog.Warn("Invalid SESSION_TTL, using default", "value", value, "default", defaultSessionTTL)
+		}
+	}
+
+	return &SessionManager{
+		store:   store,
+		keyring: keyring,
+		ttl:     ttl,
+	}
 }
 
-// GetUserStateServerless gets or creates user state for serverless environment
-func (b *Bot) GetUserStateServerless(chatID int64) *UserState {
+// Encrypted reports whether secret fields are encrypted before they reach the store
+func (sm *SessionManager) Encrypted() bool {
+	return sm.keyring != nil
+}
+
+// ValidateConfig checks the session settings from environment variables.
+// Entry points call it before handling updates, so a bad value is reported
+// as a configuration error instead of failing during package initialization.
+func ValidateConfig() error {
+	if _, err := secrets.KeyringFromEnv(); err != nil {
+		return fmt.Errorf("invalid SESSION_ENCRYPTION_KEYS: %w", err)
+	}
+	return nil
+}
+
+// newSessionManagerFromEnv creates the session manager configured by environment variables
+func newSessionManagerFromEnv() *SessionManager {
+	keyring, err := secrets.KeyringFromEnv()
+	if err != nil {
+		// ValidateConfig stops the entry points; until then keep sessions in memory
+		// so that secrets are never written to the configured store unencrypted
+		slog.Error("Invalid SESSION_ENCRYPTION_KEYS, sessions are kept in memory only", "err", err)
+		return NewSessionManager(NewMemorySessionStore(), nil)
+	}
+	if keyring == nil {
+		slog.Warn("SESSION_ENCRYPTION_KEYS is not set, session secrets are stored unencrypted")
+	}
+
+	return NewSessionManager(NewSessionStoreFromEnv(), keyring)
+}
+
+// Global session manager instance
+var globalSessionManager = newSessionManagerFromEnv()
+
+// GetUserStateServerless gets or creates user state for serverless environment.
+// Eljur requests made on behalf of the returned state are bound to ctx.
+func (b *Bot) GetUserStateServerless(ctx context.Context, chatID int64) *UserState {
 	sessionData := globalSessionManager.GetSession(chatID)
 
 	// Create UserState from session data
 	userState := &UserState{
-		ChatID:        sessionData.ChatID,
-		State:         sessionData.State,
-		AuthStep:      sessionData.AuthStep,
-		TempLogin:     sessionData.TempLogin,
-		TempPassword:  sessionData.TempPassword,
-		TempRecipient: sessionData.TempRecipient,
-		Client:        eljur.NewClient(),
-		CurrentWeek:   sessionData.CurrentWeek,
-		CurrentPeriod: sessionData.CurrentPeriod,
-		GeminiAPIKey:  sessionData.GeminiAPIKey,
-		GeminiModel:   sessionData.GeminiModel,
-		GeminiContext: sessionData.GeminiContext,
+		ChatID:            sessionData.ChatID,
+		Auth:              sessionData.Auth,
+		Compose:           sessionData.Compose,
+		Client:            eljur.NewClient(),
+		lastAccess:        sessionData.LastAccess,
+		CurrentWeek:       sessionData.CurrentWeek,
+		CurrentPeriod:     sessionData.CurrentPeriod,
+		GeminiAPIKey:      sessionData.GeminiAPIKey,
+		GeminiModel:       sessionData.GeminiModel,
+		GeminiContext:     sessionData.GeminiContext,
+		GeminiHistory:     sessionData.GeminiHistory,
+		LLMProvider:       sessionData.LLMProvider,
+		NotifyMarks:       sessionData.NotifyMarks,
+		MarksSnapshots:    sessionData.MarksSnapshots,
+		NotifyCheckedAt:   sessionData.NotifyCheckedAt,
+		NotifyMessages:    sessionData.NotifyMessages,
+		LastSeenMessageID: sessionData.LastSeenMessageID,
+		MessagesCheckedAt: sessionData.MessagesCheckedAt,
+		QuietFrom:         sessionData.QuietFrom,
+		QuietTo:           sessionData.QuietTo,
+		BotMessageIDs:     sessionData.BotMessageIDs,
+		Callbacks:         sessionData.Callbacks,
+		RememberPassword:  sessionData.RememberPassword,
+		ctx:               ctx,
 	}
+	userState.restoreState(sessionData.State, sessionData.StateChangedAt)
 
 	// Restore Eljur authentication if available
 	if sessionData.EljurAuth != nil && sessionData.EljurAuth.Token != "" {
-		log.Printf("Attempting to restore session for user %d: login=%s, token_length=%d", chatID, sessionData.EljurAuth.Login, len(sessionData.EljurAuth.Token))
-		// Restore authentication without exposing sensitive data
-		if err := userState.Client.RestoreSession(sessionData.EljurAuth.Login, sessionData.EljurAuth.Token); err != nil {
-			log.Printf("Failed to restore Eljur session for user %d: %v", chatID, err)
-			// Clear invalid auth data and save the updated session
-			sessionData.EljurAuth = nil
+		slog.Debug("Restoring Eljur session", "chat_id", chatID, "login", sessionData.EljurAuth.Login)
+		// Restore authentication without exposing sensitive data; the selected child
+		// is checked against the account's students once they are loaded
+		studentID := sessionData.EljurAuth.StudentID
+		userState.Client.SetStudent(studentID)
+		// A stored password lets the client re-authenticate if the token has expired
+		if userState.RememberPassword {
+			userState.Client.SetPassword(sessionData.EljurAuth.Password)
+		}
+		err := userState.Client.RestoreSession(ctx, sessionData.EljurAuth.Login, sessionData.EljurAuth.Token, sessionData.EljurAuth.Domain)
+		if errors.Is(err, eljur.ErrUnauthorized) {
+			slog.Info("Eljur token expired", "chat_id", chatID, "err", err)
+			// Drop the token but remember the login, so the next request asks for the password
+			userState.Client = eljur.NewClient()
+			userState.Client.SetStudent(studentID)
+			userState.expiredLogin = sessionData.EljurAuth.Login
+			sessionData.EljurAuth = &EljurAuthData{Login: userState.expiredLogin, StudentID: studentID}
 			globalSessionManager.SaveSession(sessionData)
+		} else if err != nil {
+			// Only a rejected token means the session is gone; on other errors keep it, the handler reports the failure
+			slog.Warn("Failed to restore Eljur session", "chat_id", chatID, "err", err)
 		} else {
-			log.Printf("Successfully restored session for user %d", chatID)
+			slog.Debug("Restored Eljur session", "chat_id", chatID)
+			if studentID != "" && userState.Client.GetStudentID() != studentID {
+				slog.Info("Selected student is no longer available", "chat_id", chatID, "student_id", studentID)
+			}
 		}
+	} else if sessionData.EljurAuth != nil && sessionData.EljurAuth.Login != "" {
+		slog.Debug("Eljur session has expired, waiting for password", "chat_id", chatID)
+		userState.Client.SetStudent(sessionData.EljurAuth.StudentID)
+		userState.expiredLogin = sessionData.EljurAuth.Login
 	} else {
-		log.Printf("No auth data to restore for user %d", chatID)
+		slog.Debug("No auth data to restore", "chat_id", chatID)
+	}
+
+	// Restore cached study periods
+	if len(sessionData.Periods) > 0 {
+		userState.Client.RestorePeriods(sessionData.Periods, sessionData.PeriodsFetchedAt)
 	}
 
 	return userState
@@ -88,99 +213,252 @@ func (b *Bot) GetUserStateServerless(chatID int64) *UserState {
 // SaveUserStateServerless saves user state for serverless environment
 func (b *Bot) SaveUserStateServerless(userState *UserState) {
 	sessionData := &SessionData{
-		ChatID:        userState.ChatID,
-		State:         userState.State,
-		AuthStep:      userState.AuthStep,
-		TempLogin:     userState.TempLogin,
-		TempPassword:  userState.TempPassword,
-		TempRecipient: userState.TempRecipient,
-		CurrentWeek:   userState.CurrentWeek,
-		CurrentPeriod: userState.CurrentPeriod,
-		GeminiAPIKey:  userState.GeminiAPIKey,
-		GeminiModel:   userState.GeminiModel,
-		GeminiContext: userState.GeminiContext,
-		LastAccess:    time.Now(),
+		ChatID:            userState.ChatID,
+		State:             userState.State,
+		StateChangedAt:    userState.StateChangedAt,
+		Auth:              userState.Auth,
+		Compose:           userState.Compose,
+		CurrentWeek:       userState.CurrentWeek,
+		CurrentPeriod:     userState.CurrentPeriod,
+		GeminiAPIKey:      userState.GeminiAPIKey,
+		GeminiModel:       userState.GeminiModel,
+		GeminiContext:     userState.GeminiContext,
+		GeminiHistory:     userState.GeminiHistory,
+		LLMProvider:       userState.LLMProvider,
+		NotifyMarks:       userState.NotifyMarks,
+		MarksSnapshots:    userState.MarksSnapshots,
+		NotifyCheckedAt:   userState.NotifyCheckedAt,
+		NotifyMessages:    userState.NotifyMessages,
+		LastSeenMessageID: userState.LastSeenMessageID,
+		MessagesCheckedAt: userState.MessagesCheckedAt,
+		QuietFrom:         userState.QuietFrom,
+		QuietTo:           userState.QuietTo,
+		BotMessageIDs:     userState.BotMessageIDs,
+		Callbacks:         userState.Callbacks,
+		RememberPassword:  userState.RememberPassword,
+		LastAccess:        userState.lastAccess,
 	}
 
 	// Save Eljur authentication if available
 	if userState.Client.IsAuthenticated() {
 		sessionData.EljurAuth = &EljurAuthData{
-			Login: userState.Client.GetLogin(),
-			Token: userState.Client.GetToken(),
+			Login:     userState.Client.GetLogin(),
+			Token:     userState.Client.GetToken(),
+			Domain:    userState.Client.GetDomain(),
+			StudentID: userState.Client.GetStudentID(),
+		}
+		// Never store the password in plaintext, even if the user opted in
+		if userState.RememberPassword && globalSessionManager.Encrypted() {
+			sessionData.EljurAuth.Password = userState.Client.GetPassword()
+		}
+		slog.Debug("Saving auth data", "chat_id", userState.ChatID, "login", sessionData.EljurAuth.Login)
+	} else if userState.expiredLogin != "" {
+		sessionData.EljurAuth = &EljurAuthData{
+			Login:     userState.expiredLogin,
+			StudentID: userState.Client.GetStudentID(),
 		}
-		log.Printf("Saving auth data for user %d: login=%s, token_length=%d", userState.ChatID, sessionData.EljurAuth.Login, len(sessionData.EljurAuth.Token))
 	}
 
+	// Save cached study periods
+	sessionData.Periods, sessionData.PeriodsFetchedAt = userState.Client.CachedPeriods()
+
 	globalSessionManager.SaveSession(sessionData)
 }
 
-// GetSession gets session data for a user
+// GetSession gets session data for a user, creating a fresh session if none is stored
 func (sm *SessionManager) GetSession(chatID int64) *SessionData {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
-
-	if session, exists := sm.sessions[chatID]; exists {
-		// Update last access time
-		session.LastAccess = time.Now()
-		return session
+	session, err := sm.store.Load(chatID)
+	if err == nil {
+		if time.Since(session.LastAccess) < sm.ttl {
+			sm.openSecrets(session)
+			return session
+		}
+		slog.Info("Session expired", "chat_id", chatID)
+	} else if !errors.Is(err, ErrSessionNotFound) {
+		slog.Error("Failed to load session", "chat_id", chatID, "err", err)
 	}
 
 	// Create new session
-	newSession := &SessionData{
+	return &SessionData{
 		ChatID:     chatID,
-		State:      "idle",
+		State:      StateIdle,
 		CreatedAt:  time.Now(),
 		LastAccess: time.Now(),
 	}
-
-	sm.mutex.RUnlock()
-	sm.mutex.Lock()
-	sm.sessions[chatID] = newSession
-	sm.mutex.Unlock()
-	sm.mutex.RLock()
-
-	return newSession
 }
 
-// SaveSession saves session data for a user
+// SaveSession saves session data for a user.
+// LastAccess is kept as is, so saves by background checks do not extend an idle
+// session; a zero LastAccess is set to the current time.
 func (sm *SessionManager) SaveSession(sessionData *SessionData) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+	if sessionData.LastAccess.IsZero() {
+		sessionData.LastAccess = time.Now()
+	}
 
-	sessionData.LastAccess = time.Now()
-	sm.sessions[sessionData.ChatID] = sessionData
+	// Keep the original creation time across saves
+	if sessionData.CreatedAt.IsZero() {
+		sessionData.CreatedAt = time.Now()
+		if existing, err := sm.store.Load(sessionData.ChatID); err == nil && !existing.CreatedAt.IsZero() {
+			sessionData.CreatedAt = existing.CreatedAt
+		}
+	}
+
+	sealed, err := sm.sealSecrets(sessionData)
+	if err != nil {
+		slog.Error("Failed to encrypt session", "chat_id", sessionData.ChatID, "err", err)
+		return
+	}
+
+	if err := sm.store.Save(sealed); err != nil {
+		slog.Error("Failed to save session", "chat_id", sessionData.ChatID, "err", err)
+	}
 
-	// Clean up old sessions (older than 24 hours)
 	sm.cleanupOldSessions()
 }
 
-// cleanupOldSessions removes sessions older than 24 hours
+// secretField is a session field that must never be stored or shown in plaintext
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields returns the secret fields of the session
+func secretFields(session *SessionData) []secretField {
+	fields := []secretField{{"gemini_api_key", &session.GeminiAPIKey}}
+	if session.EljurAuth != nil {
+		fields = append(fields,
+			secretField{"eljur_token", &session.EljurAuth.Token},
+			secretField{"eljur_password", &session.EljurAuth.Password},
+		)
+	}
+	return fields
+}
+
+// sealContext binds an encrypted field to its chat and field name,
+// so a sealed value copied into another session or field fails to decrypt
+func sealContext(chatID int64, field secretField) string {
+	return fmt.Sprintf("chat:%d/field:%s", chatID, field.name)
+}
+
+// copySession returns a copy of the session that does not share nested secrets
+func copySession(session *SessionData) *SessionData {
+	clone := *session
+	if session.EljurAuth != nil {
+		auth := *session.EljurAuth
+		clone.EljurAuth = &auth
+	}
+	return &clone
+}
+
+// sealSecrets returns a copy of the session with secret fields encrypted by the active key
+func (sm *SessionManager) sealSecrets(session *SessionData) (*SessionData, error) {
+	if sm.keyring == nil {
+		return session, nil
+	}
+
+	sealed := copySession(session)
+	for _, field := range secretFields(sealed) {
+		fieldContext := sealContext(sealed.ChatID, field)
+		value, err := sm.keyring.Open(*field.value, fieldContext)
+		if err != nil {
+			return nil, err
+		}
+		if *field.value, err = sm.keyring.Seal(value, fieldContext); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+// openSecrets decrypts secret fields of a loaded session in place.
+// Fields that cannot be decrypted (e.g. a retired key) are cleared.
+func (sm *SessionManager) openSecrets(session *SessionData) {
+	for _, field := range secretFields(session) {
+		if !secrets.IsSealed(*field.value) {
+			continue
+		}
+		if sm.keyring == nil {
+			slog.Error("Session has encrypted fields but no SESSION_ENCRYPTION_KEYS configured", "chat_id", session.ChatID)
+			*field.value = ""
+			continue
+		}
+		value, err := sm.keyring.Open(*field.value, sealContext(session.ChatID, field))
+		if err != nil {
+			slog.Error("Failed to decrypt session field", "chat_id", session.ChatID, "field", field.name, "err", err)
+			value = ""
+		}
+		*field.value = value
+	}
+}
+
+// redactSecrets returns a copy of the session with secret fields masked for debug output
+func redactSecrets(session *SessionData) *SessionData {
+	redacted := copySession(session)
+	for _, field := range secretFields(redacted) {
+		if *field.value != "" {
+			*field.value = redactedValue
+		}
+	}
+	return redacted
+}
+
+// cleanupOldSessions removes sessions idle for longer than the session TTL
 func (sm *SessionManager) cleanupOldSessions() {
-	cutoff := time.Now().Add(-24 * time.Hour)
+	sm.mutex.Lock()
+	if time.Since(sm.lastCleanup) < cleanupInterval {
+		sm.mutex.Unlock()
+		return
+	}
+	sm.lastCleanup = time.Now()
+	sm.mutex.Unlock()
 
-	for chatID, session := range sm.sessions {
+	sessions, err := sm.store.List()
+	if err != nil {
+		slog.Error("Failed to list sessions for cleanup", "err", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-sm.ttl)
+	for _, session := range sessions {
 		if session.LastAccess.Before(cutoff) {
-			delete(sm.sessions, chatID)
-			log.Printf("Cleaned up old session for user %d", chatID)
+			if err := sm.store.Delete(session.ChatID); err != nil {
+				slog.Error("Failed to clean up session", "chat_id", session.ChatID, "err", err)
+				continue
+			}
+			slog.Info("Cleaned up old session", "chat_id", session.ChatID)
+		}
+	}
+}
+
+// ListSessions returns all active sessions with secrets decrypted
+func (sm *SessionManager) ListSessions() ([]*SessionData, error) {
+	sessions, err := sm.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var active []*SessionData
+	for _, session := range sessions {
+		if time.Since(session.LastAccess) >= sm.ttl {
+			continue
 		}
+		sm.openSecrets(session)
+		active = append(active, session)
 	}
+	return active, nil
 }
 
 // ClearSession removes session data for a user
 func (sm *SessionManager) ClearSession(chatID int64) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
-	delete(sm.sessions, chatID)
+	if err := sm.store.Delete(chatID); err != nil {
+		slog.Error("Failed to clear session", "chat_id", chatID, "err", err)
+	}
 }
 
-// GetSessionJSON returns session data as JSON string for debugging
+// GetSessionJSON returns session data as JSON string for debugging, with secrets redacted
 func (sm *SessionManager) GetSessionJSON(chatID int64) string {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
-
-	if session, exists := sm.sessions[chatID]; exists {
-		if jsonData, err := json.MarshalIndent(session, "", "  "); err == nil {
+	if session, err := sm.store.Load(chatID); err == nil {
+		if jsonData, err := json.MarshalIndent(redactSecrets(session), "", "  "); err == nil {
 			return string(jsonData)
 		}
 	}
@@ -190,22 +468,28 @@ func (sm *SessionManager) GetSessionJSON(chatID int64) string {
 
 // GetStats returns session statistics
 func (sm *SessionManager) GetStats() map[string]interface{} {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
+	sessions, err := sm.store.List()
+	if err != nil {
+		slog.Error("Failed to list sessions for stats", "err", err)
+	}
 
 	activeSessions := 0
 	authenticatedSessions := 0
 
-	for _, session := range sm.sessions {
+	for _, session := range sessions {
 		activeSessions++
 		if session.EljurAuth != nil && session.EljurAuth.Token != "" {
 			authenticatedSessions++
 		}
 	}
 
+	sm.mutex.Lock()
+	lastCleanup := sm.lastCleanup
+	sm.mutex.Unlock()
+
 	return map[string]interface{}{
 		"total_sessions":         activeSessions,
 		"authenticated_sessions": authenticatedSessions,
-		"last_cleanup":           time.Now().Format(time.RFC3339),
+		"last_cleanup":           lastCleanup.Format(time.RFC3339),
 	}
 }
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrSessionNotFound is returned by a SessionStore when no session exists for a chat
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore persists user sessions between requests and restarts
+type SessionStore interface {
+	// Load returns the session for a chat or ErrSessionNotFound
+	Load(chatID int64) (*SessionData, error)
+	// Save creates or replaces the session for sessionData.ChatID
+	Save(sessionData *SessionData) error
+	// Delete removes the session for a chat; deleting a missing session is not an error
+	Delete(chatID int64) error
+	// List returns all stored sessions
+	List() ([]*SessionData, error)
+}
+
+// NewSessionStoreFromEnv creates the session store selected by SESSION_STORE.
+// Supported values: "memory" (default) and "file" (directory from SESSION_DIR).
+//
+// Both stores are local to one process or machine. A long-running bot (main.go) keeps
+// sessions across restarts with the file store. On serverless platforms such as Vercel
+// every instance has its own memory and /tmp, which is wiped on cold start, so sessions
+// are neither shared between instances nor durable there; SESSION_DIR must point to a
+// volume shared by all instances for sessions and notifications to work reliably.
+func NewSessionStoreFromEnv() SessionStore {
+	switch os.Getenv("SESSION_STORE") {
+	case "file":
+		dir := os.Getenv("SESSION_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "eljur-bot-sessions")
+		}
+		store, err := NewFileSessionStore(dir)
+		if err != nil {
+			slog.Error("Failed to open file session store, falling back to memory", "dir", dir, "err", err)
+			return NewMemorySessionStore()
+		}
+		slog.Info("Using file session store", "dir", dir)
+		return store
+	case "", "memory":
+		return NewMemorySessionStore()
+	default:
+		slog.Warn("Unknown SESSION_STORE, falling back to memory", "value", os.Getenv("SESSION_STORE"))
+		return NewMemorySessionStore()
+	}
+}
+
+// MemorySessionStore keeps sessions in process memory.
+// Sessions are stored serialized so callers never share mutable state with the store.
+type MemorySessionStore struct {
+	sessions map[int64][]byte
+	mutex    sync.RWMutex
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[int64][]byte),
+	}
+}
+
+// Load implements SessionStore
+func (s *MemorySessionStore) Load(chatID int64) (*SessionData, error) {
+	s.mutex.RLock()
+	data, exists := s.sessions[chatID]
+	s.mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	return decodeSession(data)
+}
+
+// Save implements SessionStore
+func (s *MemorySessionStore) Save(sessionData *SessionData) error {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[sessionData.ChatID] = data
+	return nil
+}
+
+// Delete implements SessionStore
+func (s *MemorySessionStore) Delete(chatID int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, chatID)
+	return nil
+}
+
+// List implements SessionStore
+func (s *MemorySessionStore) List() ([]*SessionData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sessions := make([]*SessionData, 0, len(s.sessions))
+	for _, data := range s.sessions {
+		session, err := decodeSession(data)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// decodeSession unmarshals a stored session
+func decodeSession(data []byte) (*SessionData, error) {
+	var session SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileSessionStore keeps one JSON file per chat in a directory on local disk.
+// Writes go through a temporary file and an atomic rename, so several
+// processes sharing the directory never observe a partially written session.
+// The directory survives restarts only if it is on persistent storage (not /tmp
+// of a serverless instance, see NewSessionStoreFromEnv).
+type FileSessionStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileSessionStore creates a file session store, creating dir if needed
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create session dir: %w", err)
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// path returns the file path for a chat session
+func (s *FileSessionStore) path(chatID int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(chatID, 10)+".json")
+}
+
+// Load implements SessionStore
+func (s *FileSessionStore) Load(chatID int64) (*SessionData, error) {
+	data, err := os.ReadFile(s.path(chatID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSession(data)
+}
+
+// Save implements SessionStore
+func (s *FileSessionStore) Save(sessionData *SessionData) error {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".session-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(sessionData.ChatID))
+}
+
+// Delete implements SessionStore
+func (s *FileSessionStore) Delete(chatID int64) error {
+	err := os.Remove(s.path(chatID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List implements SessionStore
+func (s *FileSessionStore) List() ([]*SessionData, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*SessionData
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		chatID, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		session, err := s.Load(chatID)
+		if err != nil {
+			slog.Warn("Skipping unreadable session file", "file", name, "err", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
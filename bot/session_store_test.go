@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"memory": func(t *testing.T) SessionStore { return NewMemorySessionStore() },
+		"file": func(t *testing.T) SessionStore {
+			store, err := NewFileSessionStore(filepath.Join(t.TempDir(), "sessions"))
+			if err != nil {
+				t.Fatalf("NewFileSessionStore() error = %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			if _, err := store.Load(1); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("Load(missing) error = %v, want ErrSessionNotFound", err)
+			}
+
+			session := &SessionData{ChatID: 1, CurrentWeek: "20241104", EljurAuth: &EljurAuthData{Login: "ivanov"}}
+			if err := store.Save(session); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if err := store.Save(&SessionData{ChatID: 2}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			// Хранилище не разделяет изменяемые данные с вызывающим кодом
+			session.EljurAuth.Login = "changed"
+			loaded, err := store.Load(1)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if loaded.CurrentWeek != "20241104" || loaded.EljurAuth.Login != "ivanov" {
+				t.Errorf("Load() = %+v, want saved session", loaded)
+			}
+
+			// Повторное сохранение заменяет сессию
+			loaded.CurrentWeek = "20241111"
+			if err := store.Save(loaded); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if reloaded, _ := store.Load(1); reloaded.CurrentWeek != "20241111" {
+				t.Errorf("Load() after replace = %q, want 20241111", reloaded.CurrentWeek)
+			}
+
+			if got := listChatIDs(t, store); !slices.Equal(got, []int64{1, 2}) {
+				t.Errorf("List() chats = %v, want [1 2]", got)
+			}
+
+			if err := store.Delete(1); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := store.Delete(1); err != nil {
+				t.Errorf("Delete(missing) error = %v, want nil", err)
+			}
+			if _, err := store.Load(1); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Load() after Delete error = %v, want ErrSessionNotFound", err)
+			}
+			if got := listChatIDs(t, store); !slices.Equal(got, []int64{2}) {
+				t.Errorf("List() chats after Delete = %v, want [2]", got)
+			}
+		})
+	}
+}
+
+func TestFileSessionStoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&SessionData{ChatID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Запись идет через временный файл, который переименовывается в файл сессии
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "1.json" {
+		t.Errorf("files after Save = %v, want only 1.json", entries)
+	}
+
+	// Недописанный временный файл другого экземпляра, посторонние и поврежденные файлы
+	files := map[string]string{
+		".session-123.tmp": `{"chat_id": 3`,
+		"notes.txt":        "not a session",
+		"abc.json":         `{"chat_id": 4}`,
+		"5.json":           `{"chat_id": 5, "current_week":`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.Load(5); err == nil || errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Load(corrupt) error = %v, want decode error", err)
+	}
+	if got := listChatIDs(t, store); !slices.Equal(got, []int64{1}) {
+		t.Errorf("List() chats = %v, want [1]", got)
+	}
+}
+
+// listChatIDs возвращает отсортированные чаты сессий из хранилища
+func listChatIDs(t *testing.T, store SessionStore) []int64 {
+	t.Helper()
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var ids []int64
+	for _, session := range sessions {
+		ids = append(ids, session.ChatID)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,87 @@
+package telegramtest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Text возвращает текст сообщения
+func (c Call) Text() string {
+	return c.Params.Get("text")
+}
+
+// ChatID возвращает chat_id вызова
+func (c Call) ChatID() (int64, error) {
+	return strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+}
+
+// MessageID возвращает message_id вызова
+func (c Call) MessageID() (int, error) {
+	return strconv.Atoi(c.Params.Get("message_id"))
+}
+
+// Keyboard возвращает inline клавиатуру вызова (nil, если клавиатуры нет)
+func (c Call) Keyboard() (*tgbotapi.InlineKeyboardMarkup, error) {
+	markup := c.Params.Get("reply_markup")
+	if markup == "" {
+		return nil, nil
+	}
+
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(markup), &keyboard); err != nil {
+		return nil, err
+	}
+	return &keyboard, nil
+}
+
+// Buttons возвращает все кнопки клавиатуры вызова по порядку
+func (c Call) Buttons() []tgbotapi.InlineKeyboardButton {
+	keyboard, _ := c.Keyboard()
+	return Buttons(keyboard)
+}
+
+// HasButton проверяет, есть ли в клавиатуре вызова кнопка с указанными callback данными
+func (c Call) HasButton(data string) bool {
+	for _, button := range c.Buttons() {
+		if button.CallbackData != nil && *button.CallbackData == data {
+			return true
+		}
+	}
+	return false
+}
+
+// CallbackData возвращает callback данные первой кнопки, данные которой начинаются с prefix
+func (c Call) CallbackData(prefix string) (string, bool) {
+	for _, button := range c.Buttons() {
+		if button.CallbackData != nil && strings.HasPrefix(*button.CallbackData, prefix) {
+			return *button.CallbackData, true
+		}
+	}
+	return "", false
+}
+
+// ButtonData возвращает callback данные первой кнопки, текст которой содержит label
+func (c Call) ButtonData(label string) (string, bool) {
+	for _, button := range c.Buttons() {
+		if button.CallbackData != nil && strings.Contains(button.Text, label) {
+			return *button.CallbackData, true
+		}
+	}
+	return "", false
+}
+
+// Buttons возвращает все кнопки клавиатуры по порядку
+func Buttons(keyboard *tgbotapi.InlineKeyboardMarkup) []tgbotapi.InlineKeyboardButton {
+	if keyboard == nil {
+		return nil
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, row := range keyboard.InlineKeyboard {
+		buttons = append(buttons, row...)
+	}
+	return buttons
+}
@@ -0,0 +1,506 @@
+// Package telegramtest предоставляет тестовый сервер, имитирующий Telegram Bot API.
+//
+// Сервер реализует методы, которые использует бот (getMe, sendMessage, editMessageText,
+// deleteMessage, answerCallbackQuery, getFile, sendPhoto, sendDocument), записывает
+// все вызовы и хранит переписку в каждом чате, чтобы сценарные тесты могли проверять,
+// что увидел пользователь. Пример из тестов пакета bot:
+//
+//	tg := telegramtest.NewServer()
+//	defer tg.Close()
+//	b := NewBotWithMessenger(newTestTelegramMessenger(t, tg)) // транспорт с tg.APIEndpoint() и tg.FileEndpoint()
+//	b.HandleMessage(ctx, TelegramMessage(tg.Message(chatID, "/start")))
+//	last := tg.LastCall("sendMessage")
+package telegramtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Значения по умолчанию для тестового бота
+const (
+	DefaultToken    = "123456:test-token"
+	DefaultBotID    = 123456
+	DefaultUsername = "test_diary_bot"
+)
+
+// Methods методы Bot API, которые реализует сервер
+var Methods = []string{
+	"getMe",
+	"sendMessage",
+	"editMessageText",
+	"deleteMessage",
+	"answerCallbackQuery",
+	"getFile",
+	"sendPhoto",
+	"sendDocument",
+}
+
+// Call описывает вызов метода Bot API
+type Call struct {
+	Method string
+	Params url.Values
+	Files  map[string]UploadedFile // файлы, загруженные через multipart
+}
+
+// UploadedFile описывает файл, отправленный ботом
+type UploadedFile struct {
+	Name string
+	Data []byte
+}
+
+// Message описывает сообщение в чате: отправленное ботом или пользователем
+type Message struct {
+	ID       int
+	ChatID   int64
+	Text     string // текст или подпись к файлу
+	FromBot  bool
+	Keyboard *tgbotapi.InlineKeyboardMarkup
+	File     *UploadedFile // фото или документ
+}
+
+// Server имитирует Telegram Bot API поверх httptest.Server
+type Server struct {
+	*httptest.Server
+
+	Token string
+
+	mu            sync.Mutex
+	calls         []Call
+	chats         map[int64][]*Message
+	files         map[string]file
+	failures      map[string]failure
+	lastMessageID int
+	lastQueryID   int
+}
+
+// file описывает файл, доступный через getFile
+type file struct {
+	path string
+	data []byte
+}
+
+// failure описывает ошибку, которую вернет метод при следующем вызове
+type failure struct {
+	code        int
+	description string
+}
+
+// NewServer запускает тестовый сервер Bot API
+func NewServer() *Server {
+	s := &Server{
+		Token:    DefaultToken,
+		chats:    make(map[int64][]*Message),
+		files:    make(map[string]file),
+		failures: make(map[string]failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// APIEndpoint возвращает шаблон адреса API в формате tgbotapi.APIEndpoint
+func (s *Server) APIEndpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// FileEndpoint возвращает шаблон адреса файлов в формате tgbotapi.FileEndpoint
+func (s *Server) FileEndpoint() string {
+	return s.URL + "/file/bot%s/%s"
+}
+
+// AddFile делает файл доступным через getFile и для скачивания
+func (s *Server) AddFile(fileID string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileID] = file{path: "files/" + fileID, data: data}
+}
+
+// Fail заставляет метод вернуть ошибку при следующем вызове
+func (s *Server) Fail(method string, code int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = failure{code: code, description: description}
+}
+
+// Calls возвращает вызовы метода (все вызовы, если method пустой)
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// LastCall возвращает последний вызов метода. Возвращает пустой Call, если вызовов не было.
+func (s *Server) LastCall(method string) Call {
+	calls := s.Calls(method)
+	if len(calls) == 0 {
+		return Call{}
+	}
+	return calls[len(calls)-1]
+}
+
+// Reset очищает записанные вызовы, не трогая переписку в чатах
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// Messages возвращает текущие сообщения чата с учетом правок и удалений
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.chats[chatID]))
+	for _, message := range s.chats[chatID] {
+		messages = append(messages, *message)
+	}
+	return messages
+}
+
+// LastBotMessage возвращает последнее сообщение бота в чате
+func (s *Server) LastBotMessage(chatID int64) (Message, bool) {
+	messages := s.Messages(chatID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].FromBot {
+			return messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Message создает входящее текстовое сообщение от пользователя
+func (s *Server) Message(chatID int64, text string) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userMessage(chatID, text)
+}
+
+// Photo создает входящее фото от пользователя. Данные фото нужно добавить через AddFile.
+func (s *Server) Photo(chatID int64, fileID, caption string) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.userMessage(chatID, "")
+	message.Caption = caption
+	message.Photo = []tgbotapi.PhotoSize{
+		{FileID: fileID + "_small", FileUniqueID: fileID + "_small", Width: 90, Height: 90},
+		{FileID: fileID, FileUniqueID: fileID, Width: 1280, Height: 960, FileSize: len(s.files[fileID].data)},
+	}
+	return message
+}
+
+// Callback создает нажатие на кнопку под последним сообщением бота в чате
+func (s *Server) Callback(chatID int64, data string) *tgbotapi.CallbackQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var source *Message
+	for _, message := range s.chats[chatID] {
+		if message.FromBot {
+			source = message
+		}
+	}
+
+	message := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID, Type: "private"}, Date: int(time.Now().Unix())}
+	if source != nil {
+		message.MessageID = source.ID
+		message.Text = source.Text
+		message.ReplyMarkup = source.Keyboard
+		message.From = s.botUser()
+	}
+
+	s.lastQueryID++
+	return &tgbotapi.CallbackQuery{
+		ID:      strconv.Itoa(s.lastQueryID),
+		From:    user(chatID),
+		Message: message,
+		Data:    data,
+	}
+}
+
+// userMessage создает сообщение пользователя и добавляет его в чат. Вызывается под s.mu.
+func (s *Server) userMessage(chatID int64, text string) *tgbotapi.Message {
+	s.lastMessageID++
+	s.chats[chatID] = append(s.chats[chatID], &Message{ID: s.lastMessageID, ChatID: chatID, Text: text})
+
+	return &tgbotapi.Message{
+		MessageID: s.lastMessageID,
+		From:      user(chatID),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+}
+
+// botUser возвращает пользователя-бота
+func (s *Server) botUser() *tgbotapi.User {
+	return &tgbotapi.User{ID: DefaultBotID, IsBot: true, FirstName: "Дневник", UserName: DefaultUsername}
+}
+
+// user возвращает пользователя личного чата
+func user(chatID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: chatID, FirstName: "Ученик", LanguageCode: "ru"}
+}
+
+// handle обрабатывает запрос к Bot API или к файлу
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"+s.Token+"/"); ok {
+		s.handleFile(w, path)
+		return
+	}
+
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+s.Token+"/")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	call := Call{Method: method, Params: r.Form}
+	if r.MultipartForm != nil {
+		call.Files = readFiles(r.MultipartForm.File)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+
+	if f, ok := s.failures[method]; ok {
+		delete(s.failures, method)
+		writeError(w, f.code, f.description)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, s.botUser())
+	case "sendMessage":
+		s.handleSendMessage(w, call)
+	case "editMessageText":
+		s.handleEditMessageText(w, call)
+	case "deleteMessage":
+		s.handleDeleteMessage(w, call)
+	case "answerCallbackQuery":
+		writeResult(w, true)
+	case "getFile":
+		s.handleGetFile(w, call)
+	case "sendPhoto":
+		s.handleSendFile(w, call, "photo")
+	case "sendDocument":
+		s.handleSendFile(w, call, "document")
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// handleSendMessage добавляет сообщение бота в чат
+func (s *Server) handleSendMessage(w http.ResponseWriter, call Call) {
+	chatID, err := call.ChatID()
+	if err != nil || call.Text() == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request: message text is empty")
+		return
+	}
+	keyboard, err := call.Keyboard()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: can't parse reply keyboard markup JSON object")
+		return
+	}
+
+	s.lastMessageID++
+	message := &Message{ID: s.lastMessageID, ChatID: chatID, Text: call.Text(), FromBot: true, Keyboard: keyboard}
+	s.chats[chatID] = append(s.chats[chatID], message)
+
+	writeResult(w, s.apiMessage(message))
+}
+
+// handleSendFile добавляет в чат фото или документ, загруженный в поле field
+func (s *Server) handleSendFile(w http.ResponseWriter, call Call, field string) {
+	chatID, err := call.ChatID()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat not found")
+		return
+	}
+	f, ok := call.Files[field]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: there is no "+field+" in the request")
+		return
+	}
+
+	s.lastMessageID++
+	message := &Message{ID: s.lastMessageID, ChatID: chatID, Text: call.Params.Get("caption"), FromBot: true, File: &f}
+	s.chats[chatID] = append(s.chats[chatID], message)
+
+	result := s.apiMessage(message)
+	result.Text = ""
+	result.Caption = message.Text
+	writeResult(w, result)
+}
+
+// handleEditMessageText изменяет текст и клавиатуру сообщения бота
+func (s *Server) handleEditMessageText(w http.ResponseWriter, call Call) {
+	message := s.findMessage(call)
+	switch {
+	case message == nil:
+		writeError(w, http.StatusBadRequest, "Bad Request: message to edit not found")
+		return
+	case !message.FromBot:
+		writeError(w, http.StatusBadRequest, "Bad Request: message can't be edited")
+		return
+	}
+
+	keyboard, err := call.Keyboard()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: can't parse reply keyboard markup JSON object")
+		return
+	}
+	if message.Text == call.Text() && keyboardsEqual(message.Keyboard, keyboard) {
+		writeError(w, http.StatusBadRequest, "Bad Request: message is not modified")
+		return
+	}
+
+	message.Text = call.Text()
+	message.Keyboard = keyboard
+	writeResult(w, s.apiMessage(message))
+}
+
+// handleDeleteMessage удаляет сообщение из чата
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, call Call) {
+	chatID, _ := call.ChatID()
+	messageID, _ := call.MessageID()
+
+	messages := s.chats[chatID]
+	for i, message := range messages {
+		if message.ID == messageID {
+			s.chats[chatID] = append(messages[:i:i], messages[i+1:]...)
+			writeResult(w, true)
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "Bad Request: message to delete not found")
+}
+
+// handleGetFile возвращает путь к файлу для скачивания
+func (s *Server) handleGetFile(w http.ResponseWriter, call Call) {
+	fileID := call.Params.Get("file_id")
+	f, ok := s.files[fileID]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: invalid file_id")
+		return
+	}
+
+	writeResult(w, tgbotapi.File{FileID: fileID, FileUniqueID: fileID, FileSize: len(f.data), FilePath: f.path})
+}
+
+// handleFile отдает содержимое файла
+func (s *Server) handleFile(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.files {
+		if f.path == path {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(f.data)
+			return
+		}
+	}
+	http.NotFound(w, nil)
+}
+
+// findMessage ищет сообщение по chat_id и message_id вызова. Вызывается под s.mu.
+func (s *Server) findMessage(call Call) *Message {
+	chatID, err := call.ChatID()
+	if err != nil {
+		return nil
+	}
+	messageID, err := call.MessageID()
+	if err != nil {
+		return nil
+	}
+
+	for _, message := range s.chats[chatID] {
+		if message.ID == messageID {
+			return message
+		}
+	}
+	return nil
+}
+
+// apiMessage преобразует сообщение бота в формат ответа Bot API
+func (s *Server) apiMessage(message *Message) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID:   message.ID,
+		From:        s.botUser(),
+		Chat:        &tgbotapi.Chat{ID: message.ChatID, Type: "private"},
+		Date:        int(time.Now().Unix()),
+		Text:        message.Text,
+		ReplyMarkup: message.Keyboard,
+	}
+}
+
+// readFiles читает файлы multipart запроса
+func readFiles(headers map[string][]*multipart.FileHeader) map[string]UploadedFile {
+	files := make(map[string]UploadedFile)
+	for field, list := range headers {
+		if len(list) == 0 {
+			continue
+		}
+		f, err := list[0].Open()
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		files[field] = UploadedFile{Name: list[0].Filename, Data: data}
+	}
+	return files
+}
+
+// keyboardsEqual сравнивает клавиатуры
+func keyboardsEqual(a, b *tgbotapi.InlineKeyboardMarkup) bool {
+	left, _ := json.Marshal(a)
+	right, _ := json.Marshal(b)
+	return string(left) == string(right)
+}
+
+// writeResult отправляет успешный ответ Bot API
+func writeResult(w http.ResponseWriter, result interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "result": result})
+}
+
+// writeError отправляет ошибку в формате Bot API
+func writeError(w http.ResponseWriter, code int, description string) {
+	writeJSON(w, code, map[string]interface{}{"ok": false, "error_code": code, "description": description})
+}
+
+// writeJSON отправляет JSON ответ
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(fmt.Sprintf("telegramtest: marshal response: %v", err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -1,92 +1,171 @@
 package bot
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
 	"school-diary-bot/bot/eljur"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// maxTrackedMessages сколько последних сообщений бота запоминается для очистки чата
+const maxTrackedMessages = 100
+
 // UserState представляет состояние пользователя
 type UserState struct {
-	ChatID       int64
-	State        string // "idle", "auth_waiting", "message_compose", "week_select", "gemini_api_setup", "gemini_chat"
-	AuthStep     int    // 0 - не авторизован, 1 - логин, 2 - пароль
-	TempLogin    string
-	TempPassword string
-	TempRecipient string // ID выбранного получателя
-	Client       *eljur.Client
-	CurrentWeek  string
-	CurrentPeriod string
-	GeminiAPIKey string // API ключ для Gemini
-	GeminiModel  string // Выбранная модель Gemini
-	GeminiContext string // Контекст для Gemini (домашнее задание и т.д.)
+	ChatID            int64
+	State             State       // Текущее состояние диалога (см. stateSpecs)
+	StateChangedAt    time.Time   // Время перехода в текущее состояние (для таймаутов)
+	Auth              AuthFlow    // Данные пошаговой авторизации
+	Compose           ComposeFlow // Данные написания сообщения
+	Client            *eljur.Client
+	CurrentWeek       string
+	CurrentPeriod     string
+	GeminiAPIKey      string                       // API ключ для Gemini
+	GeminiModel       string                       // Выбранная модель Gemini
+	GeminiContext     string                       // Контекст для Gemini (домашнее задание и т.д.)
+	GeminiHistory     []ChatTurn                   // История диалога с Gemini
+	LLMProvider       string                       // Провайдер AI: "gemini" (по умолчанию) или "openai"
+	NotifyMarks       bool                         // Подписка на уведомления о новых оценках
+	MarksSnapshots    map[string]map[string]string // Последние известные снимки оценок по ID ребенка
+	NotifyCheckedAt   time.Time                    // Время последней проверки уведомлений
+	NotifyMessages    bool                         // Подписка на уведомления о новых сообщениях
+	LastSeenMessageID string                       // ID последнего известного входящего сообщения
+	MessagesCheckedAt time.Time                    // Время последней проверки входящих; пустое до первой проверки
+	QuietFrom         int                          // Начало тихих часов (час)
+	QuietTo           int                          // Конец тихих часов (час), равен QuietFrom если выключены
+	BotMessageIDs     []int                        // ID сообщений бота в чате (для очистки чата)
+	Callbacks         map[string]CallbackPayload   // Параметры кнопок по токенам (см. encodeCallback)
+	RememberPassword  bool                         // Пользователь разрешил хранить пароль для автоматического входа
+
+	editMessageID int             // сообщение с нажатой кнопкой, которое заменит первый ответ обработчика
+	ctx           context.Context // контекст обрабатываемого обновления, ограничивает запросы к Эльжур и модели
+	request       PendingRequest  // обрабатываемый запрос, повторяется после входа при истекшей сессии
+	expiredLogin  string          // логин, сессия которого истекла; пустой, если пользователь не входил или вышел
+	lastAccess    time.Time       // последнее обращение пользователя; фоновые проверки его не продлевают
 }
 
 // Bot представляет основную структуру бота
 type Bot struct {
-	API   *tgbotapi.BotAPI
-	Users  map[int64]*UserState
+	Messenger Messenger
+	Users     map[int64]*UserState
+
+	router    *Router
+	inputs    map[State]InputHandler
+	limiter   *rateLimiter // nil отключает ограничение частоты запросов
+	userLocks sync.Map     // chatID -> *sync.Mutex
 }
 
-// NewBot создает новый экземпляр бота (оптимизировано для serverless)
+// NewBot создает бота, работающего через Telegram (оптимизировано для serverless)
 func NewBot(token string) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(token)
+	telegram, err := NewTelegramMessenger(token)
 	if err != nil {
 		return nil, err
 	}
+	return NewBotWithMessenger(telegram), nil
+}
 
-	// Отключаем debug в production для лучшей производительности
-	api.Debug = false
-
-	return &Bot{
-		API:   api,
-		Users: make(map[int64]*UserState),
-	}, nil
+// NewBotWithMessenger создает бота, доставляющего сообщения через указанный транспорт
+func NewBotWithMessenger(messenger Messenger) *Bot {
+	b := &Bot{
+		Messenger: messenger,
+		Users:     make(map[int64]*UserState),
+		limiter:   sharedRateLimiter,
+	}
+	b.router = b.routes()
+	b.inputs = b.stateInputs()
+	return b
 }
 
 // GetUserState получает или создает состояние пользователя (legacy метод)
-func (b *Bot) GetUserState(chatID int64) *UserState {
+func (b *Bot) GetUserState(ctx context.Context, chatID int64) *UserState {
 	// В webhook режиме используем serverless метод
-	return b.GetUserStateServerless(chatID)
+	user := b.GetUserStateServerless(ctx, chatID)
+	// Обращение пользователя продлевает сессию (см. SESSION_TTL)
+	user.lastAccess = time.Now()
+	return user
+}
+
+// lockUser блокирует обработку пользователя, чтобы фоновые проверки
+// не перезаписывали состояние, изменяемое обработчиками. Возвращает функцию разблокировки.
+func (b *Bot) lockUser(chatID int64) func() {
+	value, _ := b.userLocks.LoadOrStore(chatID, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
 }
 
 // SendMessage отправляет сообщение пользователю
-func (b *Bot) SendMessage(chatID int64, text string, keyboard interface{}) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "HTML" // Используем HTML вместо Markdown для лучшей совместимости
+func (b *Bot) SendMessage(chatID int64, text string, keyboard Keyboard) error {
+	_, err := b.Messenger.Send(chatID, text, keyboard)
+	return err
+}
+
+// EditMessage редактирует сообщение
+func (b *Bot) EditMessage(chatID int64, messageID int, text string, keyboard Keyboard) error {
+	return b.Messenger.Edit(chatID, messageID, text, keyboard)
+}
 
-	if keyboard != nil {
-		if kb, ok := keyboard.(tgbotapi.InlineKeyboardMarkup); ok {
-			msg.ReplyMarkup = &kb
+// AnswerCallback отвечает на callback query
+func (b *Bot) AnswerCallback(callbackID, text string) {
+	b.Messenger.AnswerCallback(callbackID, text)
+}
+
+// reply показывает ответ обработчика. Если обработчик вызван нажатием на кнопку,
+// первый ответ заменяет сообщение с этой кнопкой, чтобы навигация по меню не засоряла чат.
+// Если сообщение нельзя изменить (фото, документ, слишком старое), ответ отправляется новым сообщением.
+func (b *Bot) reply(user *UserState, text string, keyboard Keyboard) error {
+	if messageID := user.editMessageID; messageID != 0 {
+		user.editMessageID = 0
+
+		err := b.EditMessage(user.ChatID, messageID, text, keyboard)
+		if err == nil || errors.Is(err, ErrNotModified) {
+			return nil
 		}
+		slog.Debug("Не удалось изменить сообщение, отправляем новое", "chat_id", user.ChatID, "message_id", messageID, "err", err)
 	}
 
-	_, err := b.API.Send(msg)
-	return err
+	return b.send(user, text, keyboard)
 }
 
-// EditMessage редактирует сообщение
-func (b *Bot) EditMessage(chatID int64, messageID int, text string, keyboard interface{}) error {
-	msg := tgbotapi.NewEditMessageText(chatID, messageID, text)
-	msg.ParseMode = "HTML" // Используем HTML вместо Markdown для лучшей совместимости
+// send отправляет новое сообщение и запоминает его ID для очистки чата
+func (b *Bot) send(user *UserState, text string, keyboard Keyboard) error {
+	messageID, err := b.Messenger.Send(user.ChatID, text, keyboard)
+	if err != nil {
+		return err
+	}
 
-	if keyboard != nil {
-		if kb, ok := keyboard.(tgbotapi.InlineKeyboardMarkup); ok {
-			msg.ReplyMarkup = &kb
-		}
+	user.trackMessage(messageID)
+	return nil
+}
+
+// trackMessage запоминает ID сообщения бота, храня не более maxTrackedMessages последних
+func (u *UserState) trackMessage(messageID int) {
+	if messageID == 0 {
+		return
 	}
 
-	_, err := b.API.Send(msg)
-	return err
+	u.BotMessageIDs = append(u.BotMessageIDs, messageID)
+	if extra := len(u.BotMessageIDs) - maxTrackedMessages; extra > 0 {
+		u.BotMessageIDs = append([]int(nil), u.BotMessageIDs[extra:]...)
+	}
 }
 
-// AnswerCallback отвечает на callback query
-func (b *Bot) AnswerCallback(callbackID, text string) {
-	callback := tgbotapi.NewCallback(callbackID, text)
-	b.API.Request(callback)
+// showProgress отправляет временное сообщение (например, "думает...") и возвращает
+// функцию, которая удаляет его после завершения долгой операции
+func (b *Bot) showProgress(chatID int64, text string) func() {
+	messageID, err := b.Messenger.Send(chatID, text, nil)
+	return func() {
+		if err == nil && messageID != 0 {
+			b.Messenger.Delete(chatID, messageID)
+		}
+	}
 }
 
 // SaveUserStateIfNeeded сохраняет состояние пользователя если нужно (webhook mode)
 func (b *Bot) SaveUserStateIfNeeded(userState *UserState) {
 	// В webhook режиме автоматически сохраняем состояние после каждой операции
 	b.SaveUserStateServerless(userState)
-}
\ No newline at end of file
+}
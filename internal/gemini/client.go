@@ -2,6 +2,8 @@ package gemini
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -20,31 +22,65 @@ type Client struct {
 func NewClient(apiKey, model string) *Client {
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second, // Увеличиваем таймаут для Gemini
+			// Верхняя граница для запросов без дедлайна; в webhook запрос ограничен контекстом
+			Timeout: 60 * time.Second,
 		},
 		apiKey: apiKey,
 		model:  model,
 	}
 }
 
+// Роли участников диалога
+const (
+	RoleUser  = "user"
+	RoleModel = "model"
+)
+
 // GeminiRequest представляет запрос к Gemini
 type GeminiRequest struct {
-	Contents []Content `json:"contents"`
+	Contents          []Content `json:"contents"`
+	SystemInstruction *Content  `json:"systemInstruction,omitempty"`
 }
 
 // Content представляет содержимое сообщения
 type Content struct {
+	Role  string `json:"role,omitempty"` // RoleUser или RoleModel
 	Parts []Part `json:"parts"`
 }
 
-// Part представляет часть сообщения
+// Part представляет часть сообщения: текст или встроенные данные (изображение)
 type Part struct {
-	Text string `json:"text"`
+	Text       string      `json:"text,omitempty"`
+	InlineData *InlineData `json:"inline_data,omitempty"`
+}
+
+// InlineData представляет файл, переданный прямо в запросе (base64)
+type InlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+// NewImagePart создает часть сообщения с изображением
+func NewImagePart(mimeType string, data []byte) Part {
+	return Part{
+		InlineData: &InlineData{
+			MimeType: mimeType,
+			Data:     base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
+
+// NewTextContent создает сообщение из текста от имени указанной роли
+func NewTextContent(role, text string) Content {
+	return Content{
+		Role:  role,
+		Parts: []Part{{Text: text}},
+	}
 }
 
 // GeminiResponse представляет ответ от Gemini
 type GeminiResponse struct {
-	Candidates []Candidate `json:"candidates"`
+	Candidates []Candidate  `json:"candidates"`
 	Error      *GeminiError `json:"error,omitempty"`
 }
 
@@ -60,28 +96,31 @@ type GeminiError struct {
 	Status  string `json:"status"`
 }
 
-// SendMessage отправляет сообщение в Gemini и получает ответ
-func (c *Client) SendMessage(message string, context string) (string, error) {
+// SendMessage отправляет одиночное сообщение в Gemini и получает ответ
+func (c *Client) SendMessage(ctx context.Context, message string, systemInstruction string) (string, error) {
 	// Проверяем входные данные
 	if strings.TrimSpace(message) == "" {
 		return "", fmt.Errorf("сообщение не может быть пустым")
 	}
 
-	// Формируем полный запрос с контекстом
-	fullMessage := message
-	if context != "" {
-		fullMessage = fmt.Sprintf("Контекст: %s\n\nВопрос: %s", context, message)
+	return c.Chat(ctx, []Content{NewTextContent(RoleUser, message)}, systemInstruction)
+}
+
+// Chat отправляет историю диалога в Gemini и возвращает ответ модели.
+// Последнее сообщение в history должно быть от пользователя.
+func (c *Client) Chat(ctx context.Context, history []Content, systemInstruction string) (string, error) {
+	if len(history) == 0 || history[len(history)-1].Role != RoleUser {
+		return "", fmt.Errorf("диалог должен заканчиваться сообщением пользователя")
 	}
 
 	// Подготавливаем запрос
 	request := GeminiRequest{
-		Contents: []Content{
-			{
-				Parts: []Part{
-					{Text: fullMessage},
-				},
-			},
-		},
+		Contents: history,
+	}
+	if systemInstruction != "" {
+		request.SystemInstruction = &Content{
+			Parts: []Part{{Text: systemInstruction}},
+		}
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -89,17 +128,19 @@ func (c *Client) SendMessage(message string, context string) (string, error) {
 		return "", fmt.Errorf("ошибка создания JSON: %w", err)
 	}
 
-	// Формируем URL
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", c.model, c.apiKey)
+	// Формируем URL. Ключ передается заголовком, а не параметром, чтобы не попасть
+	// в текст ошибок net/http, которые содержат адрес запроса
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", c.model)
 
 	// Создаем HTTP запрос
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("ошибка создания запроса: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	req.Header.Set("Accept", "application/json")
+	req.Header.Set("x-goog-api-key", c.apiKey)
 
 	// Отправляем запрос
 	resp, err := c.httpClient.Do(req)
@@ -130,7 +171,7 @@ func (c *Client) SendMessage(message string, context string) (string, error) {
 	}
 
 	response := geminiResp.Candidates[0].Content.Parts[0].Text
-	
+
 	// Очищаем ответ от потенциально проблемных символов
 	response = strings.ReplaceAll(response, "\u0000", "")
 	response = strings.TrimSpace(response)
@@ -143,10 +184,10 @@ func (c *Client) SendMessage(message string, context string) (string, error) {
 }
 
 // ValidateAPIKey проверяет валидность API ключа
-func (c *Client) ValidateAPIKey() error {
+func (c *Client) ValidateAPIKey(ctx context.Context) error {
 	// Проверяем валидность ключа
 	testClient := NewClient(c.apiKey, "gemini-2.0-flash-exp")
-	_, err := testClient.SendMessage("Привет! Это тестовое сообщение для проверки API ключа.", "")
+	_, err := testClient.SendMessage(ctx, "Привет! Это тестовое сообщение для проверки API ключа.", "")
 	return err
 }
 
@@ -165,16 +206,16 @@ func GetAvailableModels() []string {
 // GetModelDescription возвращает описание модели
 func GetModelDescription(model string) string {
 	descriptions := map[string]string{
-		"gemini-1.5-flash": "🚀 Быстрая модель - оптимальна для простых запросов",
-		"gemini-1.5-pro":   "🧠 Продвинутая модель - лучше для сложных задач",
-		"gemini-1.0-pro":   "⚡ Стандартная модель - баланс скорости и качества",
+		"gemini-1.5-flash":     "🚀 Быстрая модель - оптимальна для простых запросов",
+		"gemini-1.5-pro":       "🧠 Продвинутая модель - лучше для сложных задач",
+		"gemini-1.0-pro":       "⚡ Стандартная модель - баланс скорости и качества",
 		"gemini-2.0-flash-exp": "✨ Новейшая модель Gemini 2.0 Flash Experimental",
-		"gemini-2.5-pro": "🚀 Продвинутая модель Gemini 2.5 Pro",
-		"gemini-2.5-flash": "⚡ Быстрая модель Gemini 2.5 Flash",
+		"gemini-2.5-pro":       "🚀 Продвинутая модель Gemini 2.5 Pro",
+		"gemini-2.5-flash":     "⚡ Быстрая модель Gemini 2.5 Flash",
 	}
 
 	if desc, exists := descriptions[model]; exists {
 		return desc
 	}
 	return "📝 Стандартная модель Gemini"
-}
\ No newline at end of file
+}
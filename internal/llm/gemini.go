@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+
+	"school-diary-bot/internal/gemini"
+)
+
+// GeminiProvider использует Google Gemini через клиент internal/gemini
+type GeminiProvider struct {
+	client *gemini.Client
+}
+
+// NewGemini создает провайдера Gemini с ключом и моделью пользователя
+func NewGemini(apiKey, model string) *GeminiProvider {
+	return &GeminiProvider{
+		client: gemini.NewClient(apiKey, model),
+	}
+}
+
+// Name возвращает название провайдера
+func (p *GeminiProvider) Name() string {
+	return "Gemini AI"
+}
+
+// Chat отправляет диалог в Gemini
+func (p *GeminiProvider) Chat(ctx context.Context, req Request) (string, error) {
+	contents := make([]gemini.Content, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		role := gemini.RoleUser
+		if msg.Role == RoleAssistant {
+			role = gemini.RoleModel
+		}
+
+		content := gemini.NewTextContent(role, msg.Text)
+		if len(msg.Images) > 0 {
+			parts := make([]gemini.Part, 0, len(msg.Images)+1)
+			for _, image := range msg.Images {
+				parts = append(parts, gemini.NewImagePart(image.MimeType, image.Data))
+			}
+			content.Parts = append(parts, content.Parts...)
+		}
+		contents = append(contents, content)
+	}
+
+	return p.client.Chat(ctx, contents, req.System)
+}
@@ -0,0 +1,51 @@
+// Package llm описывает общий интерфейс языковых моделей, используемых ассистентом.
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// Роли участников диалога
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Идентификаторы провайдеров
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+)
+
+// ErrNotConfigured возвращается, если провайдер не настроен на сервере
+var ErrNotConfigured = errors.New("провайдер не настроен")
+
+// Image представляет изображение, прикрепленное к сообщению
+type Image struct {
+	MimeType string
+	Data     []byte
+}
+
+// Message представляет одно сообщение диалога
+type Message struct {
+	Role   string // RoleUser или RoleAssistant
+	Text   string
+	Images []Image
+}
+
+// Request представляет запрос к модели: системная инструкция и история диалога.
+// Последнее сообщение должно быть от пользователя.
+type Request struct {
+	System   string
+	Messages []Message
+}
+
+// Provider представляет языковую модель, с которой можно вести диалог
+type Provider interface {
+	// Name возвращает название провайдера для отображения пользователю
+	Name() string
+	// Chat отправляет диалог модели и возвращает ее ответ. Запрос прерывается
+	// вместе с ctx, чтобы ответ модели укладывался в дедлайн обработки обновления.
+	Chat(ctx context.Context, req Request) (string, error)
+}
@@ -0,0 +1,195 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider работает с любым OpenAI-совместимым API (/chat/completions):
+// OpenAI, Ollama, llama.cpp server, vLLM и т.п.
+type OpenAIProvider struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+}
+
+// NewOpenAI создает OpenAI-совместимого провайдера.
+// baseURL указывает на корень API, например http://localhost:11434/v1
+func NewOpenAI(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		httpClient: &http.Client{
+			// Верхняя граница для запросов без дедлайна; в webhook запрос ограничен контекстом
+			Timeout: 60 * time.Second,
+		},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+	}
+}
+
+// OpenAIConfigured проверяет, настроен ли OpenAI-совместимый провайдер на сервере
+func OpenAIConfigured() bool {
+	return os.Getenv("OPENAI_BASE_URL") != "" && os.Getenv("OPENAI_MODEL") != ""
+}
+
+// NewOpenAIFromEnv создает провайдера из OPENAI_BASE_URL, OPENAI_API_KEY и OPENAI_MODEL.
+// Адрес задается только администратором сервера, пользователи не могут его изменить.
+func NewOpenAIFromEnv() (*OpenAIProvider, error) {
+	if !OpenAIConfigured() {
+		return nil, ErrNotConfigured
+	}
+	return NewOpenAI(os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_MODEL")), nil
+}
+
+// Name возвращает название провайдера: локальной модели, OpenAI или другого сервиса по адресу API
+func (p *OpenAIProvider) Name() string {
+	host := ""
+	if u, err := url.Parse(p.baseURL); err == nil {
+		host = u.Hostname()
+	}
+
+	switch {
+	case isLocalHost(host):
+		return fmt.Sprintf("Локальная модель (%s)", p.model)
+	case host == "api.openai.com":
+		return fmt.Sprintf("OpenAI (%s)", p.model)
+	case host != "":
+		return fmt.Sprintf("%s (%s)", p.model, host)
+	}
+	return p.model
+}
+
+// isLocalHost проверяет, указывает ли адрес на эту машину или локальную сеть
+func isLocalHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
+
+// openAIRequest представляет запрос /chat/completions
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+}
+
+// openAIMessage представляет сообщение; Content - строка или список частей
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// openAIPart представляет часть сообщения с текстом или изображением
+type openAIPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+// openAIImageURL представляет изображение в виде data URL
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// openAIResponse представляет ответ /chat/completions
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Chat отправляет диалог в OpenAI-совместимое API
+func (p *OpenAIProvider) Chat(ctx context.Context, req Request) (string, error) {
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != RoleUser {
+		return "", fmt.Errorf("диалог должен заканчиваться сообщением пользователя")
+	}
+
+	request := openAIRequest{Model: p.model}
+	if req.System != "" {
+		request.Messages = append(request.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		request.Messages = append(request.Messages, toOpenAIMessage(msg))
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания JSON: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpReq.Header.Set("Accept", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("ошибка отправки запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("неожиданный статус ответа: %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("ошибка парсинга ответа: %w", err)
+	}
+
+	if apiResp.Error != nil {
+		return "", fmt.Errorf("ошибка модели: %s", apiResp.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("неожиданный статус ответа: %d", resp.StatusCode)
+	}
+	if len(apiResp.Choices) == 0 {
+		return "", fmt.Errorf("получен пустой ответ от модели")
+	}
+
+	response := strings.TrimSpace(strings.ReplaceAll(apiResp.Choices[0].Message.Content, "\u0000", ""))
+	if response == "" {
+		return "", fmt.Errorf("получен пустой текст ответа от модели")
+	}
+	return response, nil
+}
+
+// toOpenAIMessage преобразует сообщение; изображения передаются как data URL
+func toOpenAIMessage(msg Message) openAIMessage {
+	role := RoleUser
+	if msg.Role == RoleAssistant {
+		role = RoleAssistant
+	}
+
+	if len(msg.Images) == 0 {
+		return openAIMessage{Role: role, Content: msg.Text}
+	}
+
+	parts := make([]openAIPart, 0, len(msg.Images)+1)
+	for _, image := range msg.Images {
+		dataURL := fmt.Sprintf("data:%s;base64,%s", image.MimeType, base64.StdEncoding.EncodeToString(image.Data))
+		parts = append(parts, openAIPart{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURL}})
+	}
+	parts = append(parts, openAIPart{Type: "text", Text: msg.Text})
+	return openAIMessage{Role: role, Content: parts}
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAIName(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"http://localhost:11434/v1", "Локальная модель (llama)"},
+		{"http://127.0.0.1:8080/v1", "Локальная модель (llama)"},
+		{"http://192.168.1.10:11434/v1", "Локальная модель (llama)"},
+		{"http://gpu.local/v1", "Локальная модель (llama)"},
+		{"https://api.openai.com/v1", "OpenAI (llama)"},
+		{"https://openrouter.ai/api/v1", "llama (openrouter.ai)"},
+		{"", "llama"},
+	}
+
+	for _, tt := range tests {
+		if got := NewOpenAI(tt.baseURL, "", "llama").Name(); got != tt.want {
+			t.Errorf("Name() for %q = %q, want %q", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIChat(t *testing.T) {
+	var got struct {
+		Path          string
+		Authorization string
+		Body          map[string]any
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Path = r.URL.Path
+		got.Authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got.Body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "  Ответ модели\u0000 "}}]}`))
+	}))
+	defer srv.Close()
+
+	provider := NewOpenAI(srv.URL+"/v1/", "sk-test", "llama")
+	response, err := provider.Chat(context.Background(), Request{
+		System: "Ты помощник",
+		Messages: []Message{
+			{Role: RoleUser, Text: "Привет"},
+			{Role: RoleAssistant, Text: "Здравствуйте"},
+			{Role: RoleUser, Text: "Что на картинке?", Images: []Image{{MimeType: "image/png", Data: []byte("png")}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if response != "Ответ модели" {
+		t.Errorf("Chat() = %q, want cleaned response", response)
+	}
+
+	if got.Path != "/v1/chat/completions" || got.Authorization != "Bearer sk-test" {
+		t.Errorf("request path = %q, authorization = %q", got.Path, got.Authorization)
+	}
+	body, _ := json.Marshal(got.Body)
+	for _, want := range []string{
+		`"model":"llama"`,
+		`{"content":"Ты помощник","role":"system"}`,
+		`{"content":"Здравствуйте","role":"assistant"}`,
+		`"url":"data:image/png;base64,cG5n"`,
+		`{"text":"Что на картинке?","type":"text"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("request body does not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestOpenAIChatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"api error", http.StatusBadRequest, `{"error": {"message": "model not found"}}`, "model not found"},
+		{"status", http.StatusBadGateway, `bad gateway`, "502"},
+		{"no choices", http.StatusOK, `{"choices": []}`, "пустой ответ"},
+		{"empty text", http.StatusOK, `{"choices": [{"message": {"content": " "}}]}`, "пустой текст"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewOpenAI(srv.URL, "", "llama").Chat(context.Background(), Request{Messages: []Message{{Role: RoleUser, Text: "?"}}})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Chat() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewOpenAI("http://localhost", "", "llama").Chat(context.Background(), Request{}); err == nil {
+		t.Error("Chat() without user message error = nil")
+	}
+}
+
+func TestOpenAIChatContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// Запрос прерывается по дедлайну контекста, не дожидаясь таймаута клиента
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewOpenAI(srv.URL, "", "llama").Chat(ctx, Request{Messages: []Message{{Role: RoleUser, Text: "?"}}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Chat() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Chat() took %v after context deadline", elapsed)
+	}
+}
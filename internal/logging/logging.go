@@ -0,0 +1,122 @@
+// Package logging настраивает структурированный логгер (log/slog), который
+// маскирует секреты: пароли, токены авторизации, devkey и API ключи.
+//
+// Уровень задается LOG_LEVEL (debug, info, warn, error; по умолчанию info),
+// формат - LOG_FORMAT (text или json). Подробные сообщения уровня debug
+// (запросы к Эльжур, тексты сообщений пользователей) выводятся, только если
+// LOG_LEVEL=debug задан явно.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted заменяет скрытые значения
+const Redacted = "[REDACTED]"
+
+// secretKeys имена атрибутов, значения которых никогда не выводятся
+var secretKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"auth_token":    true,
+	"devkey":        true,
+	"key":           true,
+	"api_key":       true,
+	"secret":        true,
+	"cookie":        true,
+	"authorization": true,
+}
+
+// redactions шаблоны секретов внутри произвольного текста: сообщений, URL, тел запросов и ошибок
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Параметры URL и формы: ?devkey=...&auth_token=..., login=...&password=...
+	{regexp.MustCompile(`(?i)\b(devkey|auth_token|token|password|api_key|key)=[^&\s"']+`), "${1}=" + Redacted},
+	// Поля JSON: {"token":"..."}
+	{regexp.MustCompile(`(?i)("(?:devkey|auth_token|token|password|api_key|key)"\s*:\s*)"[^"]*"`), `${1}"` + Redacted + `"`},
+	// Пароль в команде /login логин пароль
+	{regexp.MustCompile(`(?i)(/login(?:@\w+)?\s+\S+\s+)\S+`), "${1}" + Redacted},
+	// Токен Telegram бота в адресе Bot API
+	{regexp.MustCompile(`\bbot\d+:[\w-]{20,}`), "bot" + Redacted},
+	// Ключи Gemini и OpenAI
+	{regexp.MustCompile(`\bAIza[\w-]{20,}`), Redacted},
+	{regexp.MustCompile(`\bsk-[\w-]{20,}`), Redacted},
+	// Заголовок Authorization
+	{regexp.MustCompile(`(?i)(Bearer\s+)[\w.~+/-]+=*`), "${1}" + Redacted},
+}
+
+// Redact маскирует секреты в тексте
+func Redact(s string) string {
+	for _, r := range redactions {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// New создает логгер, который пишет в w сообщения уровня level и выше
+func New(w io.Writer, level slog.Leveler, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+var initOnce sync.Once
+
+// Init делает логгер, настроенный по LOG_LEVEL и LOG_FORMAT, логгером по умолчанию.
+// Сообщения стандартного пакета log тоже проходят через него и маскируются.
+// Повторные вызовы ничего не делают.
+func Init() {
+	initOnce.Do(func() {
+		level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+		slog.SetDefault(New(os.Stderr, level, strings.EqualFold(os.Getenv("LOG_FORMAT"), "json")))
+		if err != nil {
+			slog.Warn("Invalid LOG_LEVEL, using info", "err", err)
+		}
+	})
+}
+
+// ParseLevel разбирает уровень логирования. Пустая строка означает info.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(value) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("некорректный уровень логирования %q", value)
+	}
+	return level, nil
+}
+
+// redactAttr маскирует значения атрибутов с секретными именами и секреты внутри
+// строк, включая текст сообщения и ошибки
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		if a.Value.Kind() == slog.KindString && a.Value.String() == "" {
+			return a
+		}
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(Redact(v.String()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "eljur url",
+			in:   "https://api.eljur.ru/apiv3/getdiary?auth_token=abc123&devkey=dev456&days=20241014-20241020",
+			want: "https://api.eljur.ru/apiv3/getdiary?auth_token=[REDACTED]&devkey=[REDACTED]&days=20241014-20241020",
+		},
+		{
+			name: "auth form",
+			in:   "login=ivanov&password=secret",
+			want: "login=ivanov&password=[REDACTED]",
+		},
+		{
+			name: "json token",
+			in:   `{"response":{"result":{"token": "abc123","expires":"2024-11-01"}}}`,
+			want: `{"response":{"result":{"token": "[REDACTED]","expires":"2024-11-01"}}}`,
+		},
+		{
+			name: "login command",
+			in:   "Processing message: /login Ivanov password123",
+			want: "Processing message: /login Ivanov [REDACTED]",
+		},
+		{
+			name: "gemini url",
+			in:   `Post "https://generativelanguage.googleapis.com/v1beta/models/gemini:generateContent?key=AIzaSyA1234567890abcdefghij": timeout`,
+			want: `Post "https://generativelanguage.googleapis.com/v1beta/models/gemini:generateContent?key=[REDACTED]": timeout`,
+		},
+		{
+			name: "telegram token",
+			in:   "https://api.telegram.org/bot123456:ABCdefGHIjklMNOpqrSTUvwxYZ/sendMessage",
+			want: "https://api.telegram.org/bot[REDACTED]/sendMessage",
+		},
+		{
+			name: "plain text",
+			in:   "User 1001 opened diary",
+			want: "User 1001 opened diary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Errorf("Redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, false)
+
+	logger.Info("request /login ivanov s3cr3t",
+		"password", "s3cr3t",
+		"url", "getrules?auth_token=tok-777",
+		"err", errors.New("devkey=dev-555 rejected"),
+		slog.Group("auth", "token", "tok-777"),
+	)
+	logger.Debug("debug details", "body", "visible only at debug")
+
+	out := buf.String()
+	for _, secret := range []string{"s3cr3t", "tok-777", "dev-555"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q: %s", secret, out)
+		}
+	}
+	if strings.Contains(out, "debug details") {
+		t.Errorf("debug message written at info level: %s", out)
+	}
+	if !strings.Contains(out, "auth.token=[REDACTED]") {
+		t.Errorf("grouped secret is not redacted: %s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for value, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := ParseLevel(value); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
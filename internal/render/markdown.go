@@ -0,0 +1,309 @@
+// Package render преобразует Markdown-ответы AI в HTML, поддерживаемый Telegram.
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	headerRe      = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	bulletRe      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedRe     = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	quoteRe       = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	ruleRe        = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_]))*\s*$`)
+	fenceRe       = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([\\w+#.-]*)")
+	allowedScheme = []string{"http://", "https://", "tg://", "mailto:"}
+)
+
+// MarkdownToHTML преобразует Markdown в HTML с тегами, которые понимает Telegram:
+// жирный, курсив, зачеркнутый, код, блоки кода, ссылки, цитаты.
+// Заголовки становятся жирным текстом, списки - строками с "•",
+// формулы LaTeX выводятся как код. Весь остальной текст экранируется.
+func MarkdownToHTML(md string) string {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	md = strings.ReplaceAll(md, "\u0000", "")
+	lines := strings.Split(md, "\n")
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Блок кода ```lang ... ```
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence := m[1]
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence[:3]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			out = append(out, codeBlock(strings.Join(code, "\n"), m[2]))
+			continue
+		}
+
+		// Формула LaTeX на отдельных строках: $$ ... $$ или \[ ... \].
+		// Без закрывающего разделителя строка остается обычным текстом,
+		// иначе формула поглотила бы весь остаток ответа.
+		if open, close, ok := mathBlockDelims(trimmed); ok {
+			if end, closed := mathBlockEnd(lines, i, open, close); closed {
+				formula := []string{strings.TrimPrefix(trimmed, open)}
+				for i++; i <= end; i++ {
+					formula = append(formula, strings.TrimSpace(lines[i]))
+				}
+				i--
+				last := len(formula) - 1
+				formula[last] = strings.TrimSuffix(formula[last], close)
+				out = append(out, codeBlock(strings.TrimSpace(strings.Join(formula, "\n")), ""))
+				continue
+			}
+		}
+
+		// Цитата: собираем подряд идущие строки
+		if quoteRe.MatchString(line) {
+			var quote []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				quote = append(quote, inline(quoteRe.FindStringSubmatch(lines[i])[1]))
+			}
+			i--
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			out = append(out, "")
+		case ruleRe.MatchString(line) && len(trimmed) >= 3:
+			out = append(out, "——————")
+		case headerRe.MatchString(line):
+			out = append(out, "<b>"+inline(headerRe.FindStringSubmatch(line)[1])+"</b>")
+		case bulletRe.MatchString(line):
+			m := bulletRe.FindStringSubmatch(line)
+			out = append(out, listIndent(m[1])+"• "+inline(m[2]))
+		case orderedRe.MatchString(line):
+			m := orderedRe.FindStringSubmatch(line)
+			out = append(out, listIndent(m[1])+m[2]+". "+inline(m[3]))
+		default:
+			out = append(out, inline(line))
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// codeBlock оформляет блок кода, указывая язык, если он известен
+func codeBlock(code, lang string) string {
+	if lang == "" {
+		return "<pre>" + html.EscapeString(code) + "</pre>"
+	}
+	return `<pre><code class="language-` + html.EscapeString(lang) + `">` + html.EscapeString(code) + "</code></pre>"
+}
+
+// mathBlockDelims определяет, начинается ли строка с блочной формулы LaTeX
+func mathBlockDelims(line string) (open, close string, ok bool) {
+	switch {
+	case strings.HasPrefix(line, "$$"):
+		return "$$", "$$", true
+	case strings.HasPrefix(line, `\[`):
+		return `\[`, `\]`, true
+	}
+	return "", "", false
+}
+
+// mathBlockEnd находит строку, которой заканчивается блочная формула, начатая в строке start
+func mathBlockEnd(lines []string, start int, open, close string) (int, bool) {
+	body := strings.TrimPrefix(strings.TrimSpace(lines[start]), open)
+	for i := start; i < len(lines); i++ {
+		if i > start {
+			body = strings.TrimSpace(lines[i])
+		}
+		if strings.HasSuffix(body, close) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// listIndent сохраняет вложенность списков (по два пробела на уровень)
+func listIndent(indent string) string {
+	level := len(strings.ReplaceAll(indent, "\t", "    ")) / 2
+	return strings.Repeat("  ", level)
+}
+
+// inline преобразует строчную разметку: **жирный**, *курсив*, ~~зачеркнутый~~,
+// `код`, [ссылки](url), $формулы$ и экранирование символов обратной косой чертой.
+func inline(text string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		switch {
+		case rest[0] == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				code := strings.TrimSpace(rest[ticks : ticks+end])
+				out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += ticks + end + ticks
+				continue
+			}
+
+		case strings.HasPrefix(rest, `\(`):
+			if end := strings.Index(rest[2:], `\)`); end >= 0 {
+				out.WriteString("<code>" + html.EscapeString(strings.TrimSpace(rest[2:2+end])) + "</code>")
+				i += 2 + end + 2
+				continue
+			}
+
+		case rest[0] == '\\' && len(rest) > 1 && isEscapable(rest[1]):
+			out.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case rest[0] == '$':
+			if end, ok := inlineMathEnd(rest); ok {
+				out.WriteString("<code>" + html.EscapeString(rest[1:end]) + "</code>")
+				i += end + 1
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, url, n, ok := parseLink(rest); ok {
+				out.WriteString(`<a href="` + html.EscapeString(url) + `">` + inline(label) + "</a>")
+				i += n
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, n, ok := delimited(text, i, rest[:2]); ok {
+				out.WriteString("<b>" + inline(inner) + "</b>")
+				i += n
+				continue
+			}
+
+		case strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := delimited(text, i, "~~"); ok {
+				out.WriteString("<s>" + inline(inner) + "</s>")
+				i += n
+				continue
+			}
+
+		case rest[0] == '*' || rest[0] == '_':
+			if inner, n, ok := delimited(text, i, rest[:1]); ok {
+				out.WriteString("<i>" + inline(inner) + "</i>")
+				i += n
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		out.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+
+	return out.String()
+}
+
+// delimited ищет парный разделитель для выделения, начинающегося с позиции start.
+// Возвращает внутренний текст и общую длину выделения вместе с разделителями.
+func delimited(text string, start int, delim string) (string, int, bool) {
+	// "_" внутри слов (snake_case) не является выделением
+	if delim[0] == '_' && start > 0 && isWordByte(text[start-1]) {
+		return "", 0, false
+	}
+
+	body := text[start+len(delim):]
+	if body == "" || body[0] == ' ' || (len(delim) == 1 && body[0] == delim[0]) {
+		return "", 0, false
+	}
+
+	for offset := 0; offset < len(body); {
+		end := strings.Index(body[offset:], delim)
+		if end < 0 {
+			return "", 0, false
+		}
+		end += offset
+
+		after := end + len(delim)
+		switch {
+		case end == 0 || body[end-1] == ' ':
+			// Закрывающий разделитель не может идти после пробела
+		case len(delim) == 1 && after < len(body) && body[after] == delim[0]:
+			// Одиночный разделитель не должен быть частью двойного
+			after++
+		case delim[0] == '_' && after < len(body) && isWordByte(body[after]):
+			// "_" перед буквой не закрывает выделение
+		default:
+			return body[:end], len(delim) + after, true
+		}
+		offset = after
+	}
+	return "", 0, false
+}
+
+// inlineMathEnd находит закрывающий "$" строчной формулы.
+// Денежные суммы вроде "$5 и $10" формулами не считаются.
+func inlineMathEnd(rest string) (int, bool) {
+	if len(rest) < 3 || rest[1] == '$' || rest[1] == ' ' {
+		return 0, false
+	}
+	for end := 2; end < len(rest); end++ {
+		if rest[end] == '\n' {
+			return 0, false
+		}
+		if rest[end] != '$' || rest[end-1] == ' ' || rest[end-1] == '\\' {
+			continue
+		}
+		if end+1 < len(rest) && rest[end+1] >= '0' && rest[end+1] <= '9' {
+			return 0, false
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+// parseLink разбирает ссылку вида [текст](url). Разрешены только безопасные схемы.
+func parseLink(rest string) (label, url string, n int, ok bool) {
+	closeLabel := strings.Index(rest, "](")
+	if closeLabel < 1 || strings.Contains(rest[:closeLabel], "\n") {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(rest[closeLabel+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+
+	label = rest[1:closeLabel]
+	url = strings.TrimSpace(rest[closeLabel+2 : closeLabel+2+closeURL])
+	if strings.ContainsAny(url, " \n") || !hasAllowedScheme(url) {
+		return "", "", 0, false
+	}
+	return label, url, closeLabel + 2 + closeURL + 1, true
+}
+
+// hasAllowedScheme проверяет, что ссылка ведет на разрешенную схему
+func hasAllowedScheme(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range allowedScheme {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEscapable проверяет, экранирует ли обратная косая черта этот символ в Markdown
+func isEscapable(c byte) bool {
+	return strings.IndexByte("\\`*_{}[]()#+-.!~|>$", c) >= 0
+}
+
+// isWordByte проверяет, является ли байт частью слова (буква, цифра или байт UTF-8)
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
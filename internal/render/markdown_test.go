@@ -0,0 +1,36 @@
+package render
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"escaping", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"emphasis", "**жирный**, *курсив*, ~~зачеркнутый~~", "<b>жирный</b>, <i>курсив</i>, <s>зачеркнутый</s>"},
+		{"snake case", "snake_case_name", "snake_case_name"},
+		{"inline code", "`a<b>`", "<code>a&lt;b&gt;</code>"},
+		{"code block", "```go\nif a < b {}\n```", `<pre><code class="language-go">if a &lt; b {}</code></pre>`},
+		{"link", "[сайт](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2">сайт</a>`},
+		{"unsafe link", "[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"header", "## Итог", "<b>Итог</b>"},
+		{"list", "- один\n  - два\n1. три", "• один\n  • два\n1. три"},
+		{"quote", "> цитата <b>", "<blockquote>цитата &lt;b&gt;</blockquote>"},
+		{"inline math", "$x^2 < y$", "<code>x^2 &lt; y</code>"},
+		{"money", "$5 и $10", "$5 и $10"},
+		{"math block", "$$\nx < 1\n$$\nдальше", "<pre>x &lt; 1</pre>\nдальше"},
+		{"one line math block", "$$x = 1$$", "<pre>x = 1</pre>"},
+		{"bracket math block", "\\[\na + b\n\\]", "<pre>a + b</pre>"},
+		{"unclosed math block", "$$ цена\n**итог** < 5", "$$ цена\n<b>итог</b> &lt; 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarkdownToHTML(tt.md); got != tt.want {
+				t.Errorf("MarkdownToHTML(%q) = %q, want %q", tt.md, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// token представляет неделимую часть HTML: тег, сущность (&amp;) или один символ
+type token struct {
+	text  string
+	tag   string // имя тега для открывающих и закрывающих тегов
+	open  bool   // открывающий тег
+	close bool   // закрывающий тег
+}
+
+// openTag представляет открытый тег вместе с исходной записью (с атрибутами)
+type openTag struct {
+	name string
+	raw  string
+}
+
+// maxTokenLen наибольшая длина неделимого текстового токена: сущности до 11 символов (см. tokenize)
+const maxTokenLen = 11
+
+// SplitHTML разбивает HTML на части длиной не более limit символов (в единицах UTF-16,
+// как считает Telegram). Разрыв никогда не приходится на середину тега, сущности
+// или символа; открытые теги закрываются в конце части и открываются заново в следующей.
+// По возможности текст разрывается по переводу строки, затем по пробелу.
+// Теги, которые вместе с объемлющими не оставляют в части места для текста
+// (например, ссылка с очень длинным адресом), отбрасываются, а их текст сохраняется.
+func SplitHTML(text string, limit int) []string {
+	if textLen(text) <= limit {
+		return []string{text}
+	}
+
+	tokens := dropOversizedTags(tokenize(text), limit)
+	var parts []string
+	var stack []openTag
+
+	for i := 0; i < len(tokens); {
+		var part strings.Builder
+		prefix := reopenTags(stack)
+		part.WriteString(prefix)
+		size := textLen(prefix)
+		current := append([]openTag(nil), stack...)
+
+		// Лучшие места для разрыва: после перевода строки и после пробела
+		type breakPoint struct {
+			next  int
+			bytes int
+			size  int
+			stack []openTag
+		}
+		var lineBreak, spaceBreak *breakPoint
+
+		j := i
+		for ; j < len(tokens); j++ {
+			next := applyToken(current, tokens[j])
+			tokenSize := textLen(tokens[j].text)
+			if size+tokenSize+closingLen(next) > limit && j > i {
+				break
+			}
+
+			part.WriteString(tokens[j].text)
+			size += tokenSize
+			current = next
+
+			switch tokens[j].text {
+			case "\n":
+				lineBreak = &breakPoint{next: j + 1, bytes: part.Len(), size: size, stack: current}
+			case " ":
+				spaceBreak = &breakPoint{next: j + 1, bytes: part.Len(), size: size, stack: current}
+			}
+		}
+
+		content := part.String()
+		if j < len(tokens) {
+			cut := spaceBreak
+			if lineBreak != nil && lineBreak.size >= limit/2 {
+				cut = lineBreak
+			}
+			if cut != nil && cut.next > i {
+				content = content[:cut.bytes]
+				current = cut.stack
+				j = cut.next
+			}
+		}
+
+		// Telegram не принимает пустые сообщения, в том числе из одних тегов
+		if hasText(content[len(prefix):]) {
+			parts = append(parts, content+closeTags(current))
+		}
+		stack = current
+		i = j
+	}
+
+	return parts
+}
+
+// tokenize разбивает HTML на теги, сущности и отдельные символы
+func tokenize(text string) []token {
+	var tokens []token
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		switch rest[0] {
+		case '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				raw := rest[:end+1]
+				tokens = append(tokens, parseTag(raw))
+				i += len(raw)
+				continue
+			}
+		case '&':
+			if end := strings.IndexByte(rest, ';'); end > 0 && end <= 10 && !strings.ContainsAny(rest[1:end], " &<") {
+				tokens = append(tokens, token{text: rest[:end+1]})
+				i += end + 1
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		tokens = append(tokens, token{text: rest[:size]})
+		i += size
+	}
+	return tokens
+}
+
+// dropOversizedTags убирает открывающие теги, после которых открытые теги вместе с
+// закрывающими не оставляют в части limit места даже для одного токена текста,
+// и парные им закрывающие теги
+func dropOversizedTags(tokens []token, limit int) []token {
+	type entry struct {
+		tag     openTag
+		dropped bool
+	}
+	var stack []entry
+	cost := 0 // длина открытых (не отброшенных) тегов вместе с закрывающими
+
+	kept := make([]token, 0, len(tokens))
+	for _, t := range tokens {
+		switch {
+		case t.open:
+			tagCost := textLen(t.text) + len(t.tag) + 3
+			dropped := cost+tagCost+maxTokenLen > limit
+			if !dropped {
+				cost += tagCost
+				kept = append(kept, t)
+			}
+			stack = append(stack, entry{tag: openTag{name: t.tag, raw: t.text}, dropped: dropped})
+		case t.close:
+			k := len(stack) - 1
+			for ; k >= 0 && stack[k].tag.name != t.tag; k-- {
+			}
+			if k < 0 {
+				kept = append(kept, t)
+				continue
+			}
+			for _, e := range stack[k:] {
+				if !e.dropped {
+					cost -= textLen(e.tag.raw) + len(e.tag.name) + 3
+				}
+			}
+			if !stack[k].dropped {
+				kept = append(kept, t)
+			}
+			stack = stack[:k]
+		default:
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// hasText проверяет, есть ли в HTML видимый текст кроме пробелов
+func hasText(text string) bool {
+	for _, t := range tokenize(text) {
+		if !t.open && !t.close && strings.TrimSpace(t.text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTag разбирает открывающий или закрывающий тег
+func parseTag(raw string) token {
+	inner := strings.TrimSuffix(strings.TrimPrefix(raw, "<"), ">")
+	closing := strings.HasPrefix(inner, "/")
+	inner = strings.TrimPrefix(inner, "/")
+
+	name := inner
+	if idx := strings.IndexAny(inner, " \t\n"); idx >= 0 {
+		name = inner[:idx]
+	}
+	name = strings.ToLower(name)
+
+	return token{text: raw, tag: name, open: !closing, close: closing}
+}
+
+// applyToken возвращает стек открытых тегов после добавления токена
+func applyToken(stack []openTag, t token) []openTag {
+	switch {
+	case t.open:
+		next := make([]openTag, len(stack), len(stack)+1)
+		copy(next, stack)
+		return append(next, openTag{name: t.tag, raw: t.text})
+	case t.close:
+		for k := len(stack) - 1; k >= 0; k-- {
+			if stack[k].name == t.tag {
+				return append([]openTag(nil), stack[:k]...)
+			}
+		}
+	}
+	return stack
+}
+
+// reopenTags открывает заново теги, оставшиеся открытыми в предыдущей части
+func reopenTags(stack []openTag) string {
+	var b strings.Builder
+	for _, tag := range stack {
+		b.WriteString(tag.raw)
+	}
+	return b.String()
+}
+
+// closeTags закрывает открытые теги в обратном порядке
+func closeTags(stack []openTag) string {
+	var b strings.Builder
+	for k := len(stack) - 1; k >= 0; k-- {
+		b.WriteString("</" + stack[k].name + ">")
+	}
+	return b.String()
+}
+
+// closingLen возвращает длину закрывающих тегов для стека
+func closingLen(stack []openTag) int {
+	n := 0
+	for _, tag := range stack {
+		n += len(tag.name) + 3
+	}
+	return n
+}
+
+// textLen возвращает длину текста в единицах UTF-16, как ее считает Telegram
+func textLen(text string) int {
+	n := 0
+	for _, r := range text {
+		if r > 0xFFFF {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
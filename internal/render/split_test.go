@@ -0,0 +1,72 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+// plainText возвращает текст HTML без тегов и пробельных символов
+func plainText(text string) string {
+	var b strings.Builder
+	for _, t := range tokenize(text) {
+		if !t.open && !t.close && strings.TrimSpace(t.text) != "" {
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+func TestSplitHTML(t *testing.T) {
+	longURL := "https://example.com/" + strings.Repeat("x", 200)
+
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string // nil - проверяются только общие свойства частей
+	}{
+		{name: "fits", text: "<b>коротко</b>", limit: 20, want: []string{"<b>коротко</b>"}},
+		{name: "line break", text: "первая строка\nвторая строка", limit: 20, want: []string{"первая строка\n", "вторая строка"}},
+		{name: "reopen tags", text: "<b>один два три четыре</b>", limit: 20, want: []string{"<b>один два три </b>", "<b>четыре</b>"}},
+		{name: "entity", text: strings.Repeat("a", 8) + "&amp;" + strings.Repeat("b", 8), limit: 10, want: []string{"aaaaaaaa", "&amp;bbbbb", "bbb"}},
+		{name: "surrogate pairs", text: strings.Repeat("😀", 6), limit: 4, want: []string{"😀😀", "😀😀", "😀😀"}},
+		{name: "tag longer than limit", text: `до <a href="` + longURL + `">ссылка</a> после`, limit: 30},
+		{name: "long tag inside formatting", text: "<b>жирный " + `<a href="` + longURL + `">ссылка</a>` + " текст</b>", limit: 30},
+		{name: "nested tags", text: "<blockquote><b><i>" + strings.Repeat("слово ", 20) + "</i></b></blockquote>", limit: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitHTML(tt.text, tt.limit)
+			if tt.want != nil && strings.Join(parts, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("SplitHTML() = %q, want %q", parts, tt.want)
+			}
+
+			var text strings.Builder
+			for _, part := range parts {
+				if n := textLen(part); n > tt.limit {
+					t.Errorf("part %q has length %d, want at most %d", part, n, tt.limit)
+				}
+				if !hasText(part) {
+					t.Errorf("part %q has no text", part)
+				}
+				if stack := applyTokens(tokenize(part)); len(stack) != 0 {
+					t.Errorf("part %q leaves tags open: %v", part, stack)
+				}
+				text.WriteString(plainText(part))
+			}
+			if got, want := text.String(), plainText(tt.text); got != want {
+				t.Errorf("text of parts = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// applyTokens возвращает теги, оставшиеся открытыми после всех токенов
+func applyTokens(tokens []token) []openTag {
+	var stack []openTag
+	for _, t := range tokens {
+		stack = applyToken(stack, t)
+	}
+	return stack
+}
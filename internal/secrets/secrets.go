@@ -0,0 +1,212 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// sealedPrefix помечает зашифрованные значения: enc:v2:<key id>:<wrapped data key>:<ciphertext>.
+// Шифротекст v2 привязан к контексту значения (см. Seal).
+const sealedPrefix = "enc:v2:"
+
+// legacyPrefix помечает значения первой версии, зашифрованные без контекста.
+// Они расшифровываются для совместимости и при следующем сохранении шифруются заново как v2.
+const legacyPrefix = "enc:v1:"
+
+// keySize размер мастер-ключа и ключа данных (AES-256)
+const keySize = 32
+
+// ErrUnknownKey возвращается, если значение зашифровано ключом, которого нет в связке
+var ErrUnknownKey = errors.New("неизвестный ключ шифрования")
+
+// Keyring хранит мастер-ключи шифрования по их идентификаторам.
+// Новые значения шифруются активным ключом, расшифровка возможна любым ключом из связки,
+// что позволяет ротировать ключи без потери уже сохраненных данных.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// NewKeyring создает связку ключей; activeID должен присутствовать в keys
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("активный ключ %q отсутствует в связке", activeID)
+	}
+
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("недопустимый идентификатор ключа %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("ключ %q должен быть длиной %d байт", id, keySize)
+		}
+	}
+
+	return &Keyring{activeID: activeID, keys: keys}, nil
+}
+
+// KeyringFromEnv читает ключи из SESSION_ENCRYPTION_KEYS в формате
+// "id2:base64key,id1:base64key". Первый ключ в списке активный.
+// Если переменная не задана, возвращается nil без ошибки.
+func KeyringFromEnv() (*Keyring, error) {
+	value := strings.TrimSpace(os.Getenv("SESSION_ENCRYPTION_KEYS"))
+	if value == "" {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte)
+	activeID := ""
+
+	for _, entry := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("неверный формат ключа %q, ожидается id:base64", entry)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", id, err)
+		}
+
+		if activeID == "" {
+			activeID = id
+		}
+		keys[id] = key
+	}
+
+	return NewKeyring(activeID, keys)
+}
+
+// ActiveKeyID возвращает идентификатор ключа, которым шифруются новые значения
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// IsSealed проверяет, является ли значение зашифрованным
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix) || strings.HasPrefix(value, legacyPrefix)
+}
+
+// Seal шифрует значение конвертной схемой: случайный ключ данных шифрует значение,
+// а сам ключ данных шифруется активным мастер-ключом. Пустая строка не шифруется.
+//
+// context описывает, где хранится значение (например, чат и имя поля), и входит в
+// дополнительные данные AES-GCM: расшифровать значение можно только с тем же контекстом,
+// поэтому его нельзя перенести в другую сессию или другое поле.
+func (k *Keyring) Seal(plaintext, context string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := encrypt(k.keys[k.activeID], dataKey, []byte(k.activeID))
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := encrypt(dataKey, []byte(plaintext), []byte(context))
+	if err != nil {
+		return "", err
+	}
+
+	return sealedPrefix + k.activeID + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open расшифровывает значение, созданное Seal с тем же context. Незашифрованные
+// значения возвращаются без изменений, чтобы старые сессии продолжали работать.
+func (k *Keyring) Open(sealed, context string) (string, error) {
+	var additionalData []byte
+	switch {
+	case strings.HasPrefix(sealed, sealedPrefix):
+		sealed = strings.TrimPrefix(sealed, sealedPrefix)
+		additionalData = []byte(context)
+	case strings.HasPrefix(sealed, legacyPrefix):
+		sealed = strings.TrimPrefix(sealed, legacyPrefix)
+	default:
+		return sealed, nil
+	}
+
+	parts := strings.Split(sealed, ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("поврежденное зашифрованное значение")
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("поврежденный ключ данных: %w", err)
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("поврежденные данные: %w", err)
+	}
+
+	dataKey, err := decrypt(masterKey, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("ошибка расшифровки ключа данных: %w", err)
+	}
+
+	plaintext, err := decrypt(dataKey, ciphertext, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("ошибка расшифровки данных: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// encrypt шифрует данные AES-GCM, добавляя nonce в начало результата
+func encrypt(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// decrypt расшифровывает данные, созданные encrypt
+func decrypt(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("слишком короткие данные")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// newGCM создает AES-GCM для ключа
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,221 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testContext = "chat:1001/field:eljur_token"
+
+// newTestKeyring создает связку из ключей с байтами-заполнителями: id -> байт
+func newTestKeyring(t *testing.T, activeID string, fill map[string]byte) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for id, b := range fill {
+		keys[id] = bytes.Repeat([]byte{b}, keySize)
+	}
+	keyring, err := NewKeyring(activeID, keys)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return keyring
+}
+
+func TestSealOpen(t *testing.T) {
+	keyring := newTestKeyring(t, "k1", map[string]byte{"k1": 1})
+
+	sealed, err := keyring.Seal("secret-token", testContext)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || !strings.HasPrefix(sealed, sealedPrefix+"k1:") {
+		t.Errorf("Seal() = %q, want %sk1: prefix", sealed, sealedPrefix)
+	}
+	if strings.Contains(sealed, "secret-token") {
+		t.Errorf("Seal() = %q contains plaintext", sealed)
+	}
+
+	again, _ := keyring.Seal("secret-token", testContext)
+	if again == sealed {
+		t.Error("Seal() is deterministic, want random data key and nonce")
+	}
+
+	if got, err := keyring.Open(sealed, testContext); err != nil || got != "secret-token" {
+		t.Errorf("Open() = %q, %v, want secret-token", got, err)
+	}
+
+	// Пустые и незашифрованные значения проходят без изменений
+	if got, _ := keyring.Seal("", testContext); got != "" {
+		t.Errorf("Seal(\"\") = %q, want empty", got)
+	}
+	if got, err := keyring.Open("plain", testContext); err != nil || got != "plain" {
+		t.Errorf("Open(plain) = %q, %v, want plain", got, err)
+	}
+}
+
+func TestOpenRotatedKey(t *testing.T) {
+	old := newTestKeyring(t, "k1", map[string]byte{"k1": 1})
+	sealed, err := old.Seal("secret-token", testContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Новый активный ключ, старый оставлен только для расшифровки
+	rotated := newTestKeyring(t, "k2", map[string]byte{"k2": 2, "k1": 1})
+	if got, err := rotated.Open(sealed, testContext); err != nil || got != "secret-token" {
+		t.Errorf("Open() with rotated keyring = %q, %v", got, err)
+	}
+	if resealed, _ := rotated.Seal("secret-token", testContext); !strings.HasPrefix(resealed, sealedPrefix+"k2:") {
+		t.Errorf("Seal() after rotation = %q, want active key k2", resealed)
+	}
+
+	// Ключ удален из связки
+	retired := newTestKeyring(t, "k2", map[string]byte{"k2": 2})
+	if _, err := retired.Open(sealed, testContext); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open() with retired key error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	keyring := newTestKeyring(t, "k1", map[string]byte{"k1": 1, "k2": 2})
+	sealed, err := keyring.Seal("secret-token", testContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, sealedPrefix), ":")
+
+	// flipLastByte портит последний байт (тег GCM) закодированной части
+	flipLastByte := func(part string) string {
+		data, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	// flipFirstByte портит первый байт шифротекста после nonce
+	flipFirstByte := func(part string) string {
+		data, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[12] ^= 0xff
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	join := func(parts ...string) string {
+		return sealedPrefix + strings.Join(parts, ":")
+	}
+
+	tests := []struct {
+		name    string
+		sealed  string
+		context string
+	}{
+		{"ciphertext", join(parts[0], parts[1], flipFirstByte(parts[2])), testContext},
+		{"ciphertext tag", join(parts[0], parts[1], flipLastByte(parts[2])), testContext},
+		{"wrapped key tag", join(parts[0], flipLastByte(parts[1]), parts[2]), testContext},
+		{"other key id", join("k2", parts[1], parts[2]), testContext},
+		{"other chat", sealed, "chat:1002/field:eljur_token"},
+		{"other field", sealed, "chat:1001/field:eljur_password"},
+		{"downgraded to v1", legacyPrefix + strings.Join(parts, ":"), testContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := keyring.Open(tt.sealed, tt.context); err == nil {
+				t.Errorf("Open() = %q, want error", got)
+			}
+		})
+	}
+}
+
+func TestOpenMalformed(t *testing.T) {
+	keyring := newTestKeyring(t, "k1", map[string]byte{"k1": 1})
+
+	tests := []struct {
+		name    string
+		sealed  string
+		wantErr error
+	}{
+		{"no parts", "enc:v2:", nil},
+		{"missing ciphertext", "enc:v2:k1:AAAA", nil},
+		{"extra part", "enc:v2:k1:AAAA:AAAA:AAAA", nil},
+		{"unknown key", "enc:v2:k9:AAAA:AAAA", ErrUnknownKey},
+		{"bad wrapped key encoding", "enc:v2:k1:!!!:AAAA", nil},
+		{"bad ciphertext encoding", "enc:v2:k1:AAAA:!!!", nil},
+		{"short data", "enc:v2:k1:AAAA:AAAA", nil},
+		{"malformed v1", "enc:v1:k1:AAAA", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyring.Open(tt.sealed, testContext)
+			if err == nil {
+				t.Fatalf("Open(%q) = %q, want error", tt.sealed, got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Open(%q) error = %v, want %v", tt.sealed, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenLegacyValue(t *testing.T) {
+	keyring := newTestKeyring(t, "k1", map[string]byte{"k1": 1})
+
+	// Значение v1 зашифровано без контекста
+	dataKey := bytes.Repeat([]byte{9}, keySize)
+	wrappedKey, err := encrypt(keyring.keys["k1"], dataKey, []byte("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := encrypt(dataKey, []byte("legacy-token"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := legacyPrefix + "k1:" + base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext)
+
+	if got, err := keyring.Open(sealed, testContext); err != nil || got != "legacy-token" {
+		t.Errorf("Open(v1) = %q, %v, want legacy-token", got, err)
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, keySize))
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	tests := []struct {
+		name     string
+		value    string
+		wantNil  bool
+		wantErr  bool
+		activeID string
+	}{
+		{name: "unset", value: "", wantNil: true},
+		{name: "single", value: "k1:" + key, activeID: "k1"},
+		{name: "first is active", value: "k2:" + key + ", k1:" + key, activeID: "k2"},
+		{name: "missing id", value: key, wantErr: true},
+		{name: "invalid base64", value: "k1:your_base64_32_byte_key_here", wantErr: true},
+		{name: "wrong size", value: "k1:" + short, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SESSION_ENCRYPTION_KEYS", tt.value)
+			keyring, err := KeyringFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KeyringFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (keyring == nil) != tt.wantNil {
+				t.Fatalf("KeyringFromEnv() = %v, wantNil %v", keyring, tt.wantNil)
+			}
+			if keyring != nil && keyring.ActiveKeyID() != tt.activeID {
+				t.Errorf("ActiveKeyID() = %q, want %q", keyring.ActiveKeyID(), tt.activeID)
+			}
+		})
+	}
+}
@@ -1,51 +1,135 @@
 package main
 
 import (
-        "log"
-        "os"
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
 
-        "school-diary-bot/internal/bot"
-        "school-diary-bot/internal/eljur"
-        tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"school-diary-bot/bot"
+	"school-diary-bot/bot/eljur"
+	"school-diary-bot/internal/logging"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// defaultNotifyInterval интервал проверки новых оценок по умолчанию
+const defaultNotifyInterval = 15 * time.Minute
+
 func main() {
-        // Проверяем наличие необходимых переменных окружения
-        if err := eljur.ValidateConfig(); err != nil {
-                log.Fatal("Ошибка конфигурации:", err)
-        }
-
-        // Получаем токен бота из переменных окружения
-        botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-        if botToken == "" {
-                log.Fatal("TELEGRAM_BOT_TOKEN не установлен")
-        }
-
-        // Создаем экземпляр бота
-        diaryBot, err := bot.NewBot(botToken)
-        if err != nil {
-                log.Fatal("Ошибка создания бота:", err)
-        }
-
-        log.Printf("Бот запущен: %s", diaryBot.API.Self.UserName)
-
-        // Настройка получения обновлений
-        u := tgbotapi.NewUpdate(0)
-        u.Timeout = 60
-
-        updates := diaryBot.API.GetUpdatesChan(u)
-
-        // Обработка сообщений
-        for update := range updates {
-                if update.Message != nil {
-                        if err := diaryBot.HandleMessage(update.Message); err != nil {
-                                log.Printf("Ошибка обработки сообщения: %v", err)
-                        }
-                } else if update.CallbackQuery != nil {
-                        if err := diaryBot.HandleCallback(update.CallbackQuery); err != nil {
-                                log.Printf("Ошибка обработки callback: %v", err)
-                        }
-                }
-        }
+	// LOG_LEVEL=debug включает подробные логи, секреты в них маскируются
+	logging.Init()
+
+	// Проверяем наличие необходимых переменных окружения
+	if err := eljur.ValidateConfig(); err != nil {
+		log.Fatal("Ошибка конфигурации:", err)
+	}
+	if err := bot.ValidateConfig(); err != nil {
+		log.Fatal("Ошибка конфигурации:", err)
+	}
+
+	// BOT_TRANSPORT=cli запускает бота в терминале для локальной отладки
+	switch transport := os.Getenv("BOT_TRANSPORT"); transport {
+	case "", "telegram":
+		runTelegram()
+	case "cli":
+		runCLI()
+	default:
+		log.Fatalf("Неизвестный BOT_TRANSPORT: %s", transport)
+	}
+}
+
+// runTelegram запускает бота в режиме long polling Telegram
+func runTelegram() {
+	// Получаем токен бота из переменных окружения
+	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if botToken == "" {
+		log.Fatal("TELEGRAM_BOT_TOKEN не установлен")
+	}
+
+	// Создаем экземпляр бота
+	telegram, err := bot.NewTelegramMessenger(botToken)
+	if err != nil {
+		log.Fatal("Ошибка создания бота:", err)
+	}
+	diaryBot := bot.NewBotWithMessenger(telegram)
+
+	slog.Info("Бот запущен", "username", telegram.API.Self.UserName)
+
+	// Запускаем фоновую проверку уведомлений
+	go runNotifier(diaryBot, notifyInterval())
+
+	// Настройка получения обновлений
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	updates := telegram.API.GetUpdatesChan(u)
+
+	// Обработка сообщений
+	for update := range updates {
+		if update.Message != nil {
+			if err := diaryBot.HandleMessage(context.Background(), bot.TelegramMessage(update.Message)); err != nil {
+				slog.Error("Ошибка обработки сообщения", "user_id", update.Message.From.ID, "err", err)
+			}
+		} else if update.CallbackQuery != nil {
+			if err := diaryBot.HandleCallback(context.Background(), bot.TelegramCallback(update.CallbackQuery)); err != nil {
+				slog.Error("Ошибка обработки callback", "user_id", update.CallbackQuery.From.ID, "err", err)
+			}
+		}
+	}
 }
 
+// runCLI запускает бота в терминале: сообщения читаются из stdin, ответы выводятся в stdout
+func runCLI() {
+	chatID := int64(1)
+	if value := os.Getenv("CLI_CHAT_ID"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("Некорректный CLI_CHAT_ID: %s", value)
+		}
+		chatID = id
+	}
+
+	cli := bot.NewCLIMessenger(os.Stdout)
+	diaryBot := bot.NewBotWithMessenger(cli)
+
+	slog.Info("Бот запущен в терминале. Введите /start, номер кнопки или /photo путь [подпись]", "chat_id", chatID)
+
+	go runNotifier(diaryBot, notifyInterval())
+
+	if err := cli.Run(context.Background(), diaryBot, chatID, os.Stdin); err != nil {
+		log.Fatal("Ошибка чтения ввода:", err)
+	}
+}
+
+// notifyInterval возвращает интервал проверки уведомлений из NOTIFY_INTERVAL
+func notifyInterval() time.Duration {
+	value := os.Getenv("NOTIFY_INTERVAL")
+	if value == "" {
+		return defaultNotifyInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < time.Minute {
+		slog.Warn("Некорректный NOTIFY_INTERVAL, используем значение по умолчанию", "value", value, "default", defaultNotifyInterval)
+		return defaultNotifyInterval
+	}
+	return interval
+}
+
+// runNotifier периодически проверяет новые оценки подписанных пользователей
+func runNotifier(diaryBot *bot.Bot, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checked, err := diaryBot.PollNotifications(context.Background())
+		if err != nil {
+			slog.Error("Ошибка проверки уведомлений", "err", err)
+			continue
+		}
+		slog.Info("Проверка уведомлений завершена", "checked", checked)
+	}
+}